@@ -0,0 +1,207 @@
+package admin
+
+// HTTP endpoint for runtime reconfiguration of the sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/kiwi"
+)
+
+// SinkInfo is the state of the sink returned by the handler.
+type SinkInfo struct {
+	// ID is the name of the sink (see kiwi.Sink.Named()) or its order
+	// number for the sinks without names.
+	ID      string            `json:"id"`
+	Active  bool              `json:"active"`
+	Healthy bool              `json:"healthy"`
+	Filters []kiwi.FilterInfo `json:"filters"`
+	Stats   kiwi.SinkStats    `json:"stats"`
+}
+
+// Handler serves the sinks and their filters as JSON and allows to
+// change the filters and pause or start the sinks at runtime. So the
+// debug output could be turned on in production without redeploying.
+// It should be mounted with stripped prefix:
+//
+//	http.Handle("/debug/kiwi/", http.StripPrefix("/debug/kiwi", admin.Handler()))
+//
+// The sinks are addressed by their names or their order numbers:
+//
+//	GET    /                  lists the sinks
+//	GET    /{sink}            shows the sink
+//	POST   /{sink}/filters    adds the filter (see below)
+//	DELETE /{sink}/filters    removes the filters for the keys in "key" parameters
+//	POST   /{sink}/stop       pauses the sink
+//	POST   /{sink}/start      starts the sink
+//
+// The filter added with "key" and "op" form parameters. The op is one
+// of "has", "has-not", "value", "not-value", "regexp", "not-regexp".
+// The values of "value" and "not-value" ops and the expression of
+// "regexp" and "not-regexp" ops passed in "value" parameters:
+//
+//	curl -d key=level -d op=value -d value=debug -d value=info localhost:8080/debug/kiwi/console/filters
+//
+// The handler has no authorization so don't expose it to the public
+// networks.
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	var parts = strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var sinks = kiwi.Sinks()
+		var infos = make([]SinkInfo, len(sinks))
+		for i, s := range sinks {
+			infos[i] = info(i, s)
+		}
+		reply(w, infos)
+		return
+	}
+	var i, s = find(parts[0])
+	if s == nil {
+		http.Error(w, "sink not found", http.StatusNotFound)
+		return
+	}
+	var action string
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+	switch {
+	case len(parts) > 2:
+		http.NotFound(w, r)
+		return
+	case action == "" && r.Method == http.MethodGet:
+	case action == "filters" && r.Method == http.MethodPost:
+		if err := addFilter(s, r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case action == "filters" && r.Method == http.MethodDelete:
+		r.ParseForm()
+		s.Reset(r.Form["key"]...)
+	case action == "stop" && r.Method == http.MethodPost:
+		s.Stop()
+	case action == "start" && r.Method == http.MethodPost:
+		s.Start()
+	case action == "" || action == "filters" || action == "stop" || action == "start":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	reply(w, info(i, s))
+}
+
+// find returns the sink by the name or the order number.
+func find(id string) (int, *kiwi.Sink) {
+	var sinks = kiwi.Sinks()
+	for i, s := range sinks {
+		if s.Name() == id {
+			return i, s
+		}
+	}
+	if i, err := strconv.Atoi(id); err == nil && i >= 0 && i < len(sinks) {
+		return i, sinks[i]
+	}
+	return 0, nil
+}
+
+func info(i int, s *kiwi.Sink) SinkInfo {
+	var id = s.Name()
+	if id == "" {
+		id = strconv.Itoa(i)
+	}
+	return SinkInfo{ID: id, Active: s.Active(), Healthy: s.Healthy(), Filters: s.Filters(), Stats: s.Stats()}
+}
+
+// errBadFilter is the error of the request for adding the filter.
+type errBadFilter string
+
+func (e errBadFilter) Error() string {
+	return string(e)
+}
+
+func addFilter(s *kiwi.Sink, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	var (
+		key  = r.Form.Get("key")
+		vals = r.Form["value"]
+	)
+	if key == "" {
+		return errBadFilter("key required")
+	}
+	switch op := r.Form.Get("op"); op {
+	case "has":
+		s.HasKey(key)
+	case "has-not":
+		s.HasNotKey(key)
+	case "value":
+		s.HasValue(key, vals...)
+	case "not-value":
+		s.HasNotValue(key, vals...)
+	case "regexp", "not-regexp":
+		if len(vals) != 1 {
+			return errBadFilter("single value with the expression required")
+		}
+		// The sink panics on the invalid expressions.
+		if _, err := regexp.Compile(vals[0]); err != nil {
+			return err
+		}
+		if op == "regexp" {
+			s.WithRegexp(key, vals[0])
+		} else {
+			s.WithoutRegexp(key, vals[0])
+		}
+	default:
+		return errBadFilter("unknown op " + strconv.Quote(op))
+	}
+	return nil
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
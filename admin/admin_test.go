@@ -0,0 +1,103 @@
+package admin
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/grafov/kiwi"
+)
+
+// Test of adding and removing the filter and pausing the sink.
+func TestHandler_Filters(t *testing.T) {
+	out := kiwi.SinkTo(ioutil.Discard, kiwi.AsLogfmt()).Named("admin-test").Start()
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	resp, err := http.PostForm(srv.URL+"/admin-test/filters", url.Values{"key": {"level"}, "op": {"value"}, "value": {"debug"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var added SinkInfo
+	json.NewDecoder(resp.Body).Decode(&added)
+	resp.Body.Close()
+	http.Post(srv.URL+"/admin-test/stop", "", nil)
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/admin-test/filters?key=level", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removed SinkInfo
+	json.NewDecoder(resp.Body).Decode(&removed)
+	resp.Body.Close()
+
+	if len(added.Filters) != 1 || added.Filters[0].Key != "level" || added.Filters[0].Filter != `value in ["debug"]` || !added.Active {
+		t.Logf("unexpected state after adding the filter %+v", added)
+		t.Fail()
+	}
+	if len(removed.Filters) != 0 || removed.Active || out.Active() {
+		t.Logf("unexpected state after removing the filter %+v", removed)
+		t.Fail()
+	}
+	out.Close()
+}
+
+// Test of the errors of the requests.
+func TestHandler_Errors(t *testing.T) {
+	kiwi.SinkTo(ioutil.Discard, kiwi.AsLogfmt()).Named("admin-errors")
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	notFound, _ := http.Get(srv.URL + "/no-such-sink")
+	badOp, _ := http.Post(srv.URL+"/admin-errors/filters", "application/x-www-form-urlencoded", strings.NewReader("key=a&op=unknown"))
+	badRegexp, _ := http.Post(srv.URL+"/admin-errors/filters", "application/x-www-form-urlencoded", strings.NewReader("key=a&op=regexp&value=("))
+
+	if notFound.StatusCode != http.StatusNotFound || badOp.StatusCode != http.StatusBadRequest || badRegexp.StatusCode != http.StatusBadRequest {
+		t.Logf("unexpected statuses %d, %d, %d", notFound.StatusCode, badOp.StatusCode, badRegexp.StatusCode)
+		t.Fail()
+	}
+}
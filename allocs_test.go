@@ -0,0 +1,68 @@
+//go:build !race
+// +build !race
+
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"testing"
+)
+
+// Test the typed Add methods do not allocate when the values need no
+// conversion. The race detector drops the records from the pool so
+// the test runs without it.
+func TestLogger_TypedAdd_NoAllocs(t *testing.T) {
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(nil, nil).Start()
+	defer out.Close()
+	log.AddString("s", "a").AddInt("i", 1).AddBool("b", true).Log()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		log.AddString("s", "a").AddInt("i", 1).AddBool("b", true).Log()
+	})
+
+	if allocs != 0 {
+		t.Logf("expected no allocations got %v", allocs)
+		t.Fail()
+	}
+}
@@ -0,0 +1,117 @@
+package kiwi
+
+// This file consists of the asynchronous mode of the sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import "sync/atomic"
+
+type asyncQueue struct {
+	records chan chain
+	policy  int
+}
+
+// Async switches the sink to the asynchronous mode. The loggers do
+// not wait until the sink writes the records, they only put the
+// records to the queue of bufferSize records. So the slow writer
+// can't stall the application. When the queue is full the policy
+// applied: DropOldest drops the oldest record in the queue, DropNewest
+// drops the new record and Block waits for the room in the queue. The
+// dropped records are counted by Stats(). The records matched by
+// Priority() still pass through the priority lane. Zero bufferSize
+// switches the sink back to the synchronous mode. The mode should be
+// set before the sink is started.
+func (s *Sink) Async(bufferSize, policy int) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		if bufferSize <= 0 {
+			s.async.Store((*asyncQueue)(nil))
+		} else {
+			s.async.Store(&asyncQueue{make(chan chain, bufferSize), policy})
+		}
+	}
+	return s
+}
+
+// enqueue puts the record to the queue of the asynchronous sink.
+func (s *Sink) enqueue(q *asyncQueue, c chain) {
+	switch q.policy {
+	case Block:
+		q.records <- c
+	case DropNewest:
+		select {
+		case q.records <- c:
+		default:
+			s.discard(c)
+			return
+		}
+	default:
+		for sent := false; !sent; {
+			select {
+			case q.records <- c:
+				sent = true
+			default:
+				// Make room by dropping the oldest record.
+				select {
+				case old := <-q.records:
+					s.discard(old)
+				default:
+				}
+			}
+		}
+	}
+	select {
+	case s.asyncSignal <- struct{}{}:
+	default:
+	}
+}
+
+// drainAsync processes the records waiting in the queue of the
+// asynchronous sink.
+func (s *Sink) drainAsync(q *asyncQueue) {
+	for {
+		select {
+		case c := <-q.records:
+			s.processPriority()
+			s.processRecord(c)
+		default:
+			return
+		}
+	}
+}
+
+// discard drops the queued record.
+func (s *Sink) discard(c chain) {
+	if c.size > 0 {
+		atomic.AddInt64(&budget.buffered, -c.size)
+	}
+	c.rec.release()
+	atomic.AddUint64(&s.stats.dropped, 1)
+}
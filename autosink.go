@@ -0,0 +1,83 @@
+package kiwi
+
+// This file consists of the sink that selects the format by capabilities of the output.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"io"
+	"os"
+)
+
+// PlainFormat returns the formatter used by AutoSink() for the
+// outputs that are not color terminals. It is logfmt by default, set
+// it to AsJSON for example when the logs collected by a machine.
+var PlainFormat = func() Formatter { return AsLogfmt() }
+
+// AutoSink creates a sink with the format selected by the
+// capabilities of the output. The terminal that supports colors gets
+// the human friendly colored console format (see AsConsole()) and the pipes,
+// the files and the terminals without colors get PlainFormat():
+//
+//	kiwi.AutoSink(os.Stderr).Start()
+//
+// The colors are disabled by NO_COLOR or CLICOLOR=0 environment
+// variables and forced by CLICOLOR_FORCE. The console of old Windows
+// versions without ANSI escape sequences support treated as the
+// terminal without colors.
+func AutoSink(w io.Writer) *Sink {
+	if colorTerminal(w) {
+		return SinkTo(w, AsConsole().Colors(true))
+	}
+	return SinkTo(w, PlainFormat())
+}
+
+// colorTerminal reports whether the output is the terminal that
+// supports colors according to the environment.
+func colorTerminal(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("CLICOLOR") == "0" {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	var f, ok = w.(*os.File)
+	if !ok || !isTerminal(f) || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return enableColors(f)
+}
+
+// isTerminal reports whether the file is the character device.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,123 @@
+package kiwi
+
+// Batching of the writes to the sink outputs.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type writeBatch struct {
+	maxRecords int
+	maxBytes   int
+	interval   time.Duration
+
+	sync.Mutex
+	buf     []byte
+	records int
+	timer   *time.Timer
+}
+
+// Batch accumulates the formatted records and writes them to the
+// output of the sink in a single Write() call. The batch is written
+// when it has maxRecords records or maxBytes bytes or when
+// flushInterval passed since the first record was added to it. Zero
+// values disable the corresponding limits:
+//
+//	kiwi.SinkTo(file, kiwi.AsJSON()).Batch(512, 64*1024, 100*time.Millisecond).Start()
+//
+// It reduces the syscalls for the files and the network writers
+// under high throughput. The errors and the timeouts of the writes
+// are reported for the whole batch (see OnError(), WriteTimeout()).
+// Call with all zero values writes the current batch and disables
+// batching. Flush() writes the current batch too.
+func (s *Sink) Batch(maxRecords, maxBytes int, flushInterval time.Duration) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		var b *writeBatch
+		if maxRecords > 0 || maxBytes > 0 || flushInterval > 0 {
+			b = &writeBatch{
+				maxRecords: maxRecords,
+				maxBytes:   maxBytes,
+				interval:   flushInterval,
+				buf:        make([]byte, 0, maxBytes),
+			}
+		}
+		if old, _ := s.batch.Load().(*writeBatch); old != nil {
+			old.flush(s)
+		}
+		s.batch.Store(b)
+	}
+	return s
+}
+
+// add adds the line to the batch and writes the batch when it full.
+func (b *writeBatch) add(s *Sink, line []byte) {
+	b.Lock()
+	if b.maxBytes > 0 && len(b.buf) > 0 && len(b.buf)+len(line) > b.maxBytes {
+		// Keep the batch not larger than the limit.
+		b.writeOut(s)
+	}
+	b.buf = append(b.buf, line...)
+	b.records++
+	switch {
+	case b.maxRecords > 0 && b.records >= b.maxRecords,
+		b.maxBytes > 0 && len(b.buf) >= b.maxBytes:
+		b.writeOut(s)
+	case b.interval > 0 && b.timer == nil:
+		b.timer = time.AfterFunc(b.interval, func() { b.flush(s) })
+	}
+	b.Unlock()
+}
+
+// flush writes the batch.
+func (b *writeBatch) flush(s *Sink) {
+	b.Lock()
+	b.writeOut(s)
+	b.Unlock()
+}
+
+// writeOut writes the batch to the output of the sink. It should be
+// called under the lock.
+func (b *writeBatch) writeOut(s *Sink) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.buf) == 0 {
+		return
+	}
+	s.writeOut(b.buf)
+	b.buf = b.buf[:0]
+	b.records = 0
+}
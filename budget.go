@@ -0,0 +1,163 @@
+package kiwi
+
+// This file consists of the memory budget for the records queued in the sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync/atomic"
+)
+
+// Drop policies applied when the memory budget is exceeded or the
+// queue of the asynchronous sink is full.
+const (
+	// DropOldest drops the oldest records waiting in the sink
+	// queues until the queued size fits the budget.
+	DropOldest = iota
+	// DropLowSeverity stops queueing the records with severity
+	// lower than "warning" while the budget is exceeded. The records
+	// of higher severity still queued.
+	DropLowSeverity
+	// DropNewest drops the record that does not fit the full queue
+	// of the asynchronous sink (see Sink.Async()).
+	DropNewest
+	// Block waits until the full queue of the asynchronous sink has
+	// room for the record.
+	Block
+)
+
+// SeverityKey is the key that keeps the severity of the record. It
+// is the same as default level.LevelName.
+var SeverityKey = "level"
+
+// Severities ranks the values of SeverityKey. The records without
+// the key or with unknown values ranked as "info".
+var Severities = map[string]int{
+	"debug":    0,
+	"info":     1,
+	"warn":     2,
+	"warning":  2,
+	"error":    3,
+	"critical": 4,
+	"panic":    5,
+	"fatal":    5,
+}
+
+// warningSeverity is the lowest severity kept by DropLowSeverity
+// policy.
+const warningSeverity = 2
+
+var budget struct {
+	limit    int64
+	policy   int32
+	buffered int64
+	dropped  uint64
+}
+
+// SetMemoryBudget restricts the total size in bytes of the records
+// queued in all the sinks. When the limit is exceeded the records
+// dropped according to the policy (DropOldest or DropLowSeverity).
+// The drops counted globally (see MemoryStats()) and for each sink
+// (see Sink.Stats()). Zero limit disables the budget.
+func SetMemoryBudget(limit int64, policy int) {
+	atomic.StoreInt32(&budget.policy, int32(policy))
+	atomic.StoreInt64(&budget.limit, limit)
+}
+
+// MemoryStats returns the size of the records queued in the sinks
+// and the total number of the records dropped because of the memory
+// budget. The size is counted only when the budget is set.
+func MemoryStats() (buffered int64, dropped uint64) {
+	return atomic.LoadInt64(&budget.buffered), atomic.LoadUint64(&budget.dropped)
+}
+
+// recordSize estimates the memory used by the record.
+func recordSize(record []*Pair) int64 {
+	// Approximate size of the Pair struct itself.
+	const pairOverhead = 64
+	var size int64
+	for _, p := range record {
+		size += int64(len(p.Key)+len(p.Val)) + pairOverhead
+	}
+	return size
+}
+
+// severityOf returns the rank of the record severity.
+func severityOf(record []*Pair) int {
+	for _, p := range record {
+		if p.Key == SeverityKey {
+			// The case of the level is ignored as for the sink
+			// filters (see WithLevelAtLeast()).
+			return severityRank(p.Val)
+		}
+	}
+	return Severities["info"]
+}
+
+// overBudget reports whether the queued records exceed the budget.
+func overBudget() bool {
+	var limit = atomic.LoadInt64(&budget.limit)
+	return limit > 0 && atomic.LoadInt64(&budget.buffered) > limit
+}
+
+// admit decides whether the record could be queued to the sink
+// according to the budget. It accounts the size of admitted record.
+func (s *Sink) admit(record []*Pair, size int64) bool {
+	if size == 0 {
+		return true
+	}
+	if atomic.LoadInt32(&budget.policy) == DropLowSeverity && overBudget() && severityOf(record) < warningSeverity {
+		s.drop()
+		return false
+	}
+	atomic.AddInt64(&budget.buffered, size)
+	return true
+}
+
+// release returns the size of the record taken from the queue to the
+// budget. It reports whether the record should be dropped by
+// DropOldest policy.
+func (s *Sink) release(size int64) (drop bool) {
+	if size == 0 {
+		return false
+	}
+	drop = atomic.LoadInt32(&budget.policy) == DropOldest && overBudget()
+	atomic.AddInt64(&budget.buffered, -size)
+	if drop {
+		s.drop()
+	}
+	return drop
+}
+
+func (s *Sink) drop() {
+	atomic.AddUint64(&budget.dropped, 1)
+	atomic.AddUint64(&s.stats.dropped, 1)
+}
@@ -0,0 +1,124 @@
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// simulateBacklog pretends that the sinks have queued records of the
+// size.
+func simulateBacklog(size int64) func() {
+	atomic.AddInt64(&budget.buffered, size)
+	return func() {
+		atomic.AddInt64(&budget.buffered, -size)
+		SetMemoryBudget(0, DropOldest)
+	}
+}
+
+// Test that the low severity records dropped when the budget exceeded.
+func TestBudget_DropLowSeverity(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).HasKey("budget-test").Start()
+	defer out.Close()
+	SetMemoryBudget(1, DropLowSeverity)
+	defer simulateBacklog(1000)()
+
+	log.Log("budget-test", 1, "level", "debug")
+	log.Log("budget-test", 2, "level", "error")
+
+	out.Flush()
+	if strings.TrimSpace(output.String()) != `budget-test=2 level="error"` {
+		t.Logf("unexpected output %s", output.String())
+		t.Fail()
+	}
+	if out.Stats().Dropped != 1 {
+		t.Logf("expected 1 dropped record got %d", out.Stats().Dropped)
+		t.Fail()
+	}
+}
+
+// Test that the case of the levels ignored for the budget.
+func TestBudget_DropLowSeverityUpperCase(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).HasKey("budget-test-case").Start()
+	defer out.Close()
+	SetMemoryBudget(1, DropLowSeverity)
+	defer simulateBacklog(1000)()
+
+	log.Log("budget-test-case", 1, "level", "DEBUG")
+	log.Log("budget-test-case", 2, "level", "ERROR")
+
+	out.Flush()
+	if strings.TrimSpace(output.String()) != `budget-test-case=2 level="ERROR"` {
+		t.Logf("unexpected output %s", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the queued records dropped when the budget exceeded.
+func TestBudget_DropOldest(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).HasKey("budget-test-oldest").Start()
+	defer out.Close()
+	SetMemoryBudget(1, DropOldest)
+	restore := simulateBacklog(1000)
+
+	log.Log("budget-test-oldest", 1)
+	restore()
+	log.Log("budget-test-oldest", 2)
+
+	out.Flush()
+	if strings.TrimSpace(output.String()) != `budget-test-oldest=2` {
+		t.Logf("unexpected output %s", output.String())
+		t.Fail()
+	}
+	if out.Stats().Dropped != 1 {
+		t.Logf("expected 1 dropped record got %d", out.Stats().Dropped)
+		t.Fail()
+	}
+}
@@ -0,0 +1,72 @@
+package kiwi
+
+// This file consists of the options of the new sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import "sync/atomic"
+
+// DefaultBuffer is the capacity of the queue of the sink created
+// without Buffer() option.
+const DefaultBuffer = 16
+
+// SinkOption configures the sink created by SinkTo(). Unlike the
+// methods of the sink the options set the things that could not be
+// changed after the sink started.
+type SinkOption func(*Sink)
+
+// Buffer sets the capacity of the queue of the sink. The loggers wait
+// for the sink when its queue is full so the bigger queue smooths the
+// bursts of the records:
+//
+//	kiwi.SinkTo(w, kiwi.AsJSON(), kiwi.Buffer(1024)).Start()
+//
+// The depth of the queue and its high-water mark are reported by
+// Stats(). The size less than 1 keeps DefaultBuffer.
+func Buffer(size int) SinkOption {
+	return func(s *Sink) {
+		if size > 0 {
+			s.In = make(chan chain, size)
+		}
+	}
+}
+
+// markHighWater updates the high-water mark of the sink queue with
+// the depth of the queue for the record being queued.
+func (s *Sink) markHighWater() {
+	var depth, _ = s.queueDepth()
+	var mark = int64(depth + 1)
+	for {
+		var old = atomic.LoadInt64(&s.stats.highWater)
+		if mark <= old || atomic.CompareAndSwapInt64(&s.stats.highWater, old, mark) {
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package kiwi
+
+// This file consists of the clock used for the time of the records.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import "time"
+
+// Clock tells the current time to the logger and the sinks. The
+// timestamps of the records are evaluated with the clock of the
+// logger (see Logger.UseClock()) or with the clock of its collector
+// (see Collector.SetClock()). The sinks use the clock of their
+// collector for the time windows of DedupWindow(), LimitByKey() and
+// SamplePerSecond(). So the tests could freeze the time and check the
+// exact output.
+//
+// The values of the pairs evaluated with the clock are the functions
+// func(now time.Time) string (see timestamp package):
+//
+//	log.With(&kiwi.Pair{Key: "ts", Eval: func(now time.Time) string {
+//		return now.Format(time.RFC3339)
+//	}, Type: kiwi.TimeVal})
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts the function to Clock.
+type ClockFunc func() time.Time
+
+// Now calls the function.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// FixedClock returns the clock that always tells the same time.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// SetClock sets the clock for the loggers and the sinks of the
+// collector. Nil clock means the system time.
+func (c *Collector) SetClock(clock Clock) *Collector {
+	c.Lock()
+	c.clock = clock
+	c.Unlock()
+	return c
+}
+
+// now returns the time of the clock of the collector. Nil collector
+// means DefaultCollector.
+func (c *Collector) now() time.Time {
+	if c == nil {
+		c = DefaultCollector
+	}
+	c.RLock()
+	var clock = c.clock
+	c.RUnlock()
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
+
+// UseClock sets the clock that evaluates the timestamps of the
+// records of the logger instead of the clock of its collector. The
+// loggers derived by Fork(), Clone() and Prefix() inherit the clock.
+// Nil clock restores the clock of the collector.
+func (l *Logger) UseClock(clock Clock) *Logger {
+	l.clock = clock
+	return l
+}
+
+// now returns the time of the clock of the record.
+func (r *record) now() time.Time {
+	if r.clock != nil {
+		return r.clock.Now()
+	}
+	return r.collector.now()
+}
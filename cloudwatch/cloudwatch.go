@@ -0,0 +1,453 @@
+package cloudwatch
+
+// Sink writer that sends log records to AWS CloudWatch Logs.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Defaults for the writer. They may be changed per writer with
+// FlushInterval(), MaxPending() and Retries() methods.
+var (
+	DefaultFlushInterval = 5 * time.Second
+	DefaultMaxPending    = 100000
+	DefaultRetries       = 5
+	DefaultRetryInterval = 200 * time.Millisecond
+	DefaultTimeout       = 30 * time.Second
+)
+
+// Limits of PutLogEvents call.
+const (
+	MaxBatchEvents = 10000
+	MaxBatchBytes  = 1048576
+	// MaxEventBytes is the limit of the single event, the longer
+	// records are truncated.
+	MaxEventBytes = 262144
+	// eventOverhead is added to the size of each event in the batch.
+	eventOverhead = 26
+)
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("cloudwatch writer closed")
+
+// Credentials are AWS credentials for signing the requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// EnvCredentials returns the credentials from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func EnvCredentials() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// APIError is the error returned by CloudWatch Logs.
+type APIError struct {
+	Status  int
+	Type    string
+	Message string
+	// ExpectedSequenceToken is set for InvalidSequenceTokenException
+	// and DataAlreadyAcceptedException.
+	ExpectedSequenceToken string
+}
+
+func (e *APIError) Error() string {
+	return "cloudwatch: " + e.Type + ": " + e.Message
+}
+
+// event is the single record in PutLogEvents call.
+type event struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// Writer collects formatted records and sends them to the log stream
+// of CloudWatch Logs with PutLogEvents calls. It conforms io.Writer
+// so it may be used as the output for kiwi.SinkTo():
+//
+//	w := cloudwatch.New("eu-west-1", "/app/api", hostname, cloudwatch.EnvCredentials())
+//	kiwi.SinkTo(w, kiwi.AsJSON()).Start()
+//
+// The records kept in the memory until the flush interval is expired
+// or the batch reached the limits of the call (MaxBatchEvents and
+// MaxBatchBytes). The log group and the log stream are created when
+// they not exist. The sequence tokens are tracked by the writer and
+// the throttled calls are retried with exponential backoff. If
+// CloudWatch is unavailable the records stay pending until the next
+// flush. Writer methods are safe for concurrent usage.
+type Writer struct {
+	region string
+	group  string
+	stream string
+	creds  Credentials
+
+	sync.Mutex
+	endpoint   string
+	client     *http.Client
+	token      string
+	retries    int
+	maxPending int
+	interval   time.Duration
+	pending    []event
+	size       int
+	dropped    int
+	lastErr    error
+	closed     bool
+	started    sync.Once
+	flushing   sync.Mutex
+	flush      chan struct{}
+	done       chan struct{}
+}
+
+// New creates a writer for the log stream of the log group.
+func New(region, group, stream string, creds Credentials) *Writer {
+	return &Writer{
+		region:     region,
+		group:      group,
+		stream:     stream,
+		creds:      creds,
+		endpoint:   "https://logs." + region + ".amazonaws.com/",
+		client:     &http.Client{Timeout: DefaultTimeout},
+		retries:    DefaultRetries,
+		maxPending: DefaultMaxPending,
+		interval:   DefaultFlushInterval,
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// Endpoint sets the URL of CloudWatch Logs API instead of the regional
+// endpoint (for VPC endpoints or local emulators).
+func (w *Writer) Endpoint(url string) *Writer {
+	w.Lock()
+	w.endpoint = url
+	w.Unlock()
+	return w
+}
+
+// FlushInterval sets how long the records may wait in the memory
+// until the batch will be sent. It should be set before the first
+// record will be written.
+func (w *Writer) FlushInterval(d time.Duration) *Writer {
+	if d > 0 {
+		w.Lock()
+		w.interval = d
+		w.Unlock()
+	}
+	return w
+}
+
+// MaxPending restricts number of the records kept in the memory when
+// CloudWatch is unavailable. The oldest records are dropped when the
+// limit is reached.
+func (w *Writer) MaxPending(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.maxPending = n
+		w.Unlock()
+	}
+	return w
+}
+
+// Retries sets how many times the throttled or failed call is retried
+// before the batch returned to the pending records.
+func (w *Writer) Retries(n int) *Writer {
+	if n >= 0 {
+		w.Lock()
+		w.retries = n
+		w.Unlock()
+	}
+	return w
+}
+
+// Write adds a single formatted record to the batch. It never blocks
+// on CloudWatch. It returns the error of the last failed flush if
+// any, the error is reported only once.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.started.Do(func() { go w.flusher() })
+	var message = strings.TrimRight(string(p), "\r\n")
+	if len(message) > MaxEventBytes-eventOverhead {
+		// The cut is moved back to the start of the rune.
+		var cut = MaxEventBytes - eventOverhead
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		message = message[:cut]
+	}
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return 0, ErrClosed
+	}
+	if message != "" {
+		if len(w.pending) >= w.maxPending {
+			w.size -= len(w.pending[0].Message) + eventOverhead
+			w.pending = w.pending[1:]
+			w.dropped++
+		}
+		w.pending = append(w.pending, event{Timestamp: time.Now().UnixNano() / int64(time.Millisecond), Message: message})
+		w.size += len(message) + eventOverhead
+	}
+	var full = len(w.pending) >= MaxBatchEvents || w.size >= MaxBatchBytes
+	var err = w.lastErr
+	w.lastErr = nil
+	w.Unlock()
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), err
+}
+
+// Dropped returns number of the records that were dropped because of
+// MaxPending limit.
+func (w *Writer) Dropped() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.dropped
+}
+
+// Flush sends all pending records.
+func (w *Writer) Flush() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+	for {
+		w.Lock()
+		var n, size int
+		for n < len(w.pending) && n < MaxBatchEvents {
+			var s = len(w.pending[n].Message) + eventOverhead
+			if size+s > MaxBatchBytes {
+				break
+			}
+			size += s
+			n++
+		}
+		var batch = w.pending[:n:n]
+		w.pending = w.pending[n:]
+		w.size -= size
+		w.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := w.put(batch); err != nil {
+			// Return the failed batch back to the head of the queue.
+			w.Lock()
+			w.pending = append(batch, w.pending...)
+			w.size += size
+			for len(w.pending) > w.maxPending {
+				w.size -= len(w.pending[0].Message) + eventOverhead
+				w.pending = w.pending[1:]
+				w.dropped++
+			}
+			w.lastErr = err
+			w.Unlock()
+			return err
+		}
+	}
+}
+
+// Close flushes pending records and stops the writer.
+func (w *Writer) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.Unlock()
+	w.started.Do(func() {})
+	close(w.done)
+	return w.Flush()
+}
+
+func (w *Writer) flusher() {
+	w.Lock()
+	var ticker = time.NewTicker(w.interval)
+	w.Unlock()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.flush:
+		}
+		w.Flush()
+	}
+}
+
+// put sends the batch with PutLogEvents call. It creates the log group
+// and the log stream, fixes the sequence token and retries throttled
+// calls.
+func (w *Writer) put(batch []event) error {
+	w.Lock()
+	var retries = w.retries
+	w.Unlock()
+	var (
+		delay   = DefaultRetryInterval
+		created bool
+		err     error
+	)
+	for attempt := 0; attempt <= retries; attempt++ {
+		var resp struct {
+			NextSequenceToken string `json:"nextSequenceToken"`
+		}
+		w.Lock()
+		var input = map[string]interface{}{
+			"logGroupName":  w.group,
+			"logStreamName": w.stream,
+			"logEvents":     batch,
+		}
+		if w.token != "" {
+			input["sequenceToken"] = w.token
+		}
+		w.Unlock()
+		if err = w.call("PutLogEvents", input, &resp); err == nil {
+			w.setToken(resp.NextSequenceToken)
+			return nil
+		}
+		var apiErr, _ = err.(*APIError)
+		switch {
+		case apiErr == nil:
+		case apiErr.Type == "ResourceNotFoundException" && !created:
+			if err = w.create(); err != nil {
+				return err
+			}
+			created = true
+			w.setToken("")
+			continue
+		case apiErr.Type == "InvalidSequenceTokenException":
+			w.setToken(apiErr.ExpectedSequenceToken)
+			continue
+		case apiErr.Type == "DataAlreadyAcceptedException":
+			w.setToken(apiErr.ExpectedSequenceToken)
+			return nil
+		case apiErr.Type == "ThrottlingException", apiErr.Type == "ServiceUnavailableException", apiErr.Status >= 500:
+		default:
+			return err
+		}
+		if attempt < retries {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+func (w *Writer) setToken(token string) {
+	w.Lock()
+	w.token = token
+	w.Unlock()
+}
+
+// create creates the log group and the log stream if they not exist.
+func (w *Writer) create() error {
+	var group = map[string]string{"logGroupName": w.group}
+	if err := w.call("CreateLogGroup", group, nil); err != nil && !alreadyExists(err) {
+		return err
+	}
+	var stream = map[string]string{"logGroupName": w.group, "logStreamName": w.stream}
+	if err := w.call("CreateLogStream", stream, nil); err != nil && !alreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func alreadyExists(err error) bool {
+	var apiErr, ok = err.(*APIError)
+	return ok && apiErr.Type == "ResourceAlreadyExistsException"
+}
+
+// call calls the action of CloudWatch Logs API with JSON protocol.
+func (w *Writer) call(action string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	w.Lock()
+	var endpoint, client = w.endpoint, w.client
+	w.Unlock()
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Logs_20140328."+action)
+	sign(req, body, w.creds, w.region, time.Now())
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type                  string `json:"__type"`
+			Message               string `json:"message"`
+			ExpectedSequenceToken string `json:"expectedSequenceToken"`
+		}
+		json.Unmarshal(data, &e)
+		// The type may be prefixed with the namespace.
+		if i := strings.LastIndexByte(e.Type, '#'); i >= 0 {
+			e.Type = e.Type[i+1:]
+		}
+		if e.Type == "" {
+			e.Type = resp.Status
+		}
+		return &APIError{Status: resp.StatusCode, Type: e.Type, Message: e.Message, ExpectedSequenceToken: e.ExpectedSequenceToken}
+	}
+	if output != nil && len(data) > 0 {
+		return json.Unmarshal(data, output)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package cloudwatch
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// fakeLogs imitates CloudWatch Logs API. The handler returns the
+// errors from the queue before the successful responses.
+type fakeLogs struct {
+	sync.Mutex
+	calls  []string
+	events int
+	errors []string
+}
+
+func (f *fakeLogs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	var (
+		action = strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.")
+		input  struct {
+			SequenceToken string            `json:"sequenceToken"`
+			LogEvents     []json.RawMessage `json:"logEvents"`
+		}
+	)
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &input)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.calls = append(f.calls, action+":"+input.SequenceToken)
+	if action == "PutLogEvents" && len(f.errors) > 0 {
+		var e = f.errors[0]
+		f.errors = f.errors[1:]
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.logs#` + e + `","message":"m","expectedSequenceToken":"expected"}`))
+		return
+	}
+	if action == "PutLogEvents" {
+		f.events += len(input.LogEvents)
+		w.Write([]byte(`{"nextSequenceToken":"next"}`))
+		return
+	}
+	w.Write([]byte(`{}`))
+}
+
+// Test of creating the log stream and fixing the sequence token.
+func TestWriter_CreateAndSequenceToken(t *testing.T) {
+	fake := &fakeLogs{errors: []string{"ResourceNotFoundException", "InvalidSequenceTokenException"}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	w := New("eu-west-1", "group", "stream", Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}).Endpoint(srv.URL)
+
+	w.Write([]byte("a=1\n"))
+	w.Write([]byte("a=2\n"))
+	err := w.Flush()
+	w.Write([]byte("a=3\n"))
+	w.Close()
+
+	expected := "PutLogEvents: CreateLogGroup: CreateLogStream: PutLogEvents: PutLogEvents:expected PutLogEvents:next"
+	if err != nil || strings.Join(fake.calls, " ") != expected || fake.events != 3 {
+		t.Logf("expected calls %q got %q, %d events, error %v", expected, strings.Join(fake.calls, " "), fake.events, err)
+		t.Fail()
+	}
+}
+
+// Test of the retries of the throttled calls.
+func TestWriter_Throttling(t *testing.T) {
+	original := DefaultRetryInterval
+	DefaultRetryInterval = time.Millisecond
+	defer func() { DefaultRetryInterval = original }()
+	fake := &fakeLogs{errors: []string{"ThrottlingException", "ThrottlingException", "ThrottlingException"}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	w := New("eu-west-1", "group", "stream", Credentials{AccessKeyID: "AKID"}).Endpoint(srv.URL).Retries(1)
+
+	w.Write([]byte("a=1\n"))
+	failed := w.Flush()
+	retried := w.Flush()
+
+	if failed == nil || retried != nil || fake.events != 1 || len(fake.calls) != 4 {
+		t.Logf("unexpected results %v, %v, %d events, calls %q", failed, retried, fake.events, fake.calls)
+		t.Fail()
+	}
+	w.Close()
+}
+
+// Test the long record is truncated at the start of the rune.
+func TestWriter_TruncateRune(t *testing.T) {
+	srv := httptest.NewServer(&fakeLogs{})
+	defer srv.Close()
+	w := New("eu-west-1", "group", "stream", Credentials{AccessKeyID: "AKID"}).Endpoint(srv.URL)
+	record := strings.Repeat("a", MaxEventBytes-eventOverhead-1) + "\u00e9tail"
+
+	w.Write([]byte(record))
+
+	w.Lock()
+	message := w.pending[0].Message
+	w.Unlock()
+	if len(message) != MaxEventBytes-eventOverhead-1 || !utf8.ValidString(message) {
+		t.Logf("expected the valid message of %d bytes got %d bytes", MaxEventBytes-eventOverhead-1, len(message))
+		t.Fail()
+	}
+	w.Close()
+}
@@ -0,0 +1,134 @@
+package codec
+
+// Compression codecs for the sinks that ship the records in batches.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// Codec compresses the batches of the records. Each batch compressed
+// by a new writer so the batches could be decoded independently.
+type Codec interface {
+	// Name is the name of the codec like "gzip" that could be
+	// used as the content encoding.
+	Name() string
+	// NewWriter returns the writer that compresses the data to w.
+	// The data flushed to w on Close().
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// Standard library codecs. The codecs from the other packages (snappy,
+// zstd etc.) could be added by Register() with the adapter of a few
+// lines:
+//
+//	type zstdCodec struct{}
+//
+//	func (zstdCodec) Name() string { return "zstd" }
+//	func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+//		return zstd.NewWriter(w)
+//	}
+//
+//	codec.Register(zstdCodec{})
+var (
+	None    Codec = none{}
+	Gzip          = GzipLevel(gzip.DefaultCompression)
+	Deflate Codec = deflateCodec{flate.DefaultCompression}
+	Zlib    Codec = zlibCodec{zlib.DefaultCompression}
+)
+
+var (
+	codecs = map[string]Codec{
+		None.Name():    None,
+		Gzip.Name():    Gzip,
+		Deflate.Name(): Deflate,
+		Zlib.Name():    Zlib,
+	}
+	codecsLock sync.RWMutex
+)
+
+// Register adds the codec to the list of known codecs. It replaces
+// the codec with the same name.
+func Register(c Codec) {
+	codecsLock.Lock()
+	codecs[c.Name()] = c
+	codecsLock.Unlock()
+}
+
+// Get returns the codec by the name or nil if the codec is unknown.
+func Get(name string) Codec {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	return codecs[name]
+}
+
+// GzipLevel returns gzip codec with the compression level (from
+// gzip.BestSpeed to gzip.BestCompression).
+func GzipLevel(level int) Codec {
+	return gzipCodec{level}
+}
+
+type none struct{}
+
+func (none) Name() string { return "none" }
+func (none) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopCloser{w}, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+type gzipCodec struct{ level int }
+
+func (gzipCodec) Name() string { return "gzip" }
+func (c gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+type deflateCodec struct{ level int }
+
+func (deflateCodec) Name() string { return "deflate" }
+func (c deflateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, c.level)
+}
+
+type zlibCodec struct{ level int }
+
+func (zlibCodec) Name() string { return "zlib" }
+func (c zlibCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(w, c.level)
+}
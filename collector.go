@@ -0,0 +1,117 @@
+package kiwi
+
+// This file consists of the collector that owns the sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	stdcontext "context"
+	"sync"
+)
+
+// Collector owns the sinks and passes them the records of the
+// loggers. All the loggers and the sinks use DefaultCollector unless
+// other collector set. The separate collector isolates the pipeline
+// of the records so the tests and the libraries could have their own
+// sinks that not get the records of the application:
+//
+//	c := kiwi.NewCollector()
+//	out := c.SinkTo(buf, kiwi.AsLogfmt()).Start()
+//	log := kiwi.New().UseCollector(c)
+type Collector struct {
+	sync.RWMutex
+	sinks []*Sink
+	// nextID is the id of the next sink, the ids are never reused.
+	nextID uint
+	clock  Clock
+}
+
+// DefaultCollector owns the sinks created by SinkTo() and gets the
+// records of the global logger and of the loggers without their own
+// collector.
+var DefaultCollector = NewCollector()
+
+// NewCollector creates the collector without sinks.
+func NewCollector() *Collector {
+	return new(Collector)
+}
+
+// Flush writes the records queued by the sinks of the collector and
+// flushes their writers (see Flush()).
+func (c *Collector) Flush() {
+	var ctx, cancel = stdcontext.WithTimeout(stdcontext.Background(), flushTimeout)
+	for _, s := range c.Sinks() {
+		if s.flushWithin(ctx) != nil {
+			break
+		}
+	}
+	cancel()
+}
+
+// remove removes the sink from the collector. It reports whether the
+// sink was found.
+func (c *Collector) remove(s *Sink) bool {
+	c.Lock()
+	defer c.Unlock()
+	for i, sink := range c.sinks {
+		if sink == s {
+			c.sinks = append(c.sinks[:i:i], c.sinks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// UseCollector says the logger to pass its records to the sinks of
+// the collector instead of DefaultCollector. The loggers derived by
+// Fork(), Clone() and Prefix() inherit the collector. Nil collector
+// means DefaultCollector.
+func (l *Logger) UseCollector(c *Collector) *Logger {
+	l.collector = c
+	return l
+}
+
+// sinkRecord passes the record to the collector of the logger.
+func (l *Logger) sinkRecord(rec *record) {
+	if l.collector != nil {
+		l.collector.sinkRecord(rec)
+		return
+	}
+	DefaultCollector.sinkRecord(rec)
+}
+
+// flush flushes the sinks of the collector of the logger.
+func (l *Logger) flush() {
+	if l.collector != nil {
+		l.collector.Flush()
+		return
+	}
+	DefaultCollector.Flush()
+}
@@ -35,8 +35,17 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 import "fmt"
 
 // With defines a context for the logger. The context overrides pairs
-// in the record. The function is not concurrent safe.
+// in the record. Besides key-value pairs it accepts the functions
+// func() []*Pair (or func() []Pair) that generate the pairs. The
+// generators are called for each logged record so they could add the
+// values that change over the time (memory usage, queue length
+// etc.). They are called by the sinks and only when some sink passed
+// the record through the filters of other pairs. The function is not
+// concurrent safe.
 func (l *Logger) With(keyVals ...interface{}) *Logger {
+	if l.muted {
+		return l
+	}
 	var (
 		key       string
 		thisIsKey = true
@@ -52,7 +61,7 @@ next:
 			// Instead of the key the key-value pair could be
 			// passed. Next arg should be a key.
 			case *Pair:
-				p := arg.(*Pair)
+				p := l.prefixed(arg.(*Pair))
 				for i, c := range l.context {
 					if p.Key == c.Key {
 						l.context[i] = p
@@ -65,6 +74,7 @@ next:
 			// arg should be a key.
 			case []*Pair:
 				for _, p := range arg.([]*Pair) {
+					p = l.prefixed(p)
 					for i, c := range l.context {
 						if c.Key == p.Key {
 							l.context[i] = p
@@ -74,6 +84,11 @@ next:
 					l.context = append(l.context, p)
 				}
 				continue
+			// The generator of pairs evaluated by the sinks.
+			// Next arg should be a key.
+			case func() []*Pair, func() []Pair:
+				l.context = append(l.context, generatorPair(arg))
+				continue
 			// The key must be be a string type. The logger generates
 			// error as a new key-value pair for the record.
 			default:
@@ -81,15 +96,15 @@ next:
 				key = UnpairedKey
 			}
 		} else {
-			p := toPair(key, arg)
+			p := toPair(l.prefix+key, arg)
 			for i, c := range l.context {
-				if c.Key == key {
+				if c.Key == p.Key {
 					l.context[i] = p
 					thisIsKey = !thisIsKey
 					break next
 				}
 			}
-			l.context = append(l.context, toPair(key, arg))
+			l.context = append(l.context, p)
 		}
 		// After the key the next arg is not a key.
 		thisIsKey = !thisIsKey
@@ -100,10 +115,48 @@ next:
 	return l
 }
 
-// Without drops some keys from a context for the logger. The function
-// is not concurrent safe.
+// Clone creates a new logger with the context of the logger extended
+// by the pairs (see With()). Unlike With() it not changes the logger
+// itself so the base logger could be shared by all the goroutines of
+// the service and each of them derives its own logger:
+//
+//	var base = kiwi.Fork().With("service", "billing")
+//	...
+//	go func() {
+//		log := base.Clone("request", id)
+//		log.Log("msg", "started")
+//	}()
+//
+// The function is concurrent safe as long as nobody changes the base
+// logger with With(), Add() and other methods that modify it.
+func (l *Logger) Clone(keyVals ...interface{}) *Logger {
+	return l.Fork().With(keyVals...)
+}
+
+// generatorPair wraps the generator of the pairs to the pair that
+// keeps it in the context.
+func generatorPair(fn interface{}) *Pair {
+	if gen, ok := fn.(func() []Pair); ok {
+		fn = func() []*Pair {
+			var (
+				pairs = gen()
+				ptrs  = make([]*Pair, len(pairs))
+			)
+			for i := range pairs {
+				ptrs[i] = &pairs[i]
+			}
+			return ptrs
+		}
+	}
+	return &Pair{Eval: fn}
+}
+
+// Without drops some keys from a context for the logger. The keys are
+// prefixed the same way as in With() for the loggers created by
+// Prefix(). The function is not concurrent safe.
 func (l *Logger) Without(keys ...string) *Logger {
 	for _, k := range keys {
+		k = l.prefix + k
 		for i, v := range l.context {
 			if v.Key == k {
 				copy(l.context[i:], l.context[i+1:])
@@ -33,6 +33,7 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 */
 
 import (
+	stdcontext "context"
 	"testing"
 )
 
@@ -135,3 +136,22 @@ func TestLogger_ForkWithPartialContext(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Test of the logger passed through context.Context.
+func TestContext_LoggerInContext(t *testing.T) {
+	log := New().With("request-id", "42")
+	ctx := ToContext(stdcontext.Background(), log)
+
+	fromCtx := FromContext(ctx)
+	fromCtx.With("user", "admin")
+	other := New().With("request-id", "0", "handler", "users").WithContext(ctx)
+
+	if fromCtx.checkContext("request-id") != "42" || FromContext(ctx).checkContext("user") != "" {
+		t.Log("expected independent copy of the logger from the context")
+		t.Fail()
+	}
+	if other.checkContext("request-id") != "42" || other.checkContext("handler") != "users" {
+		t.Log("expected the context pairs added from the context")
+		t.Fail()
+	}
+}
@@ -34,8 +34,12 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 import (
 	"encoding"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -53,18 +57,101 @@ const (
 	StringVal
 	TimeVal
 	CustomQuoted
+	// VoidVal is the kind of nil values. The formatters output it
+	// as null where the format has a notion of null.
+	VoidVal
+	// ObjectVal is the kind of maps, slices, arrays and structs. The
+	// value is encoded as JSON for the formatters that write the
+	// objects (see ObjectFormatter). Other formatters get the value
+	// formatted by fmt with %+v verb as StringVal.
+	ObjectVal
 )
 
 // FloatFormat used in Float to String conversion.
 // It is second parameter passed to strconv.FormatFloat()
 var FloatFormat byte = 'e'
 
+// FloatPrecision used in Float to String conversion.
+// It is third parameter passed to strconv.FormatFloat(). Default -1
+// means the minimal number of digits necessary to represent the value
+// exactly.
+var FloatPrecision = -1
+
 // TimeLayout used in time.Time to String conversion.
 var TimeLayout = time.RFC3339
 
+// Modes of time.Duration to String conversion.
+const (
+	// DurationHuman renders the durations as time.Duration.String()
+	// does: "1m30.5s".
+	DurationHuman = iota
+	// DurationInteger renders the durations as integer number of
+	// nanoseconds.
+	DurationInteger
+	// DurationISO8601 renders the durations as ISO 8601 durations:
+	// "PT1M30.5S".
+	DurationISO8601
+	// DurationMillis renders the durations as the number of
+	// milliseconds with the fraction: "1250", "0.5".
+	DurationMillis
+)
+
+// DurationFormat used in time.Duration to String conversion.
+var DurationFormat = DurationHuman
+
+// Renderer converts the value of some type to its string
+// representation. It returns the string and the kind of the value
+// (StringVal, IntegerVal etc.) that hints formatters how to output
+// it.
+type Renderer func(val interface{}) (string, int)
+
+// renderers keeps map[reflect.Type]Renderer. The map is never changed
+// after storing, it replaced by a copy on each change so the readers
+// need no locks.
+var (
+	renderers     atomic.Value
+	renderersLock sync.Mutex
+)
+
+// RegisterRenderer sets the function that converts values of the
+// same type as the sample value. The renderers consulted before the
+// default conversion so they could override it for any type:
+//
+//	kiwi.RegisterRenderer(time.Time{}, func(v interface{}) (string, int) {
+//		return v.(time.Time).Format(time.Kitchen), kiwi.TimeVal
+//	})
+//
+// Nil renderer removes the renderer for the type.
+func RegisterRenderer(sample interface{}, fn Renderer) {
+	var typ = reflect.TypeOf(sample)
+	renderersLock.Lock()
+	var (
+		old, _ = renderers.Load().(map[reflect.Type]Renderer)
+		m      = make(map[reflect.Type]Renderer, len(old)+1)
+	)
+	for t, r := range old {
+		m[t] = r
+	}
+	if fn == nil {
+		delete(m, typ)
+	} else {
+		m[typ] = fn
+	}
+	renderers.Store(m)
+	renderersLock.Unlock()
+}
+
 // it applicable for all scalar types and for strings
 func toPair(key string, val interface{}) *Pair {
+	if m, _ := renderers.Load().(map[reflect.Type]Renderer); len(m) > 0 {
+		if fn, ok := m[reflect.TypeOf(val)]; ok {
+			str, kind := fn(val)
+			return &Pair{key, str, nil, kind}
+		}
+	}
 	switch val.(type) {
+	case nil:
+		return &Pair{key, "<nil>", nil, VoidVal}
 	case string:
 		return &Pair{key, val.(string), nil, StringVal}
 	case []byte:
@@ -95,15 +182,23 @@ func toPair(key string, val interface{}) *Pair {
 	case uint64:
 		return &Pair{key, strconv.FormatUint(val.(uint64), 10), nil, IntegerVal}
 	case float32:
-		return &Pair{key, strconv.FormatFloat(float64(val.(float32)), FloatFormat, -1, 32), nil, FloatVal}
+		return &Pair{key, strconv.FormatFloat(float64(val.(float32)), FloatFormat, FloatPrecision, 32), nil, FloatVal}
 	case float64:
-		return &Pair{key, strconv.FormatFloat(val.(float64), FloatFormat, -1, 64), nil, FloatVal}
+		return &Pair{key, strconv.FormatFloat(val.(float64), FloatFormat, FloatPrecision, 64), nil, FloatVal}
 	case complex64:
 		return &Pair{key, fmt.Sprintf("%f", val.(complex64)), nil, ComplexVal}
 	case complex128:
 		return &Pair{key, fmt.Sprintf("%f", val.(complex128)), nil, ComplexVal}
 	case time.Time:
 		return &Pair{key, val.(time.Time).Format(TimeLayout), nil, TimeVal}
+	case time.Duration:
+		var m = measure{n: int64(val.(time.Duration)), duration: true}
+		str, kind := m.render(DurationFormat)
+		return &Pair{key, str, m, kind}
+	case Bytes:
+		var m = measure{n: int64(val.(Bytes))}
+		str, kind := m.render(BytesFormat)
+		return &Pair{key, str, m, kind}
 	case Valuer:
 		var pairType = CustomUnquoted
 		if val.(Valuer).IsQuoted() {
@@ -120,8 +215,81 @@ func toPair(key string, val interface{}) *Pair {
 		return &Pair{key, string(data), nil, StringVal}
 	case func() string:
 		return &Pair{key, "", val.(func() string), StringVal}
+	case func() interface{}:
+		return &Pair{key, "", &lazyValue{fn: val.(func() interface{})}, StringVal}
 	default:
+		// The errors keep their formatting (with the stack traces
+		// for some error packages).
+		if _, ok := val.(error); !ok {
+			if p := objectPair(key, val); p != nil {
+				return p
+			}
+		}
 		// Worst case conversion that depends on reflection.
 		return &Pair{key, fmt.Sprintf("%+v", val), nil, StringVal}
 	}
 }
+
+// objectText keeps the value of ObjectVal pair formatted by fmt for
+// the formatters that don't write the objects.
+type objectText string
+
+// objectPair encodes the composite value as JSON. It returns nil for
+// the values of other kinds and for the values that can't be encoded.
+// The value formatted with %+v kept for other formatters.
+func objectPair(key string, val interface{}) *Pair {
+	var typ = reflect.TypeOf(val)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil
+		}
+		return &Pair{key, string(data), objectText(fmt.Sprintf("%+v", val)), ObjectVal}
+	}
+	return nil
+}
+
+// formatISO8601Duration formats the duration with hours, minutes and
+// fractional seconds. The days are not used because their length
+// depends on the calendar.
+func formatISO8601Duration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var buf = make([]byte, 0, 24)
+	// The minimal duration can't be negated so the unsigned value
+	// used.
+	var u = uint64(d)
+	if d < 0 {
+		buf = append(buf, '-')
+		u = -u
+	}
+	buf = append(buf, "PT"...)
+	if h := u / uint64(time.Hour); h > 0 {
+		buf = strconv.AppendUint(buf, h, 10)
+		buf = append(buf, 'H')
+		u -= h * uint64(time.Hour)
+	}
+	if m := u / uint64(time.Minute); m > 0 {
+		buf = strconv.AppendUint(buf, m, 10)
+		buf = append(buf, 'M')
+		u -= m * uint64(time.Minute)
+	}
+	if u > 0 {
+		buf = strconv.AppendUint(buf, u/uint64(time.Second), 10)
+		if frac := u % uint64(time.Second); frac > 0 {
+			var digits = strconv.AppendUint(nil, frac+uint64(time.Second), 10)[1:]
+			for digits[len(digits)-1] == '0' {
+				digits = digits[:len(digits)-1]
+			}
+			buf = append(buf, '.')
+			buf = append(buf, digits...)
+		}
+		buf = append(buf, 'S')
+	}
+	return string(buf)
+}
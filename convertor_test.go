@@ -42,6 +42,7 @@ These parts separated by empty lines in each test function.
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -310,3 +311,101 @@ func TestConvertor_LogValueWithoutKey(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Test of non default value of FloatPrecision global var.
+func TestConvertor_NonDefaultFloatPrecisionPass_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	originalFormat, originalPrecision := FloatFormat, FloatPrecision
+	FloatFormat, FloatPrecision = 'g', 3
+	out := SinkTo(output, AsLogfmt()).Start()
+
+	log.Log("key", 3.14159265)
+
+	out.Flush().Close()
+	if strings.TrimSpace(output.String()) != `key=3.14` {
+		println(output.String())
+		t.Fail()
+	}
+	FloatFormat, FloatPrecision = originalFormat, originalPrecision
+}
+
+type plainDecimal struct {
+	units int64
+	cents int64
+}
+
+// Test of the custom renderer registered for the type.
+func TestConvertor_RegisterRenderer_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	RegisterRenderer(plainDecimal{}, func(v interface{}) (string, int) {
+		d := v.(plainDecimal)
+		return fmt.Sprintf("%d.%02d", d.units, d.cents), FloatVal
+	})
+	defer RegisterRenderer(plainDecimal{}, nil)
+	out := SinkTo(output, AsLogfmt()).Start()
+
+	log.Log("price", plainDecimal{12, 5})
+
+	out.Flush().Close()
+	if strings.TrimSpace(output.String()) != `price=12.05` {
+		println(output.String())
+		t.Fail()
+	}
+}
+
+// Test of the durations rendered in ISO 8601 format.
+func TestConvertor_DurationISO8601_Logfmt(t *testing.T) {
+	original := DurationFormat
+	DurationFormat = DurationISO8601
+	cases := map[time.Duration]string{
+		0:                       "PT0S",
+		1500 * time.Millisecond: "PT1.5S",
+		time.Hour + 2*time.Minute + 3*time.Microsecond: "PT1H2M0.000003S",
+		-90 * time.Second: "-PT1M30S",
+		2 * time.Hour:     "PT2H",
+	}
+
+	var got = make(map[time.Duration]string)
+	for d := range cases {
+		got[d] = toPair("d", d).Val
+	}
+	integer := func() string { DurationFormat = DurationInteger; return toPair("d", time.Second).Val }()
+
+	DurationFormat = original
+	for d, expected := range cases {
+		if got[d] != expected {
+			t.Logf("expected %s for %d got %s", expected, d, got[d])
+			t.Fail()
+		}
+	}
+	if integer != "1000000000" {
+		t.Logf("expected nanoseconds got %s", integer)
+		t.Fail()
+	}
+}
+
+// Test of the sizes rendered with binary and decimal units.
+func TestConvertor_Bytes_Logfmt(t *testing.T) {
+	cases := map[Bytes][2]string{
+		512:          {"512B", "512B"},
+		4404019:      {"4.2MiB", "4.4MB"},
+		1024:         {"1KiB", "1kB"},
+		-3 * 1 << 30: {"-3GiB", "-3.2GB"},
+		1<<63 - 1:    {"8EiB", "9.2EB"},
+	}
+
+	var got = make(map[Bytes][2]string)
+	for b := range cases {
+		si, _ := measure{n: int64(b)}.render(BytesSI)
+		got[b] = [2]string{toPair("b", b).Val, si}
+	}
+
+	for b, expected := range cases {
+		if got[b] != expected {
+			t.Logf("expected %q for %d got %q", expected, b, got[b])
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package kiwi
+
+// This file consists of passing the loggers through context.Context.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+// The package has the global context variable so the standard
+// package imported under other name.
+import stdcontext "context"
+
+type ctxKey struct{}
+
+// ToContext returns the copy of the context that carries the logger.
+// The request scoped pairs (request id, trace id etc.) added to the
+// context of the logger ride along with the context through the
+// middleware and the handlers:
+//
+//	ctx = kiwi.ToContext(ctx, log.Fork().With("request-id", id))
+//	...
+//	kiwi.FromContext(ctx).Log("msg", "user found")
+//	// request-id="42" msg="user found"
+func ToContext(ctx stdcontext.Context, l *Logger) stdcontext.Context {
+	return stdcontext.WithValue(ctx, ctxKey{}, l.Fork())
+}
+
+// FromContext returns the new instance of the logger carried by the
+// context (see Logger.Fork()). So the returned logger could be
+// changed without affecting the others. When the context has no
+// logger the instance forked from the global logger is returned.
+func FromContext(ctx stdcontext.Context) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+		return l.Fork()
+	}
+	return Fork()
+}
+
+// WithContext adds the context pairs of the logger carried by the
+// context to the context of the logger. The pairs replace the pairs
+// with the same keys. It does nothing if the context has no logger.
+func (l *Logger) WithContext(ctx stdcontext.Context) *Logger {
+	if l.muted {
+		return l
+	}
+	carried, ok := ctx.Value(ctxKey{}).(*Logger)
+	if !ok {
+		return l
+	}
+next:
+	for _, p := range carried.context {
+		// The pairs with the same keys are replaced like With()
+		// does.
+		for i, c := range l.context {
+			if p.Key == c.Key {
+				l.context[i] = p
+				continue next
+			}
+		}
+		l.context = append(l.context, p)
+	}
+	return l
+}
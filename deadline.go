@@ -0,0 +1,133 @@
+package kiwi
+
+// This file consists of the delivery deadline of the sink writes.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type writeDeadline struct {
+	timeout time.Duration
+	// busy set while the write to the output is in progress
+	busy int32
+}
+
+// WriteTimeout sets the deadline for writing a single record to the
+// output of the sink. When the writer is wedged (full pipe, dead
+// network mount etc.) and the record is not written in time it is
+// counted as failed (see Stats()) and the sink marked unhealthy (see
+// Healthy()). The next records are failed immediately until the
+// wedged write returns so the sink does not block the loggers. Zero
+// timeout disables the deadline.
+func (s *Sink) WriteTimeout(timeout time.Duration) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		if timeout <= 0 {
+			s.deadline.Store((*writeDeadline)(nil))
+		} else {
+			s.deadline.Store(&writeDeadline{timeout: timeout})
+		}
+	}
+	return s
+}
+
+// Healthy reports whether the last write to the output of the sink
+// was finished in time and without errors.
+func (s *Sink) Healthy() bool {
+	return atomic.LoadInt32(&s.unhealthy) == 0
+}
+
+// write writes the line to the output of the sink or adds it to the
+// batch (see Batch()).
+func (s *Sink) write(line []byte) {
+	atomic.StoreInt64(&s.lastWrite, time.Now().UnixNano())
+	if b, _ := s.batch.Load().(*writeBatch); b != nil {
+		b.add(s, line)
+		return
+	}
+	s.writeOut(line)
+}
+
+// writeOut writes to the output of the sink within the deadline.
+func (s *Sink) writeOut(line []byte) {
+	var d, _ = s.deadline.Load().(*writeDeadline)
+	if d == nil {
+		var start = time.Now()
+		var err = s.writeRetrying(line)
+		s.stats.latency.observe(time.Since(start))
+		if err != nil {
+			s.fail(err, line)
+			return
+		}
+		atomic.AddUint64(&s.stats.written, 1)
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&d.busy, 0, 1) {
+		// The previous write still not returned.
+		s.fail(ErrWriteTimeout, line)
+		return
+	}
+	// The line is copied because the formatter reuses its buffer
+	// and the write may outlive the deadline.
+	var (
+		buf  = append([]byte(nil), line...)
+		done = make(chan error, 1)
+	)
+	go func() {
+		var start = time.Now()
+		var err = s.writeRetrying(buf)
+		s.stats.latency.observe(time.Since(start))
+		atomic.StoreInt32(&d.busy, 0)
+		if err == nil {
+			atomic.AddUint64(&s.stats.written, 1)
+			atomic.StoreInt32(&s.unhealthy, 0)
+		}
+		done <- err
+	}()
+	var timer = time.NewTimer(d.timeout)
+	select {
+	case err := <-done:
+		if err != nil {
+			s.fail(err, buf)
+		}
+	case <-timer.C:
+		s.fail(ErrWriteTimeout, buf)
+	}
+	timer.Stop()
+}
+
+func (s *Sink) fail(err error, line []byte) {
+	atomic.AddUint64(&s.stats.failed, 1)
+	atomic.StoreInt32(&s.unhealthy, 1)
+	s.reportError(err, line)
+}
@@ -0,0 +1,218 @@
+package kiwi
+
+// Suppression of the repeated records.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DedupCountKey is the key of the number of the suppressed records in
+// the summary record written by DedupWindow().
+var DedupCountKey = "repeated"
+
+type dedup struct {
+	window time.Duration
+	keys   []string
+	stop   chan struct{}
+
+	sync.Mutex
+	seen map[string]*dedupEntry
+}
+
+type dedupEntry struct {
+	first time.Time
+	count int
+	pairs []*Pair
+}
+
+// DedupWindow suppresses the records identical to the record written
+// less than the window ago. The records compared by the values of the
+// keys or by all the pairs when the keys are not set. When the window
+// is over the sink writes the summary record: the pairs of the first
+// record with the number of the suppressed ones under DedupCountKey:
+//
+//	sink.DedupWindow(time.Minute, "msg")
+//	// msg="connection refused" host="db1"
+//	// msg="connection refused" host="db1" repeated=240
+//
+// The records without the keys are not suppressed. Zero window
+// disables the suppression.
+func (s *Sink) DedupWindow(window time.Duration, keys ...string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if s.dedup != nil {
+			close(s.dedup.stop)
+			s.dedup = nil
+		}
+		if window > 0 {
+			s.dedup = &dedup{
+				window: window,
+				keys:   keys,
+				stop:   make(chan struct{}),
+				seen:   make(map[string]*dedupEntry),
+			}
+			go s.dedupSummaries(s.dedup)
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// suppress reports whether the record repeats the record seen in the
+// window. It returns the summary of the previous window when it is
+// over. It is called by the goroutine of the sink.
+func (d *dedup) suppress(record []*Pair, now time.Time) (bool, []*Pair) {
+	var sig, ok = d.signature(record)
+	if !ok {
+		return false, nil
+	}
+	d.Lock()
+	defer d.Unlock()
+	var e = d.seen[sig]
+	if e != nil && now.Sub(e.first) < d.window {
+		e.count++
+		return true, nil
+	}
+	var summary []*Pair
+	if e != nil {
+		summary = e.summary()
+	}
+	d.seen[sig] = &dedupEntry{first: now, pairs: copyPairs(record)}
+	return false, summary
+}
+
+// expired removes the entries of the windows that are over and
+// returns the summaries of the suppressed records.
+func (d *dedup) expired(now time.Time) [][]*Pair {
+	var summaries [][]*Pair
+	d.Lock()
+	for sig, e := range d.seen {
+		if now.Sub(e.first) < d.window {
+			continue
+		}
+		if summary := e.summary(); summary != nil {
+			summaries = append(summaries, summary)
+		}
+		delete(d.seen, sig)
+	}
+	d.Unlock()
+	return summaries
+}
+
+// signature joins the values of the keys of the record.
+func (d *dedup) signature(record []*Pair) (string, bool) {
+	var sig strings.Builder
+	if len(d.keys) == 0 {
+		for _, p := range record {
+			sig.WriteString(p.Key)
+			sig.WriteByte(0)
+			sig.WriteString(p.Val)
+			sig.WriteByte(0)
+		}
+		return sig.String(), true
+	}
+	var found bool
+	for _, key := range d.keys {
+		for _, p := range record {
+			if p.Key == key {
+				found = true
+				sig.WriteString(p.Val)
+				break
+			}
+		}
+		sig.WriteByte(0)
+	}
+	return sig.String(), found
+}
+
+// summary returns the summary record or nil if nothing suppressed.
+func (e *dedupEntry) summary() []*Pair {
+	if e.count == 0 {
+		return nil
+	}
+	return append(e.pairs, toPair(DedupCountKey, e.count))
+}
+
+// copyPairs copies the pairs because the records are recycled.
+func copyPairs(record []*Pair) []*Pair {
+	var (
+		values = make([]Pair, len(record))
+		pairs  = make([]*Pair, len(record), len(record)+1)
+	)
+	for i, p := range record {
+		values[i] = Pair{p.Key, p.Val, nil, p.Type}
+		pairs[i] = &values[i]
+	}
+	return pairs
+}
+
+// dedupSummaries passes the summaries of the windows that are over to
+// the sink queue.
+func (s *Sink) dedupSummaries(d *dedup) {
+	var ticker = time.NewTicker(d.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+		var state = atomic.LoadInt32(s.state)
+		if state == sinkClosed {
+			return
+		}
+		for _, summary := range d.expired(s.collector.now()) {
+			if state == sinkActive {
+				s.inject(summary)
+			}
+		}
+	}
+}
+
+// inject passes the record to the sink bypassing the filters and
+// waits until it is written.
+func (s *Sink) inject(pairs []*Pair) {
+	var rec = newRecord(len(pairs))
+	rec.pairs = append(rec.pairs, pairs...)
+	rec.hold()
+	select {
+	case s.In <- chain{rec: rec, heartbeat: true}:
+	case <-s.exited:
+		// The sink closed meanwhile.
+		rec.processed()
+	}
+	rec.wait(flushTimeout)
+}
@@ -0,0 +1,89 @@
+package kiwi
+
+// This file consists of helpers for logging on function exit.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import "time"
+
+// Keys of the pairs added by LogDeferred().
+var (
+	ElapsedKey  = "elapsed"
+	PanickedKey = "panicked"
+)
+
+// LogDeferred returns the function that logs the record with the
+// key-value pairs when it called. The record includes the time elapsed
+// since LogDeferred() call and the flag whether the function exits
+// by the panic. The returned function should be called directly by
+// defer:
+//
+//	defer log.LogDeferred("msg", "handler done", "path", path)()
+//	// msg="handler done" path="/" elapsed="1.2ms" panicked=false
+//
+// The lone trailing value is logged as the message (see MessageKey).
+// The *Pair arguments are not counted as the keys or the values:
+//
+//	defer log.LogDeferred("handler done")()
+//	// msg="handler done" elapsed="1.2ms" panicked=false
+//
+// The panic is recovered for checking and then raised again with the
+// same value.
+func (l *Logger) LogDeferred(keyVals ...interface{}) func() {
+	var start = time.Now()
+	// Copy the pairs so the caller's slice is not changed by append.
+	var pairs = make([]interface{}, len(keyVals), len(keyVals)+5)
+	copy(pairs, keyVals)
+	if loneValue(pairs) {
+		pairs = append(pairs[:len(pairs)-1], MessageKey, pairs[len(pairs)-1])
+	}
+	return func() {
+		var r = recover()
+		l.Log(append(pairs, ElapsedKey, time.Since(start), PanickedKey, r != nil)...)
+		if r != nil {
+			panic(r)
+		}
+	}
+}
+
+// loneValue reports whether the last argument has no pair the same way
+// as Log() parses the arguments: *Pair in place of the key is taken as
+// the whole pair.
+func loneValue(keyVals []interface{}) bool {
+	var shouldBeAKey = true
+	for _, val := range keyVals {
+		if _, ok := val.(*Pair); ok && shouldBeAKey {
+			continue
+		}
+		shouldBeAKey = !shouldBeAKey
+	}
+	return !shouldBeAKey
+}
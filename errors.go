@@ -0,0 +1,129 @@
+package kiwi
+
+// This file consists of helpers for logging of errors.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrKey is the key for errors added by Err().
+	ErrKey = "error"
+	// StackKey is the key for the stack trace added by Err().
+	StackKey = "stack"
+	// ErrStackDepth sets how many frames of the stack trace Err()
+	// adds to the record. The stack is not captured when it is 0
+	// (default).
+	ErrStackDepth = 0
+)
+
+// multiError is realized by the errors created with errors.Join()
+// and by other errors that keep several errors inside.
+type multiError interface {
+	Unwrap() []error
+}
+
+// Err adds the error to the log record under ErrKey. Nil error is
+// ignored. If ErrStackDepth is set then the stack trace of the caller
+// added under StackKey. The errors that combine several errors (created with
+// errors.Join() for example or any other errors that have Unwrap()
+// []error method) expanded to indexed pairs:
+//
+//	log.Err(errors.Join(errA, errB)).Log()
+//	// error.0="a failed" error.1="b failed"
+func (l *Logger) Err(err error) *Logger {
+	if err == nil || l.muted {
+		return l
+	}
+	for _, p := range errorPairs(ErrKey, err) {
+		l.Add(p)
+	}
+	if ErrStackDepth > 0 {
+		l.Add(stackPair(ErrStackDepth))
+	}
+	return l
+}
+
+// stackPair captures the stack of the caller. Only the program
+// counters captured immediately. The frames are resolved and
+// formatted lazily (see Pair.value()) only when the record is written
+// by a sink. The frames of kiwi itself are skipped.
+func stackPair(depth int) *Pair {
+	// Reserve some space for kiwi frames that will be skipped.
+	var pcs = make([]uintptr, depth+8)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+	return &Pair{Key: StackKey, Eval: &lazyValue{fn: func() interface{} {
+		return renderStack(pcs, depth)
+	}}, Type: StringVal}
+}
+
+// renderStack formats the frames of the stack. It is replaced in the
+// tests.
+var renderStack = formatStack
+
+// formatStack formats no more than depth frames of the stack.
+func formatStack(pcs []uintptr, depth int) string {
+	var (
+		frames = runtime.CallersFrames(pcs)
+		trace  []string
+	)
+	for len(trace) < depth {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/grafov/kiwi.") || strings.HasSuffix(frame.File, "_test.go") {
+			trace = append(trace, frame.Function+"("+filepath.Base(frame.File)+":"+strconv.Itoa(frame.Line)+")")
+		}
+		if !more {
+			break
+		}
+	}
+	return strings.Join(trace, " ")
+}
+
+// errorPairs converts the error to pairs. The multi-errors are
+// expanded recursively so the nested errors get the keys like
+// "error.1.0".
+func errorPairs(key string, err error) []*Pair {
+	if m, ok := err.(multiError); ok {
+		var pairs []*Pair
+		for i, e := range m.Unwrap() {
+			if e != nil {
+				pairs = append(pairs, errorPairs(key+"."+strconv.Itoa(i), e)...)
+			}
+		}
+		return pairs
+	}
+	return []*Pair{{key, err.Error(), nil, StringVal}}
+}
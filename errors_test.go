@@ -0,0 +1,133 @@
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type joinedErrors []error
+
+func (e joinedErrors) Error() string   { return "joined" }
+func (e joinedErrors) Unwrap() []error { return e }
+
+// Test logging of the single error.
+func TestLogger_Err_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	log.Err(errors.New("failed")).Err(nil).Log()
+
+	out.Flush()
+	expected := `error="failed"`
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test logging of the error that consists of several errors.
+func TestLogger_ErrMulti_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	log.Err(joinedErrors{errors.New("a"), joinedErrors{errors.New("b"), errors.New("c")}}).Log()
+
+	out.Flush()
+	expected := `error.0="a" error.1.0="b" error.1.1="c"`
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test that the stack trace added for the error.
+func TestLogger_ErrStack_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	ErrStackDepth = 1
+	defer func() { ErrStackDepth = 0 }()
+
+	log.Err(errors.New("failed")).Log()
+
+	out.Flush()
+	expected := `error="failed" stack="github.com/grafov/kiwi.TestLogger_ErrStack_Logfmt(errors_test.go:`
+	if !strings.HasPrefix(output.String(), expected) {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test that the stack trace is not rendered for the records rejected
+// by the sinks.
+func TestLogger_ErrStackFiltered_Logfmt(t *testing.T) {
+	c := NewCollector()
+	output := bytes.NewBufferString("")
+	out := c.SinkTo(output, AsLogfmt()).HasNotValue("error", "filtered").Start()
+	defer out.Close()
+	log := New().UseCollector(c)
+	ErrStackDepth = 1
+	var rendered int
+	renderStack = func(pcs []uintptr, depth int) string {
+		rendered++
+		return formatStack(pcs, depth)
+	}
+	defer func() { ErrStackDepth, renderStack = 0, formatStack }()
+
+	log.Err(errors.New("filtered")).Log()
+	log.Err(errors.New("written")).Log()
+
+	out.Flush()
+	if rendered != 1 || !strings.Contains(output.String(), `error="written" stack="github.com/grafov/kiwi.TestLogger_ErrStackFiltered_Logfmt(`) ||
+		strings.Contains(output.String(), "filtered") {
+		t.Logf("expected the stack rendered once for the written record got %d renders and %q", rendered, output.String())
+		t.Fail()
+	}
+}
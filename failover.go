@@ -0,0 +1,171 @@
+package kiwi
+
+// This file consists of the writer that fails over to the fallback output.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Defaults for the failover writer. They may be changed per writer
+// with Failures() and ProbeInterval() methods.
+var (
+	DefaultFailures      = 3
+	DefaultProbeInterval = 10 * time.Second
+)
+
+// FailoverKey is the key of the records logged when the failover
+// writer switches between the outputs. Its value is "fallback" or
+// "primary".
+var FailoverKey = "kiwi-failover"
+
+// FailoverWriter writes to the primary writer until it fails then
+// switches to the fallback writer. See MultiWriter().
+type FailoverWriter struct {
+	sync.Mutex
+	primary  io.Writer
+	fallback io.Writer
+	failures int
+	probe    time.Duration
+	failed   int
+	degraded bool
+	probed   time.Time
+}
+
+// MultiWriter creates the writer for the sink that writes to the
+// primary writer. When the primary writer returns errors for
+// Failures() consecutive writes the writer switches to the fallback
+// writer (a local file for example). The writer probes the primary
+// writer with the next record each ProbeInterval() and switches back
+// on success:
+//
+//	w := kiwi.MultiWriter(conn, backupFile)
+//	kiwi.SinkTo(w, kiwi.AsJSON()).Start()
+//
+// The writer logs the record with FailoverKey on each switch. The
+// records failed on the primary writer are written to the fallback
+// writer so they are not lost.
+func MultiWriter(primary, fallback io.Writer) *FailoverWriter {
+	return &FailoverWriter{
+		primary:  primary,
+		fallback: fallback,
+		failures: DefaultFailures,
+		probe:    DefaultProbeInterval,
+	}
+}
+
+// Failures sets the number of the consecutive errors of the primary
+// writer that cause the failover.
+func (w *FailoverWriter) Failures(n int) *FailoverWriter {
+	if n > 0 {
+		w.Lock()
+		w.failures = n
+		w.Unlock()
+	}
+	return w
+}
+
+// ProbeInterval sets how often the primary writer is probed after
+// the failover.
+func (w *FailoverWriter) ProbeInterval(d time.Duration) *FailoverWriter {
+	if d > 0 {
+		w.Lock()
+		w.probe = d
+		w.Unlock()
+	}
+	return w
+}
+
+// Degraded reports whether the writer writes to the fallback writer.
+func (w *FailoverWriter) Degraded() bool {
+	w.Lock()
+	defer w.Unlock()
+	return w.degraded
+}
+
+// Write writes the record to the current output.
+func (w *FailoverWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.degraded {
+		if time.Since(w.probed) < w.probe {
+			return w.fallback.Write(p)
+		}
+		w.probed = time.Now()
+		if _, err := w.primary.Write(p); err != nil {
+			return w.fallback.Write(p)
+		}
+		w.degraded = false
+		w.failed = 0
+		w.notify("primary", nil)
+		return len(p), nil
+	}
+	n, err := w.primary.Write(p)
+	if err == nil {
+		w.failed = 0
+		return n, nil
+	}
+	if w.failed++; w.failed >= w.failures {
+		w.degraded = true
+		w.probed = time.Now()
+		w.notify("fallback", err)
+	}
+	// The failed record is not lost.
+	return w.fallback.Write(p)
+}
+
+// Flush flushes both the writers if they are Flushers.
+func (w *FailoverWriter) Flush() error {
+	w.Lock()
+	defer w.Unlock()
+	var err error
+	for _, out := range []io.Writer{w.primary, w.fallback} {
+		if f, ok := out.(Flusher); ok {
+			if e := f.Flush(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// notify logs the switch. The record is logged from the separate
+// goroutine because the sink that writes to this writer is busy.
+func (w *FailoverWriter) notify(output string, err error) {
+	var keyVals = []interface{}{FailoverKey, output}
+	if err != nil {
+		keyVals = append(keyVals, ErrorKey, err.Error())
+	}
+	go Log(keyVals...)
+}
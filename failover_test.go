@@ -0,0 +1,96 @@
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// switchedWriter fails while it is broken.
+type switchedWriter struct {
+	bytes.Buffer
+	broken bool
+}
+
+func (w *switchedWriter) Write(p []byte) (int, error) {
+	if w.broken {
+		return brokenWriter{}.Write(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+// Test of the failover to the fallback writer and the recovery.
+func TestMultiWriter_Failover(t *testing.T) {
+	primary := &switchedWriter{broken: true}
+	fallback := new(bytes.Buffer)
+	w := MultiWriter(primary, fallback).Failures(2).ProbeInterval(time.Millisecond)
+	notes := new(lockedBuffer)
+	out := SinkTo(notes, AsLogfmt()).HasKey(FailoverKey).Start()
+
+	w.Write([]byte("1\n"))
+	degradedAfterFirst := w.Degraded()
+	w.Write([]byte("2\n"))
+	degradedAfterSecond := w.Degraded()
+	primary.broken = false
+	w.Write([]byte("3\n"))
+	time.Sleep(2 * time.Millisecond)
+	w.Write([]byte("4\n"))
+	for i := 0; i < 100 && !strings.Contains(notes.String(), "primary"); i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	out.Close()
+	if degradedAfterFirst || !degradedAfterSecond || w.Degraded() {
+		t.Logf("unexpected states %v, %v, %v", degradedAfterFirst, degradedAfterSecond, w.Degraded())
+		t.Fail()
+	}
+	if fallback.String() != "1\n2\n3\n" || primary.String() != "4\n" {
+		t.Logf("unexpected outputs %q and %q", fallback.String(), primary.String())
+		t.Fail()
+	}
+	if expected := "kiwi-failover=\"fallback\" kiwi-error=\"broken pipe\" \nkiwi-failover=\"primary\" \n"; notes.String() != expected {
+		t.Logf("expected %q got %q", expected, notes.String())
+		t.Fail()
+	}
+}
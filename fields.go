@@ -0,0 +1,71 @@
+package kiwi
+
+// This file consists of the helpers for the fields passed as maps.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import "sort"
+
+// Fields are the key-value pairs passed as a map.
+type Fields = map[string]interface{}
+
+// WithFields adds the fields to the context of the logger (see
+// With()). It eases migration from the loggers with the map based
+// API:
+//
+//	log.WithFields(kiwi.Fields{"user": id, "addr": addr}).Log("msg", "logged in")
+//	// addr="10.0.0.1" user=42 msg="logged in"
+//
+// The map has no order so the fields are added in the order of the
+// keys.
+func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
+	return l.With(fieldsKeyVals(fields)...)
+}
+
+// LogFields logs the record with the fields (see Log()). The fields
+// are logged in the order of the keys.
+func (l *Logger) LogFields(fields map[string]interface{}) {
+	l.Log(fieldsKeyVals(fields)...)
+}
+
+// fieldsKeyVals returns the fields as key-value pairs sorted by the
+// keys.
+func fieldsKeyVals(fields map[string]interface{}) []interface{} {
+	var keys = make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var keyVals = make([]interface{}, 0, len(fields)*2)
+	for _, key := range keys {
+		keyVals = append(keyVals, key, fields[key])
+	}
+	return keyVals
+}
@@ -33,7 +33,10 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 ॐ तारे तुत्तारे तुरे स्व */
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -52,19 +55,28 @@ func (*keyFilter) Check(key, val string) bool {
 	return true
 }
 
+func (*keyFilter) String() string {
+	return "has key"
+}
+
 type valsFilter struct {
 	Vals []string
+	Fold bool
 }
 
 func (f *valsFilter) Check(key, val string) bool {
 	for _, v := range f.Vals {
-		if v == val {
+		if v == val || f.Fold && strings.EqualFold(v, val) {
 			return true
 		}
 	}
 	return false
 }
 
+func (f *valsFilter) String() string {
+	return fmt.Sprintf("value in %q", f.Vals)
+}
+
 type int64RangeFilter struct {
 	From, To int64
 }
@@ -80,6 +92,10 @@ func (f *int64RangeFilter) Check(key, val string) bool {
 	return intVal > f.From && intVal <= f.To
 }
 
+func (f *int64RangeFilter) String() string {
+	return fmt.Sprintf("int in (%d, %d]", f.From, f.To)
+}
+
 type float64RangeFilter struct {
 	From, To float64
 }
@@ -95,6 +111,10 @@ func (f *float64RangeFilter) Check(key, val string) bool {
 	return floatVal > f.From && floatVal <= f.To
 }
 
+func (f *float64RangeFilter) String() string {
+	return fmt.Sprintf("float in (%g, %g]", f.From, f.To)
+}
+
 type timeRangeFilter struct {
 	From, To time.Time
 }
@@ -112,3 +132,19 @@ func (f *timeRangeFilter) Check(key, val string) bool {
 	}
 	return false
 }
+
+func (f *timeRangeFilter) String() string {
+	return fmt.Sprintf("time in (%s, %s)", f.From.Format(TimeLayout), f.To.Format(TimeLayout))
+}
+
+type regexpFilter struct {
+	Re *regexp.Regexp
+}
+
+func (f *regexpFilter) Check(key, val string) bool {
+	return f.Re.MatchString(val)
+}
+
+func (f *regexpFilter) String() string {
+	return "value matches " + f.Re.String()
+}
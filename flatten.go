@@ -0,0 +1,157 @@
+package kiwi
+
+// This file consists of the flattening of the object values.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Flatten splits the object values (maps and structs) to the pairs
+// with the keys joined by PrefixSeparator instead of the output of
+// the objects as JSON strings. The objects nested deeper than depth
+// levels are output as JSON strings:
+//
+//	log.Log("req", map[string]interface{}{"method": "GET", "path": "/x"})
+//	// req.method="GET" req.path="/x"
+//
+// Zero depth turns off the flattening.
+func (f *formatLogfmt) Flatten(depth int) *formatLogfmt {
+	f.flatten = depth
+	return f
+}
+
+// MaxDepth limits the depth of the nested object values. The objects
+// nested deeper are output as JSON strings. Zero depth means no limit.
+func (f *formatJSON) MaxDepth(depth int) *formatJSON {
+	f.maxDepth = depth
+	return f
+}
+
+// flattenObject calls fn for each member of the JSON object with the
+// key prefixed by the key of the object. It returns false if the value
+// is not the object.
+func flattenObject(key, data string, depth int, fn func(key, val string, valType int)) bool {
+	if depth <= 0 || !strings.HasPrefix(data, "{") {
+		return false
+	}
+	var d = json.NewDecoder(strings.NewReader(data))
+	d.UseNumber()
+	if _, err := d.Token(); err != nil {
+		return false
+	}
+	for d.More() {
+		name, err := d.Token()
+		if err != nil {
+			return true
+		}
+		var raw json.RawMessage
+		if err = d.Decode(&raw); err != nil {
+			return true
+		}
+		var member = key + PrefixSeparator + name.(string)
+		if !flattenObject(member, string(raw), depth-1, fn) {
+			val, valType := jsonScalar(raw)
+			fn(member, val, valType)
+		}
+	}
+	return true
+}
+
+// jsonScalar returns the value of the JSON value and its kind. The
+// arrays and the objects are returned as is.
+func jsonScalar(raw json.RawMessage) (string, int) {
+	switch {
+	case len(raw) == 0:
+		return "", StringVal
+	case raw[0] == '"':
+		var s string
+		json.Unmarshal(raw, &s)
+		return s, StringVal
+	case raw[0] == '{' || raw[0] == '[':
+		return string(raw), ObjectVal
+	case string(raw) == "true" || string(raw) == "false":
+		return string(raw), BooleanVal
+	case string(raw) == "null":
+		return "<nil>", VoidVal
+	case bytes.ContainsAny(raw, ".eE"):
+		return string(raw), FloatVal
+	}
+	return string(raw), IntegerVal
+}
+
+// writeTruncatedJSON writes the JSON value with the objects and the
+// arrays nested deeper than the depth replaced by their JSON strings.
+func writeTruncatedJSON(buf *bytes.Buffer, raw json.RawMessage, depth int) {
+	if len(raw) == 0 || raw[0] != '{' && raw[0] != '[' {
+		buf.Write(raw)
+		return
+	}
+	if depth <= 0 {
+		writeJSONString(buf, string(raw))
+		return
+	}
+	var d = json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	tok, err := d.Token()
+	if err != nil {
+		buf.Write(raw)
+		return
+	}
+	var object = tok == json.Delim('{')
+	buf.WriteByte(raw[0])
+	for i := 0; d.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if object {
+			name, err := d.Token()
+			if err != nil {
+				break
+			}
+			writeJSONString(buf, name.(string))
+			buf.WriteByte(':')
+		}
+		var member json.RawMessage
+		if err = d.Decode(&member); err != nil {
+			break
+		}
+		writeTruncatedJSON(buf, member, depth-1)
+	}
+	if object {
+		buf.WriteByte('}')
+	} else {
+		buf.WriteByte(']')
+	}
+}
@@ -0,0 +1,138 @@
+package kiwi
+
+// Flushing of the sinks and the graceful shutdown.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+// The package has the global context variable so the standard
+// package imported under other name.
+import (
+	stdcontext "context"
+	"sync/atomic"
+)
+
+// Flusher is implemented by the writers that buffer the output
+// (bufio.Writer, the writers of netsink and rotate packages etc.).
+// Flush() of the sink flushes them after writing the queued records.
+type Flusher interface {
+	Flush() error
+}
+
+// Flush writes the records queued by all the sinks and flushes their
+// writers. It waits no longer than three seconds.
+func Flush() {
+	var ctx, cancel = stdcontext.WithTimeout(stdcontext.Background(), flushTimeout)
+	flushAll(ctx)
+	cancel()
+}
+
+// Flush writes the records queued by the sink and flushes its writer
+// if it implements Flusher. It waits no longer than three seconds.
+func (s *Sink) Flush() *Sink {
+	var ctx, cancel = stdcontext.WithTimeout(stdcontext.Background(), flushTimeout)
+	s.flushWithin(ctx)
+	cancel()
+	return s
+}
+
+// Shutdown flushes all the sinks (see Flush()) and closes them (see
+// CloseAll()). The context limits the time of flushing, the sinks
+// are closed anyway. It returns the error of the context if not all
+// the records were flushed in time. It is intended to be called
+// before the exit of the program:
+//
+//	<-signals
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	kiwi.Shutdown(ctx)
+func Shutdown(ctx stdcontext.Context) error {
+	var err = flushAll(ctx)
+	CloseAll()
+	return err
+}
+
+// flushAll flushes the sinks one by one until the context done.
+func flushAll(ctx stdcontext.Context) error {
+	for _, s := range Sinks() {
+		if err := s.flushWithin(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushWithin asks the goroutine of the sink to flush and waits
+// until it done.
+func (s *Sink) flushWithin(ctx stdcontext.Context) error {
+	if atomic.LoadInt32(s.state) <= sinkClosed {
+		return nil
+	}
+	var done = make(chan struct{})
+	select {
+	case s.flushRequest <- done:
+	case <-s.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush processes all the queued records and flushes the writer of
+// the sink. It is called by the goroutine of the sink.
+func (s *Sink) flush(batch []chain) []chain {
+	// Only the goroutine of the sink reads the channel.
+	for len(s.In) > 0 {
+		s.processPriority()
+		s.processRecord(<-s.In)
+	}
+	s.processPriority()
+	batch = s.drainRing(batch)
+	if q, _ := s.async.Load().(*asyncQueue); q != nil {
+		s.drainAsync(q)
+	}
+	if b, _ := s.batch.Load().(*writeBatch); b != nil {
+		b.flush(s)
+	}
+	s.RLock()
+	if f, ok := s.writer.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			s.reportError(err, nil)
+		}
+	}
+	s.RUnlock()
+	return batch
+}
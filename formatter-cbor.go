@@ -0,0 +1,198 @@
+package kiwi
+
+// This file consists of the formatter for CBOR binary format.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// Major types of CBOR data items.
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+)
+
+type formatCBOR struct {
+	body  []byte
+	line  []byte
+	count int
+}
+
+// UseCBOR says that a sink uses CBOR (RFC-8949) binary format. Each
+// record is encoded as the map so the output is CBOR sequence
+// (RFC-8742) that could be read record by record without additional
+// framing. The numbers, booleans and nils are encoded natively, the
+// times as epoch based date/time (tag 1) and the objects as nested
+// maps and arrays. It is compact format for the constrained links of
+// IoT and edge agents:
+//
+//	kiwi.SinkTo(conn, kiwi.UseCBOR()).Start()
+func UseCBOR() *formatCBOR {
+	return &formatCBOR{
+		body: make([]byte, 0, 256),
+		line: make([]byte, 0, 256),
+	}
+}
+
+func (f *formatCBOR) Begin() {
+	f.body = f.body[:0]
+	f.count = 0
+}
+
+func (f *formatCBOR) Pair(key, val string, valType int) {
+	f.TypedPair(key, TypedValue(val, valType), valType)
+}
+
+func (f *formatCBOR) TypedPair(key string, val interface{}, valType int) {
+	f.body = appendCBORHead(f.body, cborText, uint64(len(key)))
+	f.body = append(f.body, key...)
+	f.body = appendCBOR(f.body, val)
+	f.count++
+}
+
+func (f *formatCBOR) Finish() []byte {
+	f.line = appendCBORHead(f.line[:0], cborMap, uint64(f.count))
+	return append(f.line, f.body...)
+}
+
+// appendCBORHead appends the head of the data item with the argument
+// in the shortest form.
+func appendCBORHead(buf []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return appendUint32(append(buf, major|26), uint32(n))
+	}
+	return appendUint64(append(buf, major|27), n)
+}
+
+// appendCBOR appends the value returned by TypedValue().
+func appendCBOR(buf []byte, val interface{}) []byte {
+	switch v := val.(type) {
+	case nil:
+		return append(buf, 0xf6)
+	case bool:
+		if v {
+			return append(buf, 0xf5)
+		}
+		return append(buf, 0xf4)
+	case int64:
+		if v < 0 {
+			return appendCBORHead(buf, cborNegInt, uint64(^v))
+		}
+		return appendCBORHead(buf, cborUint, uint64(v))
+	case uint64:
+		return appendCBORHead(buf, cborUint, v)
+	case float64:
+		return appendUint64(append(buf, 0xfb), math.Float64bits(v))
+	case time.Time:
+		buf = appendCBORHead(buf, cborTag, 1)
+		if v.Nanosecond() != 0 {
+			return appendCBOR(buf, float64(v.Unix())+float64(v.Nanosecond())/1e9)
+		}
+		return appendCBOR(buf, v.Unix())
+	case json.RawMessage:
+		var d = json.NewDecoder(bytes.NewReader(v))
+		d.UseNumber()
+		if obj, err := appendCBORJSON(nil, d); err == nil {
+			return append(buf, obj...)
+		}
+		return appendCBOR(buf, string(v))
+	case string:
+		buf = appendCBORHead(buf, cborText, uint64(len(v)))
+		return append(buf, v...)
+	}
+	return buf
+}
+
+// appendCBORJSON converts the next JSON value read by the decoder.
+// The order of the keys of the objects is kept.
+func appendCBORJSON(buf []byte, d *json.Decoder) ([]byte, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		var (
+			items []byte
+			n     uint64
+		)
+		for d.More() {
+			if v == '{' {
+				key, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+				items = appendCBOR(items, key.(string))
+			}
+			if items, err = appendCBORJSON(items, d); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		// The closing delimiter.
+		if _, err = d.Token(); err != nil {
+			return nil, err
+		}
+		if v == '{' {
+			buf = appendCBORHead(buf, cborMap, n)
+		} else {
+			buf = appendCBORHead(buf, cborArray, n)
+		}
+		return append(buf, items...), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendCBOR(buf, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendCBOR(buf, f), nil
+	}
+	// The strings, booleans and nil.
+	return appendCBOR(buf, tok), nil
+}
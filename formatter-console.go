@@ -0,0 +1,301 @@
+package kiwi
+
+// This file consists of the formatter for human friendly console output.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type column struct {
+	key   string
+	width int
+}
+
+type formatConsole struct {
+	line       *bytes.Buffer
+	rest       *bytes.Buffer
+	columns    []column
+	values     []string
+	types      []int
+	filled     []bool
+	multiLine  bool
+	indent     string
+	header     bool
+	colors     bool
+	shortPaths map[string]bool
+}
+
+// ANSI escape sequences of the console colors.
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+// AsConsole says that a sink uses human friendly format for the
+// console. Without columns it looks like logfmt but the values
+// quoted only when they contain spaces or special chars. The values
+// of the keys set by Column() displayed first in fixed width columns
+// so they lined up vertically across the records:
+//
+//	kiwi.SinkTo(os.Stdout, kiwi.AsConsole().Column("ts", 20).Column("level", 5)).Start()
+//	// 2019-01-02T15:04:05Z info  msg="user logged in" id=12
+//	// 2019-01-02T15:04:06Z error msg=failed id=13
+func AsConsole() *formatConsole {
+	return &formatConsole{
+		line: bytes.NewBuffer(make([]byte, 0, 256)),
+		rest: bytes.NewBuffer(make([]byte, 0, 256)),
+	}
+}
+
+// UseConsole returns the console format for the output. The colors
+// enabled when the output is the terminal that supports them (see
+// AutoSink() for the rules):
+//
+//	kiwi.SinkTo(os.Stderr, kiwi.UseConsole(os.Stderr).Column("level", 5).ShortPaths()).Start()
+func UseConsole(w io.Writer) *formatConsole {
+	return AsConsole().Colors(colorTerminal(w))
+}
+
+// Colors turns on or off the colors. The keys colored by the kinds of
+// their values and the values of SeverityKey by the severity: errors
+// are red, warnings are yellow, info is green and debug is gray.
+func (f *formatConsole) Colors(on bool) *formatConsole {
+	f.colors = on
+	return f
+}
+
+// ShortPaths shortens the file paths in the values of the keys to the
+// last directory and the file name. Without keys it shortens the
+// values of "file" key added by "where" helper:
+//
+//	// file=/home/user/src/app/db/query.go:12 displayed as file=db/query.go:12
+func (f *formatConsole) ShortPaths(keys ...string) *formatConsole {
+	if len(keys) == 0 {
+		keys = []string{"file"}
+	}
+	if f.shortPaths == nil {
+		f.shortPaths = make(map[string]bool, len(keys))
+	}
+	for _, key := range keys {
+		f.shortPaths[key] = true
+	}
+	return f
+}
+
+// Column adds the column for the value of the key. The value is
+// padded with spaces up to the width (in runes). The longer values
+// are not truncated so they shift the columns that follow.
+func (f *formatConsole) Column(key string, width int) *formatConsole {
+	f.columns = append(f.columns, column{key, width})
+	f.values = append(f.values, "")
+	f.types = append(f.types, StringVal)
+	f.filled = append(f.filled, false)
+	return f
+}
+
+// MultiLine renders each pair that not shown in the columns on its own
+// line indented with the indent string. The columns (or the first
+// pair if there are no columns) form the header line. The values with
+// line breaks (stack traces for example) displayed as is with the
+// lines indented twice:
+//
+//	error db
+//	  msg=failed
+//	  stack=
+//	    main.query(db.go:12)
+//	    main.main(main.go:5)
+func (f *formatConsole) MultiLine(indent string) *formatConsole {
+	f.multiLine = true
+	f.indent = indent
+	return f
+}
+
+func (f *formatConsole) Begin() {
+	f.line.Reset()
+	f.rest.Reset()
+	f.header = len(f.columns) == 0
+	for i := range f.values {
+		f.values[i] = ""
+		f.filled[i] = false
+	}
+}
+
+func (f *formatConsole) Pair(key, val string, valType int) {
+	if f.shortPaths[key] {
+		val = shortPath(val)
+	}
+	for i, c := range f.columns {
+		if c.key == key && !f.filled[i] {
+			f.values[i] = val
+			f.types[i] = valType
+			f.filled[i] = true
+			return
+		}
+	}
+	if f.multiLine {
+		f.multiLinePair(key, val, valType)
+		return
+	}
+	if f.rest.Len() > 0 {
+		f.rest.WriteByte(' ')
+	}
+	f.writeKey(key, valType)
+	f.writeValue(key, consoleValue(val))
+}
+
+func (f *formatConsole) multiLinePair(key, val string, valType int) {
+	if f.header {
+		// The first pair is the header when no columns defined.
+		f.header = false
+		f.writeKey(key, valType)
+		f.writeValue(key, consoleValue(val))
+		return
+	}
+	f.rest.WriteByte('\n')
+	f.rest.WriteString(f.indent)
+	f.writeKey(key, valType)
+	if !strings.Contains(val, "\n") {
+		f.writeValue(key, consoleValue(val))
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(val, "\n"), "\n") {
+		f.rest.WriteByte('\n')
+		f.rest.WriteString(f.indent)
+		f.rest.WriteString(f.indent)
+		f.rest.WriteString(line)
+	}
+}
+
+func (f *formatConsole) Finish() []byte {
+	for i, c := range f.columns {
+		if color := f.valueColor(c.key, f.values[i]); color != "" && f.values[i] != "" {
+			f.line.WriteString(color)
+			f.line.WriteString(f.values[i])
+			f.line.WriteString(colorReset)
+		} else {
+			f.line.WriteString(f.values[i])
+		}
+		if i < len(f.columns)-1 || f.rest.Len() > 0 && !f.multiLine {
+			for n := utf8.RuneCountInString(f.values[i]); n < c.width; n++ {
+				f.line.WriteByte(' ')
+			}
+			f.line.WriteByte(' ')
+		}
+	}
+	f.line.Write(f.rest.Bytes())
+	f.line.WriteByte('\n')
+	return f.line.Bytes()
+}
+
+// consoleValue quotes the value only if it needs quoting for
+// readability.
+func consoleValue(val string) string {
+	if val == "" || strings.ContainsAny(val, " \t\r\n=\"") {
+		return strconv.Quote(val)
+	}
+	return val
+}
+
+// writeKey writes the key colored by the kind of its value.
+func (f *formatConsole) writeKey(key string, valType int) {
+	if !f.colors {
+		f.rest.WriteString(key)
+		f.rest.WriteByte('=')
+		return
+	}
+	switch valType {
+	case IntegerVal, FloatVal:
+		f.rest.WriteString(colorBlue)
+	case BooleanVal:
+		f.rest.WriteString(colorMagenta)
+	case TimeVal:
+		f.rest.WriteString(colorGreen)
+	case VoidVal:
+		f.rest.WriteString(colorGray)
+	default:
+		f.rest.WriteString(colorCyan)
+	}
+	f.rest.WriteString(key)
+	f.rest.WriteString(colorReset)
+	f.rest.WriteByte('=')
+}
+
+// writeValue writes the value colored by the severity if it is the
+// value of SeverityKey.
+func (f *formatConsole) writeValue(key, val string) {
+	if color := f.valueColor(key, val); color != "" {
+		f.rest.WriteString(color)
+		f.rest.WriteString(val)
+		f.rest.WriteString(colorReset)
+		return
+	}
+	f.rest.WriteString(val)
+}
+
+// valueColor returns the color of the value. Only the values of
+// SeverityKey are colored.
+func (f *formatConsole) valueColor(key, val string) string {
+	if !f.colors || key != SeverityKey {
+		return ""
+	}
+	switch rank := severityRank(val); {
+	case rank > warningSeverity:
+		return colorRed
+	case rank == warningSeverity:
+		return colorYellow
+	case rank == Severities["debug"]:
+		return colorGray
+	}
+	return colorGreen
+}
+
+// shortPath leaves only the last directory and the file name of the
+// path.
+func shortPath(path string) string {
+	var dir, file = filepath.Split(path)
+	if dir == "" {
+		return path
+	}
+	return filepath.Join(filepath.Base(dir), file)
+}
@@ -0,0 +1,109 @@
+package kiwi
+
+// This file consists of the formatter for Elastic Common Schema.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+// ECSVersion is the version of Elastic Common Schema added to the
+// records formatted by UseECS().
+var ECSVersion = "8.11.0"
+
+// ECSFields maps the keys of the records to the field names of
+// Elastic Common Schema. The keys not listed here are emitted as is.
+// The names with dots are emitted as the nested objects.
+var ECSFields = map[string]string{
+	"at":       "@timestamp",
+	"time":     "@timestamp",
+	"ts":       "@timestamp",
+	"level":    "log.level",
+	"msg":      "message",
+	"message":  "message",
+	"error":    "error.message",
+	"err":      "error.message",
+	"stack":    "error.stack_trace",
+	"trace_id": "trace.id",
+	"span_id":  "span.id",
+	"file":     "log.origin.file.name",
+	"function": "log.origin.function",
+	"lineno":   "log.origin.file.line",
+	"logger":   "log.logger",
+	"service":  "service.name",
+	"host":     "host.name",
+}
+
+type formatECS struct {
+	*formatJSON
+	fields map[string]string
+}
+
+// UseECS says that a sink uses JSON format with the field names of
+// Elastic Common Schema so the records could be ingested to
+// Elasticsearch without ingest pipelines. The keys are mapped by
+// ECSFields, the keys with dots are emitted as the nested objects
+// (see formatJSON.Nested()) and "ecs.version" is added to each
+// record:
+//
+//	log.Log("level", "info", "msg", "started", "trace_id", id)
+//	// {"log":{"level":"info"}, "message":"started", "trace":{"id":"..."}, "ecs":{"version":"8.11.0"}}
+//
+// The time values should be formatted in RFC-3339 (see TimeLayout).
+func UseECS() *formatECS {
+	var fields = make(map[string]string, len(ECSFields)+2)
+	for key, name := range ECSFields {
+		fields[key] = name
+	}
+	fields[SeverityKey] = "log.level"
+	fields[MessageKey] = "message"
+	return &formatECS{formatJSON: AsJSON().Nested(), fields: fields}
+}
+
+// Field maps the key to ECS field name for this formatter. Empty name
+// removes the mapping.
+func (f *formatECS) Field(key, name string) *formatECS {
+	if name == "" {
+		delete(f.fields, key)
+	} else {
+		f.fields[key] = name
+	}
+	return f
+}
+
+func (f *formatECS) Pair(key, val string, valType int) {
+	if name, ok := f.fields[key]; ok {
+		key = name
+	}
+	f.formatJSON.Pair(key, val, valType)
+}
+
+func (f *formatECS) Finish() []byte {
+	f.formatJSON.Pair("ecs.version", ECSVersion, StringVal)
+	return f.formatJSON.Finish()
+}
@@ -0,0 +1,106 @@
+package kiwi
+
+// This file consists of the formatter for Labeled Tab-separated Values.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	"bytes"
+	"strings"
+)
+
+// ltsvEscaper is the default escaping of the values: the tabs and the
+// line breaks written as \t, \r and \n.
+var ltsvEscaper = strings.NewReplacer("\t", `\t`, "\r", `\r`, "\n", `\n`)
+
+type formatLTSV struct {
+	line    *bytes.Buffer
+	escaper *strings.Replacer
+	first   bool
+}
+
+// UseLTSV says that a sink uses LTSV (Labeled Tab-separated Values)
+// format consumed by Fluentd plugins, nginx tooling and other
+// collectors. Each record is a line of label:value fields separated
+// by the tabs:
+//
+//	log.Log("level", "info", "msg", "started", "port", 80)
+//	// level:info<TAB>msg:started<TAB>port:80
+//
+// The values are not quoted. The tabs and the line breaks in the
+// values are escaped as \t, \r and \n (see Escape()). The chars not
+// allowed in the labels are replaced with '_'.
+func UseLTSV() *formatLTSV {
+	return &formatLTSV{line: bytes.NewBuffer(make([]byte, 256)), escaper: ltsvEscaper}
+}
+
+// Escape sets the replacements of the tabs and the line breaks in
+// the values. For example the collectors that not unescape the
+// values could get them with spaces:
+//
+//	kiwi.SinkTo(w, kiwi.UseLTSV().Escape(" ", " ")).Start()
+func (f *formatLTSV) Escape(tab, newline string) *formatLTSV {
+	f.escaper = strings.NewReplacer("\t", tab, "\r\n", newline, "\r", newline, "\n", newline)
+	return f
+}
+
+func (f *formatLTSV) Begin() {
+	f.line.Reset()
+	f.first = true
+}
+
+func (f *formatLTSV) Pair(key, val string, valType int) {
+	if !f.first {
+		f.line.WriteByte('\t')
+	}
+	f.first = false
+	if key == "" {
+		key = "_"
+	}
+	for _, r := range key {
+		if invalidLTSVRune(r) {
+			r = '_'
+		}
+		f.line.WriteRune(r)
+	}
+	f.line.WriteByte(':')
+	f.escaper.WriteString(f.line, val)
+}
+
+func (f *formatLTSV) Finish() []byte {
+	f.line.WriteByte('\n')
+	return f.line.Bytes()
+}
+
+// invalidLTSVRune reports whether the rune is not allowed in the
+// labels by LTSV specification.
+func invalidLTSVRune(r rune) bool {
+	return !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '_' || r == '.' || r == '-')
+}
@@ -0,0 +1,271 @@
+package kiwi
+
+// This file consists of the formatter for MessagePack binary format.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+type formatMsgpack struct {
+	body   []byte
+	line   []byte
+	count  int
+	prefix bool
+}
+
+// UseMsgpack says that a sink uses MessagePack binary format. Each
+// record is encoded as the map prefixed by its length (big endian
+// uint32) so the collectors could read the stream record by record.
+// The numbers, booleans and nils are encoded natively, the times as
+// MessagePack timestamps and the objects as nested maps and arrays:
+//
+//	kiwi.SinkTo(conn, kiwi.UseMsgpack()).Start()
+//
+// Use NoPrefix() for the collectors that read the plain stream of
+// MessagePack values (Fluent Bit for example).
+func UseMsgpack() *formatMsgpack {
+	return &formatMsgpack{
+		body:   make([]byte, 0, 256),
+		line:   make([]byte, 0, 256),
+		prefix: true,
+	}
+}
+
+// NoPrefix removes the length prefixes of the records.
+func (f *formatMsgpack) NoPrefix() *formatMsgpack {
+	f.prefix = false
+	return f
+}
+
+func (f *formatMsgpack) Begin() {
+	f.body = f.body[:0]
+	f.count = 0
+}
+
+func (f *formatMsgpack) Pair(key, val string, valType int) {
+	f.TypedPair(key, TypedValue(val, valType), valType)
+}
+
+func (f *formatMsgpack) TypedPair(key string, val interface{}, valType int) {
+	f.body = appendMsgpackString(f.body, key)
+	f.body = appendMsgpack(f.body, val)
+	f.count++
+}
+
+func (f *formatMsgpack) Finish() []byte {
+	f.line = f.line[:0]
+	if f.prefix {
+		f.line = append(f.line, 0, 0, 0, 0)
+	}
+	f.line = appendMsgpackHeader(f.line, f.count, 0x80, 0xde)
+	f.line = append(f.line, f.body...)
+	if f.prefix {
+		binary.BigEndian.PutUint32(f.line, uint32(len(f.line)-4))
+	}
+	return f.line
+}
+
+// appendMsgpack appends the value returned by TypedValue().
+func appendMsgpack(buf []byte, val interface{}) []byte {
+	switch v := val.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if v {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case int64:
+		return appendMsgpackInt(buf, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return appendMsgpackInt(buf, int64(v))
+		}
+		buf = append(buf, 0xcf)
+		return appendUint64(buf, v)
+	case float64:
+		buf = append(buf, 0xcb)
+		return appendUint64(buf, math.Float64bits(v))
+	case time.Time:
+		return appendMsgpackTime(buf, v)
+	case json.RawMessage:
+		var d = json.NewDecoder(bytes.NewReader(v))
+		d.UseNumber()
+		if obj, err := appendMsgpackJSON(nil, d); err == nil {
+			return append(buf, obj...)
+		}
+		return appendMsgpackString(buf, string(v))
+	case string:
+		return appendMsgpackString(buf, v)
+	}
+	return buf
+}
+
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf = append(buf, 0xd1)
+		return appendUint16(buf, uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf = append(buf, 0xd2)
+		return appendUint32(buf, uint32(i))
+	}
+	buf = append(buf, 0xd3)
+	return appendUint64(buf, uint64(i))
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	var n = len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda)
+		buf = appendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0xdb)
+		buf = appendUint32(buf, uint32(n))
+	}
+	return append(buf, s...)
+}
+
+// appendMsgpackHeader appends the header of the map or the array. The
+// fixed code is for up to 15 elements, the code for 16 bit length
+// followed by the code for 32 bit length.
+func appendMsgpackHeader(buf []byte, n int, fixed, code byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fixed|byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, code)
+		return appendUint16(buf, uint16(n))
+	}
+	buf = append(buf, code+1)
+	return appendUint32(buf, uint32(n))
+}
+
+// appendMsgpackTime appends the timestamp extension (type -1) in the
+// shortest form.
+func appendMsgpackTime(buf []byte, t time.Time) []byte {
+	var (
+		sec  = t.Unix()
+		nsec = uint32(t.Nanosecond())
+	)
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		buf = append(buf, 0xd6, 0xff)
+		return appendUint32(buf, uint32(sec))
+	case sec >= 0 && sec < 1<<34:
+		buf = append(buf, 0xd7, 0xff)
+		return appendUint64(buf, uint64(nsec)<<34|uint64(sec))
+	}
+	buf = append(buf, 0xc7, 12, 0xff)
+	buf = appendUint32(buf, nsec)
+	return appendUint64(buf, uint64(sec))
+}
+
+// appendMsgpackJSON converts the next JSON value read by the decoder.
+// The order of the keys of the objects is kept.
+func appendMsgpackJSON(buf []byte, d *json.Decoder) ([]byte, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		var (
+			items []byte
+			n     int
+		)
+		for d.More() {
+			if v == '{' {
+				key, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+				items = appendMsgpackString(items, key.(string))
+			}
+			if items, err = appendMsgpackJSON(items, d); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		// The closing delimiter.
+		if _, err = d.Token(); err != nil {
+			return nil, err
+		}
+		if v == '{' {
+			buf = appendMsgpackHeader(buf, n, 0x80, 0xde)
+		} else {
+			buf = appendMsgpackHeader(buf, n, 0x90, 0xdc)
+		}
+		return append(buf, items...), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(buf, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpack(buf, f), nil
+	case string:
+		return appendMsgpackString(buf, v), nil
+	}
+	// The booleans and nil.
+	return appendMsgpack(buf, tok), nil
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
@@ -34,8 +34,11 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 import (
 	"bytes"
+	"encoding/json"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // Formatter represents format of the output.
@@ -53,8 +56,83 @@ type Formatter interface {
 	Finish() []byte
 }
 
+// TypedFormatter is the formatter that gets the values of the pairs
+// as Go values instead of the strings. So the binary formats
+// (msgpack, CBOR, protobuf etc.) could encode the numbers and the
+// booleans natively. The sink calls TypedPair() instead of Pair() for
+// such formatters. The values are decoded by TypedValue().
+type TypedFormatter interface {
+	Formatter
+	// TypedPair called for each key-value pair of the record
+	// with the value converted by TypedValue().
+	TypedPair(key string, value interface{}, valueType int)
+}
+
+// ObjectFormatter is the formatter that writes the maps, slices and
+// structs as the objects (see ObjectVal). Other formatters get such
+// values formatted by fmt with %+v verb as the strings. JSON and the
+// flattening logfmt (see Flatten()) formatters write the objects. The
+// typed formatters (see TypedFormatter) always get the objects as
+// json.RawMessage.
+type ObjectFormatter interface {
+	Formatter
+	// FormatsObjects reports whether the formatter gets the
+	// objects encoded as JSON.
+	FormatsObjects() bool
+}
+
+// TypedValue converts the string representation of the value back to
+// the Go value according to its type:
+//
+//	IntegerVal  int64 (or uint64 for the large unsigned numbers)
+//	FloatVal    float64
+//	BooleanVal  bool
+//	TimeVal     time.Time (parsed with TimeLayout)
+//	VoidVal     nil
+//	ObjectVal   json.RawMessage
+//
+// The values of other types and the values that could not be
+// converted (the values changed by the sink settings for example)
+// are returned as strings.
+func TypedValue(val string, valType int) interface{} {
+	switch valType {
+	case IntegerVal:
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(val, 10, 64); err == nil {
+			return u
+		}
+	case FloatVal:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	case BooleanVal:
+		switch val {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	case TimeVal:
+		if t, err := time.Parse(TimeLayout, val); err == nil {
+			return t
+		}
+	case VoidVal:
+		if val == "<nil>" {
+			return nil
+		}
+	case ObjectVal:
+		return json.RawMessage(val)
+	}
+	return val
+}
+
 type formatLogfmt struct {
-	line *bytes.Buffer
+	line    *bytes.Buffer
+	strict  bool
+	first   bool
+	flatten int
 }
 
 // AsLogfmt says that a sink uses Logfmt format for records output.
@@ -62,11 +140,46 @@ func AsLogfmt() *formatLogfmt {
 	return &formatLogfmt{line: bytes.NewBuffer(make([]byte, 256))}
 }
 
+// Strict switches the formatter to the strict mode that follows the
+// logfmt reference implementation (github.com/go-logfmt/logfmt) so
+// the output could be parsed by any logfmt parser:
+//
+//   - the values quoted only if they contain spaces, control chars,
+//     '=' or '"' regardless of the value type;
+//   - the escaping inside quotes is the same as for JSON strings,
+//     invalid UTF-8 replaced with U+FFFD;
+//   - the keys never quoted, the chars not allowed in the keys
+//     replaced with '_';
+//   - empty values written as key= without quotes, the string
+//     "null" is quoted;
+//   - no trailing space at the end of the record.
+func (f *formatLogfmt) Strict() *formatLogfmt {
+	f.strict = true
+	return f
+}
+
+// FormatsObjects reports whether the objects flattened (see Flatten()).
+func (f *formatLogfmt) FormatsObjects() bool {
+	return f.flatten > 0
+}
+
 func (f *formatLogfmt) Begin() {
 	f.line.Reset()
+	f.first = true
 }
 
 func (f *formatLogfmt) Pair(key, val string, valType int) {
+	if valType == ObjectVal && flattenObject(key, val, f.flatten, f.pair) {
+		return
+	}
+	f.pair(key, val, valType)
+}
+
+func (f *formatLogfmt) pair(key, val string, valType int) {
+	if f.strict {
+		f.strictPair(key, val, valType)
+		return
+	}
 	// TODO allow multiline values output?
 	// TODO extend check for all non printable chars, so it need just check for each byte>space
 	if strings.ContainsAny(key, " \n\r\t") {
@@ -75,7 +188,7 @@ func (f *formatLogfmt) Pair(key, val string, valType int) {
 		f.line.WriteString(key)
 	}
 	switch valType {
-	case StringVal, CustomQuoted:
+	case StringVal, CustomQuoted, VoidVal, ObjectVal:
 		f.line.WriteRune('=')
 		f.line.WriteString(strconv.Quote(val))
 	default:
@@ -85,39 +198,277 @@ func (f *formatLogfmt) Pair(key, val string, valType int) {
 	f.line.WriteRune(' ')
 }
 
+func (f *formatLogfmt) strictPair(key, val string, valType int) {
+	if !f.first {
+		f.line.WriteByte(' ')
+	}
+	f.first = false
+	if key == "" {
+		key = "_"
+	}
+	for _, r := range key {
+		if invalidLogfmtRune(r) {
+			r = '_'
+		}
+		f.line.WriteRune(r)
+	}
+	f.line.WriteByte('=')
+	// The string "null" quoted for distinction from null value.
+	if val == "null" && (valType == StringVal || valType == CustomQuoted) {
+		f.line.WriteString(`"null"`)
+		return
+	}
+	if valType == VoidVal && val == "<nil>" {
+		f.line.WriteString("null")
+		return
+	}
+	if strings.IndexFunc(val, invalidLogfmtRune) == -1 {
+		f.line.WriteString(val)
+		return
+	}
+	writeJSONString(f.line, val)
+}
+
+// invalidLogfmtRune reports whether the rune requires quoting of the
+// value or could not be a part of the key.
+func invalidLogfmtRune(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError
+}
+
 func (f *formatLogfmt) Finish() []byte {
 	f.line.WriteRune('\n')
 	return f.line.Bytes()
 }
 
+// Modes of output of the float values that JSON can't represent
+// (NaN, +Inf, -Inf). See formatJSON.NonFinite().
+const (
+	// NonFiniteAsString outputs them as strings "NaN", "+Inf", "-Inf".
+	NonFiniteAsString = iota
+	// NonFiniteAsNull outputs them as null.
+	NonFiniteAsNull
+	// NonFiniteSkip omits the pairs with such values.
+	NonFiniteSkip
+)
+
 type formatJSON struct {
-	line *bytes.Buffer
+	line      *bytes.Buffer
+	first     bool
+	nonFinite int
+	nested    bool
+	maxDepth  int
+	root      jsonNode
+}
+
+// jsonNode is the object or the value of the record in nested mode.
+type jsonNode struct {
+	key      string
+	val      string
+	valType  int
+	leaf     bool
+	children []*jsonNode
 }
 
-// AsJSON says that a sink uses JSON (RFC-7159) format for records output.
+// AsJSON says that a sink uses JSON (RFC-8259) format for records
+// output. The keys and string values escaped according to RFC, the
+// integers and floats emitted as JSON numbers. The maps, slices and
+// structs emitted as nested JSON values (see ObjectFormatter):
+//
+//	log.Log("user", map[string]interface{}{"id": 1, "roles": []string{"admin"}})
+//	// {"user":{"id":1,"roles":["admin"]}}
 func AsJSON() *formatJSON {
 	return &formatJSON{line: bytes.NewBuffer(make([]byte, 256))}
 }
 
+// NonFinite sets how the floats that can't be represented in JSON
+// (NaN, +Inf, -Inf) are emitted. Possible modes are
+// NonFiniteAsString (default), NonFiniteAsNull and NonFiniteSkip.
+func (f *formatJSON) NonFinite(mode int) *formatJSON {
+	f.nonFinite = mode
+	return f
+}
+
+// Nested splits the keys by PrefixSeparator and emits the pairs with
+// the same prefix as the nested objects. So the keys of the loggers
+// created by Logger.Prefix() or Logger.Namespace() are grouped:
+//
+//	log.Namespace("db").Log("query", q, "rows", 3)
+//	// {"db":{"query":"...", "rows":3}}
+//
+// The pair that conflicts with the object of other pairs ("db" and
+// "db.query" for example) is emitted with the full key as is.
+func (f *formatJSON) Nested() *formatJSON {
+	f.nested = true
+	return f
+}
+
+// FormatsObjects reports that the objects written as nested values.
+func (f *formatJSON) FormatsObjects() bool {
+	return true
+}
+
 func (f *formatJSON) Begin() {
 	f.line.Reset()
 	f.line.WriteRune('{')
+	f.first = true
+	f.root.children = f.root.children[:0]
 }
 
 func (f *formatJSON) Pair(key, val string, valType int) {
-	f.line.WriteString(strconv.Quote(key))
+	if valType == FloatVal && isNonFinite(val) && f.nonFinite == NonFiniteSkip {
+		return
+	}
+	if f.nested {
+		f.root.insert(key, val, valType)
+		return
+	}
+	if !f.first {
+		f.line.WriteString(", ")
+	}
+	f.first = false
+	writeJSONString(f.line, key)
 	f.line.WriteRune(':')
-	switch valType {
-	case StringVal, TimeVal, CustomQuoted:
-		f.line.WriteString(strconv.Quote(val))
+	f.writeValue(val, valType)
+}
+
+// writeValue writes the value according to its type.
+func (f *formatJSON) writeValue(val string, valType int) {
+	var nonFinite = valType == FloatVal && isNonFinite(val)
+	switch {
+	case nonFinite && f.nonFinite == NonFiniteAsNull:
+		f.line.WriteString("null")
+	case nonFinite:
+		writeJSONString(f.line, val)
+	case valType == VoidVal && val == "<nil>":
+		f.line.WriteString("null")
+	case valType == ObjectVal && f.maxDepth > 0:
+		writeTruncatedJSON(f.line, json.RawMessage(val), f.maxDepth)
+	case valType == StringVal, valType == TimeVal, valType == CustomQuoted, valType == ComplexVal:
+		writeJSONString(f.line, val)
+	case valType == CustomUnquoted && !json.Valid([]byte(val)):
+		// The custom value is written as is only if it is the
+		// valid JSON (a number, an object etc.).
+		writeJSONString(f.line, val)
 	default:
 		f.line.WriteString(val)
 	}
-	f.line.WriteString(", ")
 }
 
 func (f *formatJSON) Finish() []byte {
+	if f.nested {
+		f.writeNodes(f.root.children)
+	}
 	f.line.WriteRune('}')
 	f.line.WriteRune('\n')
 	return f.line.Bytes()
 }
+
+// writeNodes writes the members of the object.
+func (f *formatJSON) writeNodes(nodes []*jsonNode) {
+	for i, n := range nodes {
+		if i > 0 {
+			f.line.WriteString(", ")
+		}
+		writeJSONString(f.line, n.key)
+		f.line.WriteRune(':')
+		if n.leaf {
+			f.writeValue(n.val, n.valType)
+			continue
+		}
+		f.line.WriteRune('{')
+		f.writeNodes(n.children)
+		f.line.WriteRune('}')
+	}
+}
+
+// insert adds the value to the tree by the parts of the key. The
+// value that conflicts with existing nodes added to the node with the
+// full key.
+func (n *jsonNode) insert(key, val string, valType int) {
+	var (
+		parts = strings.Split(key, PrefixSeparator)
+		node  = n
+	)
+	for _, part := range parts[:len(parts)-1] {
+		var c = node.child(part)
+		if c == nil {
+			c = &jsonNode{key: part}
+			node.children = append(node.children, c)
+		} else if c.leaf {
+			node = nil
+			break
+		}
+		node = c
+	}
+	if node == nil || node.child(parts[len(parts)-1]) != nil {
+		n.children = append(n.children, &jsonNode{key: key, val: val, valType: valType, leaf: true})
+		return
+	}
+	node.children = append(node.children, &jsonNode{key: parts[len(parts)-1], val: val, valType: valType, leaf: true})
+}
+
+// child returns the member of the object with the key.
+func (n *jsonNode) child(key string) *jsonNode {
+	for _, c := range n.children {
+		if c.key == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// isNonFinite reports whether the float value is NaN or infinity.
+func isNonFinite(val string) bool {
+	switch val {
+	case "NaN", "+Inf", "-Inf", "Inf":
+		return true
+	}
+	return false
+}
+
+const hexDigits = "0123456789abcdef"
+
+// writeJSONString writes the string in quotes escaped as JSON string
+// (RFC-8259). Invalid UTF-8 sequences replaced with U+FFFD.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	var start = 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buf.WriteString(s[start:i])
+			switch b {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[b>>4])
+				buf.WriteByte(hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
@@ -0,0 +1,342 @@
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// formatPairs passes the pairs through the formatter and returns the
+// result.
+func formatPairs(f Formatter, pairs ...*Pair) string {
+	f.Begin()
+	for _, p := range pairs {
+		f.Pair(p.Key, p.Val, p.Type)
+	}
+	return string(f.Finish())
+}
+
+// Test of the strict logfmt quoting. The expected values are the same
+// as produced by the logfmt reference encoder
+// (github.com/go-logfmt/logfmt) for the same keys and values.
+func TestFormatLogfmt_Strict(t *testing.T) {
+	cases := []struct {
+		pair     *Pair
+		expected string
+	}{
+		{&Pair{"k", "value", nil, StringVal}, "k=value\n"},
+		{&Pair{"k", "", nil, StringVal}, "k=\n"},
+		{&Pair{"k", "null", nil, StringVal}, "k=\"null\"\n"},
+		{&Pair{"k", "two words", nil, StringVal}, "k=\"two words\"\n"},
+		{&Pair{"k", "a=b", nil, StringVal}, "k=\"a=b\"\n"},
+		{&Pair{"k", `say "hi"`, nil, StringVal}, "k=\"say \\\"hi\\\"\"\n"},
+		{&Pair{"k", `back\slash`, nil, StringVal}, "k=back\\slash\n"},
+		{&Pair{"k", "multi\nline\ttab", nil, StringVal}, "k=\"multi\\nline\\ttab\"\n"},
+		{&Pair{"k", "bell\x07", nil, StringVal}, "k=\"bell\\u0007\"\n"},
+		{&Pair{"k", "bad\xffutf", nil, StringVal}, "k=\"bad\\ufffdutf\"\n"},
+		{&Pair{"k", "日本語", nil, StringVal}, "k=日本語\n"},
+		{&Pair{"k", "123", nil, IntegerVal}, "k=123\n"},
+		{&Pair{"key with spaces", "v", nil, StringVal}, "key_with_spaces=v\n"},
+		{&Pair{"a=b\"c", "v", nil, StringVal}, "a_b_c=v\n"},
+		{&Pair{"", "v", nil, StringVal}, "_=v\n"},
+	}
+
+	for _, c := range cases {
+		out := formatPairs(AsLogfmt().Strict(), c.pair)
+
+		if out != c.expected {
+			t.Logf("for %q=%q expected %q got %q", c.pair.Key, c.pair.Val, c.expected, out)
+			t.Fail()
+		}
+	}
+}
+
+// Test that the strict logfmt separates the pairs by single spaces
+// without trailing space.
+func TestFormatLogfmt_StrictSeveralPairs(t *testing.T) {
+	out := formatPairs(AsLogfmt().Strict(),
+		&Pair{"a", "1", nil, IntegerVal},
+		&Pair{"b", "x y", nil, StringVal},
+		&Pair{"c", "true", nil, BooleanVal})
+
+	if out != "a=1 b=\"x y\" c=true\n" {
+		t.Logf("unexpected output %q", out)
+		t.Fail()
+	}
+}
+
+// Test of escaping of the strings in JSON.
+func TestFormatJSON_Escaping(t *testing.T) {
+	out := formatPairs(AsJSON(),
+		&Pair{"key\n", "say \"hi\"\x01\xff", nil, StringVal},
+		&Pair{"n", "-12", nil, IntegerVal},
+		&Pair{"f", "1.5e+00", nil, FloatVal})
+
+	if out != "{\"key\\n\":\"say \\\"hi\\\"\\u0001\\ufffd\", \"n\":-12, \"f\":1.5e+00}\n" {
+		t.Logf("unexpected output %q", out)
+		t.Fail()
+	}
+}
+
+// customValue is the unquoted Valuer.
+type customValue string
+
+func (v customValue) String() string { return string(v) }
+func (v customValue) IsQuoted() bool { return false }
+
+// Test that the unquoted custom values produce the valid JSON.
+func TestFormatJSON_CustomUnquoted(t *testing.T) {
+	var decoded map[string]interface{}
+
+	out := formatPairs(AsJSON(),
+		toPair("text", customValue("abc def")),
+		toPair("num", customValue("42")),
+		toPair("obj", customValue(`{"a":1}`)),
+		toPair("empty", customValue("")))
+
+	err := json.Unmarshal([]byte(out), &decoded)
+	if err != nil || decoded["text"] != "abc def" || decoded["num"] != 42.0 || decoded["empty"] != "" {
+		t.Logf("unexpected output %q: %v", out, err)
+		t.Fail()
+	}
+	if obj, ok := decoded["obj"].(map[string]interface{}); !ok || obj["a"] != 1.0 {
+		t.Logf("expected the object in %q", out)
+		t.Fail()
+	}
+}
+
+// Test of the nested objects for the prefixed keys in JSON.
+func TestFormatJSON_Nested(t *testing.T) {
+	out := formatPairs(AsJSON().Nested(),
+		&Pair{"db.query", "select", nil, StringVal},
+		&Pair{"app", "x", nil, StringVal},
+		&Pair{"db.tx.id", "1", nil, IntegerVal},
+		&Pair{"db.rows", "3", nil, IntegerVal},
+		&Pair{"app.id", "2", nil, IntegerVal})
+
+	if out != "{\"db\":{\"query\":\"select\", \"tx\":{\"id\":1}, \"rows\":3}, \"app\":\"x\", \"app.id\":2}\n" {
+		t.Logf("unexpected output %q", out)
+		t.Fail()
+	}
+}
+
+// Test of the keys mapped to the fields of Elastic Common Schema.
+func TestFormatECS(t *testing.T) {
+	out := formatPairs(UseECS(),
+		&Pair{"at", "2019-01-02T15:04:05Z", nil, TimeVal},
+		&Pair{"level", "info", nil, StringVal},
+		&Pair{"msg", "started", nil, StringVal},
+		&Pair{"trace_id", "abc", nil, StringVal},
+		&Pair{"user", "bob", nil, StringVal})
+
+	expected := "{\"@timestamp\":\"2019-01-02T15:04:05Z\", \"log\":{\"level\":\"info\"}, \"message\":\"started\", \"trace\":{\"id\":\"abc\"}, \"user\":\"bob\", \"ecs\":{\"version\":\"8.11.0\"}}\n"
+	if out != expected {
+		t.Logf("expected %q got %q", expected, out)
+		t.Fail()
+	}
+}
+
+// Test of the record encoded as MessagePack map with the length prefix.
+func TestFormatMsgpack(t *testing.T) {
+	out := formatPairs(UseMsgpack(),
+		&Pair{"a", "1", nil, IntegerVal},
+		&Pair{"b", "x", nil, StringVal},
+		&Pair{"t", "true", nil, BooleanVal},
+		&Pair{"n", "<nil>", nil, VoidVal},
+		&Pair{"o", `{"k":[1,300]}`, nil, ObjectVal})
+	stamp := string(appendMsgpackTime(nil, time.Unix(1546441445, 5)))
+
+	expected := "\x00\x00\x00\x18\x85\xa1a\x01\xa1b\xa1x\xa1t\xc3\xa1n\xc0\xa1o\x81\xa1k\x92\x01\xd1\x01,"
+	if out != expected {
+		t.Logf("expected %q got %q", expected, out)
+		t.Fail()
+	}
+	if stamp != "\xd7\xff\x00\x00\x00\x14\x5c\x2c\xd2\xe5" {
+		t.Logf("unexpected timestamp %q", stamp)
+		t.Fail()
+	}
+}
+
+// Test of the record encoded as CBOR map.
+func TestFormatCBOR(t *testing.T) {
+	out := formatPairs(UseCBOR(),
+		&Pair{"a", "-500", nil, IntegerVal},
+		&Pair{"f", "1.5", nil, FloatVal},
+		&Pair{"t", "2019-01-02T15:04:05Z", nil, TimeVal},
+		&Pair{"n", "<nil>", nil, VoidVal},
+		&Pair{"o", `{"k":[true,"x"]}`, nil, ObjectVal})
+
+	expected := "\xa5aa\x39\x01\xf3af\xfb\x3f\xf8\x00\x00\x00\x00\x00\x00at\xc1\x1a\x5c\x2c\xd2\xe5an\xf6ao\xa1ak\x82\xf5ax"
+	if out != expected {
+		t.Logf("expected %q got %q", expected, out)
+		t.Fail()
+	}
+}
+
+// Test of the objects flattened to the dotted keys in logfmt.
+func TestFormatLogfmt_Flatten(t *testing.T) {
+	out := formatPairs(AsLogfmt().Flatten(1),
+		&Pair{"req", `{"method":"GET","size":12,"h":{"a":1},"ok":true}`, nil, ObjectVal},
+		&Pair{"list", `[1,2]`, nil, ObjectVal})
+
+	expected := `req.method="GET" req.size=12 req.h="{\"a\":1}" req.ok=true list="[1,2]" ` + "\n"
+	if out != expected {
+		t.Logf("expected %q got %q", expected, out)
+		t.Fail()
+	}
+}
+
+// Test of the depth limit of the objects in JSON.
+func TestFormatJSON_MaxDepth(t *testing.T) {
+	out := formatPairs(AsJSON().MaxDepth(1),
+		&Pair{"req", `{"method":"GET","h":{"a":[1]},"l":[2]}`, nil, ObjectVal})
+
+	expected := `{"req":{"method":"GET","h":"{\"a\":[1]}","l":"[2]"}}` + "\n"
+	if out != expected {
+		t.Logf("expected %q got %q", expected, out)
+		t.Fail()
+	}
+}
+
+// Test of the output of NaN and infinities in JSON.
+func TestFormatJSON_NonFinite(t *testing.T) {
+	pairs := []*Pair{{"a", "NaN", nil, FloatVal}, {"b", "+Inf", nil, FloatVal}, {"c", "1e+00", nil, FloatVal}}
+
+	asString := formatPairs(AsJSON(), pairs...)
+	asNull := formatPairs(AsJSON().NonFinite(NonFiniteAsNull), pairs...)
+	skipped := formatPairs(AsJSON().NonFinite(NonFiniteSkip), pairs...)
+
+	if asString != "{\"a\":\"NaN\", \"b\":\"+Inf\", \"c\":1e+00}\n" {
+		t.Logf("unexpected output %q", asString)
+		t.Fail()
+	}
+	if asNull != "{\"a\":null, \"b\":null, \"c\":1e+00}\n" {
+		t.Logf("unexpected output %q", asNull)
+		t.Fail()
+	}
+	if skipped != "{\"c\":1e+00}\n" {
+		t.Logf("unexpected output %q", skipped)
+		t.Fail()
+	}
+}
+
+// Test of the output of nil values.
+func TestFormat_NilValue(t *testing.T) {
+	pair := &Pair{"k", "<nil>", nil, VoidVal}
+
+	logfmt := formatPairs(AsLogfmt(), pair)
+	strict := formatPairs(AsLogfmt().Strict(), pair)
+	json := formatPairs(AsJSON(), pair)
+
+	if logfmt != "k=\"<nil>\" \n" || strict != "k=null\n" || json != "{\"k\":null}\n" {
+		t.Logf("unexpected output %q %q %q", logfmt, strict, json)
+		t.Fail()
+	}
+}
+
+// Test that the columns of the console format are aligned.
+func TestFormatConsole_Columns(t *testing.T) {
+	f := AsConsole().Column("level", 5).Column("module", 4)
+
+	first := formatPairs(f, &Pair{"msg", "started", nil, StringVal}, &Pair{"level", "info", nil, StringVal}, &Pair{"module", "db", nil, StringVal})
+	second := formatPairs(f, &Pair{"level", "error", nil, StringVal}, &Pair{"msg", "two words", nil, StringVal})
+
+	if first != "info  db   msg=started\n" {
+		t.Logf("unexpected output %q", first)
+		t.Fail()
+	}
+	if second != "error      msg=\"two words\"\n" {
+		t.Logf("unexpected output %q", second)
+		t.Fail()
+	}
+}
+
+// Test of the console format with each pair on its own line.
+func TestFormatConsole_MultiLine(t *testing.T) {
+	f := AsConsole().Column("level", 5).MultiLine("  ")
+
+	out := formatPairs(f,
+		&Pair{"level", "error", nil, StringVal},
+		&Pair{"msg", "failed", nil, StringVal},
+		&Pair{"stack", "main.query(db.go:12)\nmain.main(main.go:5)\n", nil, StringVal})
+
+	if out != "error\n  msg=failed\n  stack=\n    main.query(db.go:12)\n    main.main(main.go:5)\n" {
+		t.Logf("unexpected output %q", out)
+		t.Fail()
+	}
+}
+
+// Test of the colors and the short paths of the console format.
+func TestFormatConsole_Colors(t *testing.T) {
+	f := AsConsole().Column("level", 5).Colors(true).ShortPaths()
+
+	out := formatPairs(f,
+		&Pair{"level", "warn", nil, StringVal},
+		&Pair{"file", "/src/app/db/query.go:12", nil, StringVal},
+		&Pair{"n", "1", nil, IntegerVal})
+
+	expected := "\x1b[33mwarn\x1b[0m  \x1b[36mfile\x1b[0m=db/query.go:12 \x1b[34mn\x1b[0m=1\n"
+	if out != expected {
+		t.Logf("expected %q got %q", expected, out)
+		t.Fail()
+	}
+}
+
+// Test of LTSV format with the escaped values and the labels.
+func TestFormatLTSV_Escape(t *testing.T) {
+	out := formatPairs(UseLTSV(),
+		&Pair{"level", "info", nil, StringVal},
+		&Pair{"bad key:", "a\tb\nc", nil, StringVal},
+		&Pair{"n", "1", nil, IntegerVal})
+	replaced := formatPairs(UseLTSV().Escape(" ", " "),
+		&Pair{"msg", "a\tb\r\nc", nil, StringVal})
+
+	if out != "level:info\tbad_key_:a\\tb\\nc\tn:1\n" {
+		t.Logf("unexpected output %q", out)
+		t.Fail()
+	}
+	if replaced != "msg:a b c\n" {
+		t.Logf("unexpected output %q", replaced)
+		t.Fail()
+	}
+}
@@ -41,8 +41,8 @@ var (
 	context []*Pair
 )
 
-// With adds key-vals to the global logger context. It is safe for
-// concurrency.
+// With adds key-vals to the global logger context. As Logger.With()
+// it accepts the generators of the pairs. It is safe for concurrency.
 func With(kv ...interface{}) {
 	var (
 		key       string
@@ -82,6 +82,11 @@ next:
 					context = append(context, p)
 				}
 				continue
+			// The generator of pairs evaluated by the sinks.
+			// Next arg should be a key.
+			case func() []*Pair, func() []Pair:
+				context = append(context, generatorPair(arg))
+				continue
 			// The key must be be a string type. The logger generates
 			// error as a new key-value pair for the record.
 			default:
@@ -1,6 +1,9 @@
 package kiwi
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // This file consists of definition of global logging methods.
 
@@ -41,15 +44,14 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 // use Logger type instead.
 func Log(kv ...interface{}) {
 	// 1. Log the context.
-	var record = make([]*Pair, 0, len(context)+len(kv))
+	var (
+		rec    = newRecord(len(context) + len(kv))
+		record = rec.pairs
+	)
 	global.RLock()
 	for _, p := range context {
 		// Evaluate delayed context value here before the output.
-		if p.Eval != nil {
-			record = append(record, &Pair{p.Key, p.Eval.(func() string)(), p.Eval, p.Type})
-		} else {
-			record = append(record, &Pair{p.Key, p.Val, nil, p.Type})
-		}
+		record = rec.appendEvaluated(record, p)
 	}
 	global.RUnlock()
 	// 2. Log the regular key-value pairs that came in the args.
@@ -65,8 +67,10 @@ func Log(kv ...interface{}) {
 				key = val.(string)
 			case *Pair:
 				p = val.(*Pair)
-				if p.Eval != nil {
-					p.Val = p.Eval.(func() string)()
+				if f, ok := p.Eval.(func() string); ok {
+					p.Val = f()
+				} else if f, ok := p.Eval.(func(time.Time) string); ok {
+					p.Val = f(rec.now())
 				}
 				record = append(record, p)
 				continue
@@ -76,7 +80,9 @@ func Log(kv ...interface{}) {
 			}
 		} else {
 			if p = toPair(key, val); p.Eval != nil {
-				p.Val = p.Eval.(func() string)()
+				if f, ok := p.Eval.(func() string); ok {
+					p.Val = f()
+				}
 			}
 			record = append(record, p)
 		}
@@ -87,5 +93,12 @@ func Log(kv ...interface{}) {
 		record = append(record, toPair(UnpairedKey, key))
 	}
 	// 2. Pass the record to the collector.
-	sinkRecord(record)
+	rec.pairs = runHooks(nil, record)
+	DefaultCollector.sinkRecord(rec)
+}
+
+// Msg is simplified realization of Logger.Msg(). It logs the record
+// with human readable text under MessageKey.
+func Msg(text string, kv ...interface{}) {
+	Log(append([]interface{}{MessageKey, text}, kv...)...)
 }
@@ -0,0 +1,201 @@
+//go:build grpc
+// +build grpc
+
+package grpc
+
+// Interceptors of kiwi request logging for gRPC servers. Build with "grpc" tag.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafov/kiwi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Keys of the records of the calls. The time spent for the call is
+// logged under kiwi.ElapsedKey.
+var (
+	MethodKey   = "grpc.method"
+	PeerKey     = "peer"
+	CodeKey     = "grpc.code"
+	ErrorKey    = "error"
+	RequestKey  = "grpc.request"
+	ResponseKey = "grpc.response"
+	StreamKey   = "grpc.stream"
+)
+
+// Interceptors log the calls served by gRPC server.
+type Interceptors struct {
+	log      *kiwi.Logger
+	payloads func(method string) bool
+}
+
+// New creates the interceptors that log the calls with the logger.
+// The level of the records depends on the status codes of the calls
+// (see CodeLevel()). Nil log means the global logger:
+//
+//	log := grpc.New(logger)
+//	srv := ggrpc.NewServer(
+//		ggrpc.UnaryInterceptor(log.Unary()),
+//		ggrpc.StreamInterceptor(log.Stream()))
+//	// level="info" grpc.method="/users.Users/Get" peer="10.0.0.1:52100" grpc.code="OK" elapsed="1.2ms"
+//
+// The context of the call passed to the handler carries the call
+// scoped logger with the method in its context:
+//
+//	kiwi.FromContext(ctx).Log("msg", "user found")
+//	// grpc.method="/users.Users/Get" msg="user found"
+func New(log *kiwi.Logger) *Interceptors {
+	if log == nil {
+		log = kiwi.Fork()
+	}
+	return &Interceptors{log: log}
+}
+
+// Payloads sets the filter of the full method names (like
+// "/users.Users/Get") which requests and responses of the unary calls
+// are logged. The payloads may contain sensitive data so they are not
+// logged by default. Nil filter turns off logging of the payloads.
+func (i *Interceptors) Payloads(filter func(method string) bool) *Interceptors {
+	i.payloads = filter
+	return i
+}
+
+// Unary returns the interceptor for the unary calls.
+func (i *Interceptors) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var start = time.Now()
+		ctx = i.scoped(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		var keyVals = i.call(ctx, info.FullMethod, start, err)
+		if i.payloads != nil && i.payloads(info.FullMethod) {
+			keyVals = append(keyVals, RequestKey, req)
+			if err == nil {
+				keyVals = append(keyVals, ResponseKey, resp)
+			}
+		}
+		i.logCall(err, keyVals)
+		return resp, err
+	}
+}
+
+// Stream returns the interceptor for the streaming calls.
+func (i *Interceptors) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var (
+			start = time.Now()
+			ctx   = i.scoped(ss.Context(), info.FullMethod)
+		)
+		var err = handler(srv, &scopedStream{ServerStream: ss, ctx: ctx})
+		var keyVals = i.call(ctx, info.FullMethod, start, err)
+		keyVals = append(keyVals, StreamKey, true)
+		i.logCall(err, keyVals)
+		return err
+	}
+}
+
+// UnaryServerInterceptor returns the interceptor for the unary calls
+// that logs them with the logger (see New()).
+func UnaryServerInterceptor(log *kiwi.Logger) grpc.UnaryServerInterceptor {
+	return New(log).Unary()
+}
+
+// StreamServerInterceptor returns the interceptor for the streaming
+// calls that logs them with the logger (see New()).
+func StreamServerInterceptor(log *kiwi.Logger) grpc.StreamServerInterceptor {
+	return New(log).Stream()
+}
+
+// scoped returns the context with the call scoped logger.
+func (i *Interceptors) scoped(ctx context.Context, method string) context.Context {
+	return kiwi.ToContext(ctx, i.log.Clone(MethodKey, method))
+}
+
+// call returns the pairs of the call record.
+func (i *Interceptors) call(ctx context.Context, method string, start time.Time, err error) []interface{} {
+	var keyVals = make([]interface{}, 0, 16)
+	keyVals = append(keyVals, MethodKey, method)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		keyVals = append(keyVals, PeerKey, p.Addr.String())
+	}
+	keyVals = append(keyVals, CodeKey, status.Code(err).String(), kiwi.ElapsedKey, time.Since(start))
+	if err != nil {
+		keyVals = append(keyVals, ErrorKey, status.Convert(err).Message())
+	}
+	return keyVals
+}
+
+// logCall logs the record of the call with the level of its status
+// code.
+func (i *Interceptors) logCall(err error, keyVals []interface{}) {
+	var log = i.log.Fork()
+	switch CodeLevel(status.Code(err)) {
+	case "error":
+		log.Error(keyVals...)
+	case "warning":
+		log.Warn(keyVals...)
+	default:
+		log.Info(keyVals...)
+	}
+}
+
+// CodeLevel returns the level of the record for the status code of
+// the call. The calls rejected because of the client requests are
+// logged with "info" level, the calls that could point to the
+// problems of the server or its dependencies with "warning" level and
+// the server failures with "error" level.
+func CodeLevel(code codes.Code) string {
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound,
+		codes.AlreadyExists, codes.Unauthenticated:
+		return "info"
+	case codes.DeadlineExceeded, codes.PermissionDenied, codes.ResourceExhausted,
+		codes.FailedPrecondition, codes.Aborted, codes.OutOfRange, codes.Unavailable:
+		return "warning"
+	}
+	return "error"
+}
+
+// scopedStream replaces the context of the stream.
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *scopedStream) Context() context.Context {
+	return s.ctx
+}
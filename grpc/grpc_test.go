@@ -0,0 +1,170 @@
+//go:build grpc
+// +build grpc
+
+package grpc
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafov/kiwi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Test of the levels of the status codes.
+func TestCodeLevel(t *testing.T) {
+	cases := []struct {
+		code     codes.Code
+		expected string
+	}{
+		{codes.OK, "info"},
+		{codes.Canceled, "info"},
+		{codes.InvalidArgument, "info"},
+		{codes.NotFound, "info"},
+		{codes.AlreadyExists, "info"},
+		{codes.Unauthenticated, "info"},
+		{codes.DeadlineExceeded, "warning"},
+		{codes.PermissionDenied, "warning"},
+		{codes.ResourceExhausted, "warning"},
+		{codes.FailedPrecondition, "warning"},
+		{codes.Aborted, "warning"},
+		{codes.OutOfRange, "warning"},
+		{codes.Unavailable, "warning"},
+		{codes.Unknown, "error"},
+		{codes.Unimplemented, "error"},
+		{codes.Internal, "error"},
+		{codes.DataLoss, "error"},
+	}
+
+	for _, c := range cases {
+		level := CodeLevel(c.code)
+
+		if level != c.expected {
+			t.Logf("for %s expected %s got %s", c.code, c.expected, level)
+			t.Fail()
+		}
+	}
+}
+
+// Test of the pairs of the call records.
+func TestInterceptors_Call(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 52100}
+	withPeer := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	cases := []struct {
+		ctx      context.Context
+		err      error
+		expected []interface{}
+	}{
+		{context.Background(), nil,
+			[]interface{}{MethodKey, "/users.Users/Get", CodeKey, "OK"}},
+		{withPeer, nil,
+			[]interface{}{MethodKey, "/users.Users/Get", PeerKey, "10.0.0.1:52100", CodeKey, "OK"}},
+		{withPeer, status.Error(codes.NotFound, "no user"),
+			[]interface{}{MethodKey, "/users.Users/Get", PeerKey, "10.0.0.1:52100", CodeKey, "NotFound", ErrorKey, "no user"}},
+		{context.Background(), errors.New("broken"),
+			[]interface{}{MethodKey, "/users.Users/Get", CodeKey, "Unknown", ErrorKey, "broken"}},
+	}
+	i := New(kiwi.New())
+
+	for _, c := range cases {
+		keyVals := i.call(c.ctx, "/users.Users/Get", time.Now().Add(-time.Second), c.err)
+
+		// The elapsed time is checked separately because it varies.
+		var elapsed time.Duration
+		for n := 0; n+1 < len(keyVals); n += 2 {
+			if keyVals[n] == kiwi.ElapsedKey {
+				elapsed, _ = keyVals[n+1].(time.Duration)
+				keyVals = append(keyVals[:n:n], keyVals[n+2:]...)
+				break
+			}
+		}
+		if elapsed < time.Second || !equal(keyVals, c.expected) {
+			t.Logf("for %v expected %v got %v with elapsed %s", c.err, c.expected, keyVals, elapsed)
+			t.Fail()
+		}
+	}
+}
+
+// Test of the record of the unary call logged with the level of its
+// status code.
+func TestInterceptors_UnaryLevel(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := kiwi.New().With("svc", "users")
+	out := kiwi.SinkTo(output, kiwi.AsLogfmt()).HasValue("svc", "users").Start()
+	defer out.Close()
+	unary := New(log).Unary()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "db down")
+	}
+
+	_, err := unary(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/users.Users/Get"}, handler)
+
+	out.Flush()
+	if status.Code(err) != codes.Internal ||
+		!strings.HasPrefix(output.String(), `svc="users" level="error" grpc.method="/users.Users/Get" grpc.code="Internal" elapsed=`) ||
+		!strings.HasSuffix(strings.TrimSpace(output.String()), `error="db down"`) {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// equal compares the key-value pairs.
+func equal(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package kiwi
+
+// This file consists of the guards against the key cardinality explosions.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// Policies applied to the records that break the guard limits.
+const (
+	// GuardWarn writes the record with the warning under ErrorKey.
+	GuardWarn = iota
+	// GuardDrop drops the record.
+	GuardDrop
+)
+
+type keyGuard struct {
+	maxKeys  int
+	maxPairs int
+	policy   int
+	// seen is accessed by the sink goroutine only
+	seen map[string]struct{}
+}
+
+// Guard protects the backends that index the keys (Elasticsearch,
+// Loki etc.) from the mapping explosions caused by the buggy callers.
+// The sink tracks the distinct keys it has written and the records
+// that bring new keys when maxKeys distinct keys already seen break
+// the limit. The records with more than maxPairs pairs break the
+// limit too. Such records are written with the warning under
+// ErrorKey or dropped according to the policy (GuardWarn or
+// GuardDrop) and counted by Stats(). Zero limits disable the checks.
+func (s *Sink) Guard(maxKeys, maxPairs, policy int) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if maxKeys <= 0 && maxPairs <= 0 {
+			s.guard = nil
+		} else {
+			s.guard = &keyGuard{
+				maxKeys:  maxKeys,
+				maxPairs: maxPairs,
+				policy:   policy,
+				seen:     make(map[string]struct{}),
+			}
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// check returns the warning when the record breaks the limits of the
+// guard.
+func (g *keyGuard) check(record []*Pair) string {
+	if g.maxPairs > 0 && len(record) > g.maxPairs {
+		return "too many pairs in the record: " + strconv.Itoa(len(record)) + " > " + strconv.Itoa(g.maxPairs)
+	}
+	if g.maxKeys <= 0 {
+		return ""
+	}
+	var warning string
+	for _, pair := range record {
+		if _, ok := g.seen[pair.Key]; ok {
+			continue
+		}
+		if len(g.seen) >= g.maxKeys {
+			warning = "too many distinct keys, new key " + strconv.Quote(pair.Key) + " over the limit " + strconv.Itoa(g.maxKeys)
+			continue
+		}
+		g.seen[pair.Key] = struct{}{}
+	}
+	return warning
+}
+
+// guarded applies the guard of the sink to the record. It returns
+// the record with the warning or nil when the record should be
+// dropped.
+func (s *Sink) guarded(record []*Pair) []*Pair {
+	var warning = s.guard.check(record)
+	if warning == "" {
+		return record
+	}
+	atomic.AddUint64(&s.stats.guarded, 1)
+	if s.guard.policy == GuardDrop {
+		return nil
+	}
+	var result = make([]*Pair, len(record), len(record)+1)
+	copy(result, record)
+	return append(result, &Pair{ErrorKey, warning, nil, StringVal})
+}
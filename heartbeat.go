@@ -0,0 +1,119 @@
+package kiwi
+
+// This file consists of the heartbeat records of the sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Keys of the heartbeat record.
+var (
+	HeartbeatKey         = "kiwi_heartbeat"
+	HeartbeatIntervalKey = "interval"
+)
+
+type heartbeat struct {
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// Heartbeat says the sink to write the synthetic record when no
+// records have been written for the interval:
+//
+//	kiwi_heartbeat=1 interval="30s"
+//
+// So the downstream pipelines could distinguish "no logs" from
+// "pipeline broken". The heartbeat records bypass the filters of the
+// sink and they are not written while the sink stopped. Zero interval
+// disables the heartbeat.
+func (s *Sink) Heartbeat(interval time.Duration) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if s.heartbeat != nil {
+			close(s.heartbeat.stop)
+			s.heartbeat = nil
+		}
+		if interval > 0 {
+			s.heartbeat = &heartbeat{interval, make(chan struct{})}
+			atomic.StoreInt64(&s.lastWrite, time.Now().UnixNano())
+			go s.heartbeats(s.heartbeat)
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// heartbeats passes the heartbeat records to the sink queue when the
+// sink is idle.
+func (s *Sink) heartbeats(b *heartbeat) {
+	var timer = time.NewTimer(b.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-timer.C:
+		}
+		var state = atomic.LoadInt32(s.state)
+		if state == sinkClosed {
+			return
+		}
+		var wait = b.interval - time.Duration(time.Now().UnixNano()-atomic.LoadInt64(&s.lastWrite))
+		if wait <= 0 {
+			if state == sinkActive {
+				s.beat(b.interval)
+			}
+			wait = b.interval
+		}
+		timer.Reset(wait)
+	}
+}
+
+// beat passes the heartbeat record to the sink and waits until it is
+// written.
+func (s *Sink) beat(interval time.Duration) {
+	s.inject([]*Pair{
+		{HeartbeatKey, "1", nil, IntegerVal},
+		toPair(HeartbeatIntervalKey, interval)})
+}
+
+// stopHeartbeat stops the heartbeat of the closed sink.
+func (s *Sink) stopHeartbeat() {
+	s.Lock()
+	if s.heartbeat != nil {
+		close(s.heartbeat.stop)
+		s.heartbeat = nil
+	}
+	s.Unlock()
+}
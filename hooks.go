@@ -0,0 +1,105 @@
+package kiwi
+
+// This file consists of the hooks called before the records are sinked.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Hook is called with the pairs of the record before the record is
+// passed to the sinks. It could add, change or remove the pairs.
+type Hook func(record *[]*Pair)
+
+// hooks keeps []Hook. The slice is replaced by a copy on each change
+// so the loggers need no locks.
+var (
+	hooks     atomic.Value
+	hooksLock sync.Mutex
+)
+
+// NewPair creates the pair for the key and the value converted the
+// same way as the values passed to Log(). It is useful in the hooks:
+//
+//	kiwi.AddHook(func(record *[]*kiwi.Pair) {
+//		*record = append(*record, kiwi.NewPair("version", version))
+//	})
+func NewPair(key string, val interface{}) *Pair {
+	return toPair(key, val)
+}
+
+// AddHook adds the hook called for the records of all the loggers.
+// So the enrichment of the records (hostname, build version, trace
+// IDs etc.) is applied once instead of in each logger. The hooks are
+// called in order of adding after the hooks of the logger (see
+// Logger.AddHook()).
+func AddHook(fn Hook) {
+	hooksLock.Lock()
+	var old, _ = hooks.Load().([]Hook)
+	var h = make([]Hook, len(old), len(old)+1)
+	copy(h, old)
+	hooks.Store(append(h, fn))
+	hooksLock.Unlock()
+}
+
+// ResetHooks removes all the hooks added by AddHook().
+func ResetHooks() {
+	hooksLock.Lock()
+	hooks.Store([]Hook(nil))
+	hooksLock.Unlock()
+}
+
+// AddHook adds the hook called for the records of the logger. The
+// forked loggers inherit the hooks.
+func (l *Logger) AddHook(fn Hook) *Logger {
+	l.hooks = append(l.hooks[:len(l.hooks):len(l.hooks)], fn)
+	return l
+}
+
+// runHooks calls the hooks of the logger and then the global hooks.
+func runHooks(own []Hook, record []*Pair) []*Pair {
+	var shared, _ = hooks.Load().([]Hook)
+	if len(own) == 0 && len(shared) == 0 {
+		return record
+	}
+	// The copy escapes to the heap, so it is made only when there
+	// are hooks to call.
+	var hooked = record
+	for _, fn := range own {
+		fn(&hooked)
+	}
+	for _, fn := range shared {
+		fn(&hooked)
+	}
+	return hooked
+}
@@ -0,0 +1,89 @@
+//go:build echo
+// +build echo
+
+package echolog
+
+// Adapter of kiwi request logging for labstack/echo framework. Build with "echo" tag.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"net/http"
+
+	"github.com/grafov/kiwi"
+	"github.com/grafov/kiwi/httplog"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware returns echo middleware that logs the requests with the
+// route pattern and the path parameters. The error returned by the
+// handler is passed to the echo error handler before logging so the
+// record has the actual status. The panics of the handlers are
+// recovered and logged, the client gets 500 status (see
+// httplog.Middleware()):
+//
+//	e := echo.New()
+//	e.Use(echolog.Middleware(log))
+func Middleware(log *kiwi.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var entry = httplog.Begin(log, c.Request())
+			c.SetRequest(entry.Request())
+			defer func() {
+				if p := recover(); p != nil {
+					if p == http.ErrAbortHandler {
+						panic(p)
+					}
+					entry.Panic(p)
+					if !c.Response().Committed {
+						c.NoContent(http.StatusInternalServerError)
+					}
+				}
+				var (
+					names  = c.ParamNames()
+					values = c.ParamValues()
+					params = make(map[string]string, len(names))
+				)
+				for i, name := range names {
+					if i < len(values) {
+						params[name] = values[i]
+					}
+				}
+				entry.Route(c.Path(), params)
+				entry.End(c.Response().Status, c.Response().Size)
+			}()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			return nil
+		}
+	}
+}
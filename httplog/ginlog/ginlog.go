@@ -0,0 +1,74 @@
+//go:build gin
+// +build gin
+
+package ginlog
+
+// Adapter of kiwi request logging for gin-gonic/gin framework. Build with "gin" tag.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grafov/kiwi"
+	"github.com/grafov/kiwi/httplog"
+)
+
+// Middleware returns gin middleware that logs the requests with the
+// route pattern and the route parameters. The panics of the handlers
+// are recovered and logged, the client gets 500 status (see
+// httplog.Middleware()):
+//
+//	r := gin.New()
+//	r.Use(ginlog.Middleware(log))
+func Middleware(log *kiwi.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var entry = httplog.Begin(log, c.Request)
+		c.Request = entry.Request()
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				entry.Panic(p)
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+			var params = make(map[string]string, len(c.Params))
+			for _, param := range c.Params {
+				params[param.Key] = param.Value
+			}
+			entry.Route(c.FullPath(), params)
+			entry.End(c.Writer.Status(), int64(c.Writer.Size()))
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,237 @@
+package httplog
+
+// Middleware that logs HTTP requests served by net/http handlers.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/grafov/kiwi"
+)
+
+// Keys of the access log records. The time spent for the request is
+// logged under kiwi.ElapsedKey.
+var (
+	MethodKey   = "method"
+	PathKey     = "path"
+	RouteKey    = "route"
+	StatusKey   = "status"
+	BytesKey    = "bytes"
+	RemoteKey   = "remote"
+	PanicKey    = "panic"
+	ParamPrefix = "param."
+)
+
+// RouteFunc returns the route pattern matched by the router and the
+// values of the route parameters. It is called after the handler
+// returned so the routers could fill the route in the request
+// context.
+type RouteFunc func(r *http.Request) (pattern string, params map[string]string)
+
+// Handler wraps the handler with the middleware that logs each
+// request (see Middleware()):
+//
+//	http.ListenAndServe(":8080", httplog.Handler(mux, log))
+func Handler(next http.Handler, log *kiwi.Logger) http.Handler {
+	return Middleware(log)(next)
+}
+
+// Middleware returns net/http middleware that logs each request
+// served by the handler:
+//
+//	http.ListenAndServe(":8080", httplog.Middleware(log)(mux))
+//	// method="GET" path="/users/12" status=200 bytes=312 remote="10.0.0.1:52100" elapsed="1.2ms"
+//
+// The panic of the handler is recovered and logged with the stack
+// trace, the client gets 500 status if nothing was written yet. The
+// records are logged by the logger forked from the log for each
+// request. Nil log means the global logger.
+//
+// The context of the request passed to the handler carries the
+// request scoped logger with the method and the path of the request
+// in its context:
+//
+//	kiwi.FromContext(r.Context()).Log("msg", "user found")
+//	// method="GET" path="/users/12" msg="user found"
+
+func Middleware(log *kiwi.Logger) func(http.Handler) http.Handler {
+	return MiddlewareWithRoute(log, nil)
+}
+
+// MiddlewareWithRoute is the same as Middleware() but it logs the
+// route pattern and the route parameters returned by the function.
+// It is the base for the adapters of the routers.
+func MiddlewareWithRoute(log *kiwi.Logger, route RouteFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				entry = Begin(log, r)
+				sw    = &statusWriter{ResponseWriter: w}
+			)
+			defer func() {
+				if p := recover(); p != nil {
+					if p == http.ErrAbortHandler {
+						// The handler aborts the response
+						// intentionally.
+						panic(p)
+					}
+					entry.Panic(p)
+					if sw.status == 0 {
+						sw.WriteHeader(http.StatusInternalServerError)
+					}
+				}
+				if route != nil {
+					entry.Route(route(r))
+				}
+				entry.End(sw.Status(), sw.bytes)
+			}()
+			next.ServeHTTP(sw, entry.Request())
+		})
+	}
+}
+
+// Entry collects the details of the request for the access log
+// record. It is used by the adapters for the web frameworks that have
+// their own middleware interfaces.
+type Entry struct {
+	log    *kiwi.Logger
+	req    *http.Request
+	start  time.Time
+	route  string
+	params map[string]string
+	panic  interface{}
+	stack  []byte
+}
+
+// Begin starts the entry for the request.
+func Begin(log *kiwi.Logger, r *http.Request) *Entry {
+	if log == nil {
+		log = kiwi.Fork()
+	} else {
+		log = log.Fork()
+	}
+	var scoped = log.Fork().With(MethodKey, r.Method, PathKey, r.URL.Path)
+	return &Entry{log: log, req: r.WithContext(kiwi.ToContext(r.Context(), scoped)), start: time.Now()}
+}
+
+// Request returns the request with the context that carries the
+// request scoped logger (see kiwi.FromContext()). It should be passed
+// to the next handlers.
+func (e *Entry) Request() *http.Request {
+	return e.req
+}
+
+// Route sets the route pattern and the route parameters of the
+// request.
+func (e *Entry) Route(pattern string, params map[string]string) {
+	e.route = pattern
+	e.params = params
+}
+
+// Panic keeps the value of the recovered panic with the stack trace.
+// It should be called in the deferred function that recovered the
+// panic.
+func (e *Entry) Panic(p interface{}) {
+	e.panic = p
+	e.stack = debug.Stack()
+}
+
+// End logs the access log record with the response status and the
+// size of the response body.
+func (e *Entry) End(status int, bytes int64) {
+	var keyVals = make([]interface{}, 0, 20+len(e.params)*2)
+	keyVals = append(keyVals, MethodKey, e.req.Method, PathKey, e.req.URL.Path)
+	if e.route != "" {
+		keyVals = append(keyVals, RouteKey, e.route)
+	}
+	var keys = make([]string, 0, len(e.params))
+	for key := range e.params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		keyVals = append(keyVals, ParamPrefix+key, e.params[key])
+	}
+	keyVals = append(keyVals,
+		StatusKey, status,
+		BytesKey, bytes,
+		RemoteKey, e.req.RemoteAddr,
+		kiwi.ElapsedKey, time.Since(e.start))
+	if e.panic != nil {
+		keyVals = append(keyVals, PanicKey, fmt.Sprint(e.panic), kiwi.StackKey, string(e.stack))
+	}
+	e.log.Log(keyVals...)
+}
+
+// statusWriter remembers the status and counts the bytes of the
+// response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush supports streaming responses.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Status returns the status of the response. The handler that wrote
+// nothing responds with 200.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,109 @@
+package httplog
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafov/kiwi"
+)
+
+// Test the access log record with the route.
+func TestMiddleware_LogRequest(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := kiwi.SinkTo(output, kiwi.AsLogfmt()).HasKey(RouteKey).Start()
+	handler := MiddlewareWithRoute(kiwi.New(), func(*http.Request) (string, map[string]string) {
+		return "/users/{id}", map[string]string{"id": "12"}
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users/12", nil))
+
+	out.Close()
+	expected := `method="POST" path="/users/12" route="/users/{id}" param.id="12" status=201 bytes=7 remote="192.0.2.1:1234" elapsed=`
+	if !strings.HasPrefix(output.String(), expected) {
+		t.Logf("expected %s got %s", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test the panic of the handler recovered and logged.
+func TestMiddleware_RecoverPanic(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := kiwi.SinkTo(output, kiwi.AsLogfmt()).HasKey(PanicKey).Start()
+	handler := Middleware(kiwi.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	response := httptest.NewRecorder()
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+
+	out.Close()
+	if response.Code != http.StatusInternalServerError ||
+		!strings.Contains(output.String(), `status=500`) || !strings.Contains(output.String(), `panic="boom" stack=`) {
+		t.Logf("expected the logged panic and 500 status got %d: %s", response.Code, output.String())
+		t.Fail()
+	}
+}
+
+// Test the request scoped logger carried by the request context.
+func TestHandler_ScopedLogger(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := kiwi.SinkTo(output, kiwi.AsLogfmt()).HasKey("scoped-key").Start()
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kiwi.FromContext(r.Context()).Log("scoped-key", "found")
+	}), kiwi.New())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/12", nil))
+
+	out.Close()
+	expected := `method="GET" path="/users/12" scoped-key="found" ` + "\n"
+	if !strings.HasPrefix(output.String(), expected) {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
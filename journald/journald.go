@@ -0,0 +1,225 @@
+package journald
+
+// Formatter and writer for the native protocol of systemd journal.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/grafov/kiwi"
+)
+
+var (
+	// SocketPath is the socket of the journal.
+	SocketPath = "/run/systemd/journal/socket"
+	// SeverityKey is the key of the record level mapped to PRIORITY
+	// field.
+	SeverityKey = kiwi.SeverityKey
+	// Priorities maps the values of SeverityKey to the journal
+	// priorities (the same as syslog severities). The records
+	// without the key or with unknown values get DefaultPriority.
+	Priorities = map[string]int{
+		"emergency": 0,
+		"fatal":     0,
+		"alert":     1,
+		"critical":  2,
+		"error":     3,
+		"warning":   4,
+		"warn":      4,
+		"notice":    5,
+		"info":      6,
+		"debug":     7,
+	}
+	// DefaultPriority is "informational".
+	DefaultPriority = 6
+)
+
+type formatJournal struct {
+	identifier string
+	priority   int
+	fields     *bytes.Buffer
+	line       *bytes.Buffer
+}
+
+// AsJournal says that a sink formats the records as the entries of
+// the journal native protocol. The keys converted to the journal
+// field names: uppercased, the chars other than letters, digits and
+// '_' replaced with '_'. The text under kiwi.MessageKey goes to
+// MESSAGE field and the level (see SeverityKey) is mapped to
+// PRIORITY:
+//
+//	w, err := journald.Dial()
+//	kiwi.SinkTo(w, journald.AsJournal("billing")).Start()
+//	// journalctl -o verbose: MESSAGE=invoice sent, PRIORITY=6, USER_ID=12
+//
+// Empty identifier means the name of the program.
+func AsJournal(identifier string) *formatJournal {
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	return &formatJournal{
+		identifier: identifier,
+		fields:     bytes.NewBuffer(make([]byte, 0, 512)),
+		line:       bytes.NewBuffer(make([]byte, 0, 512)),
+	}
+}
+
+func (f *formatJournal) Begin() {
+	f.priority = DefaultPriority
+	f.fields.Reset()
+	f.line.Reset()
+}
+
+func (f *formatJournal) Pair(key, val string, valType int) {
+	switch key {
+	case SeverityKey:
+		if priority, ok := Priorities[strings.ToLower(val)]; ok {
+			f.priority = priority
+		}
+	case kiwi.MessageKey:
+		writeField(f.fields, "MESSAGE", val)
+		return
+	}
+	writeField(f.fields, FieldName(key), val)
+}
+
+func (f *formatJournal) Finish() []byte {
+	writeField(f.line, "PRIORITY", string(rune('0'+f.priority)))
+	writeField(f.line, "SYSLOG_IDENTIFIER", f.identifier)
+	f.line.Write(f.fields.Bytes())
+	return f.line.Bytes()
+}
+
+// writeField writes the field in the journal format. The values with
+// line breaks are written with the explicit length.
+func writeField(buf *bytes.Buffer, name, val string) {
+	buf.WriteString(name)
+	if strings.IndexByte(val, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.WriteString(val)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(val)))
+	buf.Write(size[:])
+	buf.WriteString(val)
+	buf.WriteByte('\n')
+}
+
+// FieldName converts the key to the journal field name. The names
+// starting with '_' are reserved for the trusted fields so the
+// leading underscores are removed, the names starting with a digit
+// are prefixed with "X_". The names are limited to 64 chars.
+func FieldName(key string) string {
+	var name = []byte(strings.ToUpper(strings.TrimLeft(key, "_")))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "X"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = append([]byte("X_"), name...)
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return string(name)
+}
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("journald writer closed")
+
+// Writer sends the entries to the journal, one entry per Write()
+// call. So the sink should not batch the writes (see
+// kiwi.Sink.Batch()). The entries larger than the datagram limit are
+// passed in the sealed memory file on Linux. Writer methods are safe
+// for concurrent usage.
+type Writer struct {
+	sync.Mutex
+	conn *net.UnixConn
+}
+
+// Dial connects to the journal socket (see SocketPath).
+func Dial() (*Writer, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: SocketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{conn: conn}, nil
+}
+
+// Write sends a single entry.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.conn == nil {
+		return 0, ErrClosed
+	}
+	_, err := w.conn.Write(p)
+	if err != nil && isMessageTooLong(err) {
+		err = sendFile(w.conn, p)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *Writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.conn == nil {
+		return ErrClosed
+	}
+	var err = w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func isMessageTooLong(err error) bool {
+	var errno syscall.Errno
+	return errors.As(err, &errno) && (errno == syscall.EMSGSIZE || errno == syscall.ENOBUFS)
+}
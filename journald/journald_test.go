@@ -0,0 +1,106 @@
+package journald
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafov/kiwi"
+)
+
+// Test of the entry format.
+func TestAsJournal_Format(t *testing.T) {
+	f := AsJournal("test")
+	f.Begin()
+	f.Pair("level", "warning", kiwi.StringVal)
+	f.Pair(kiwi.MessageKey, "failed", kiwi.StringVal)
+	f.Pair("user-id", "12", kiwi.IntegerVal)
+	f.Pair("stack", "a\nb", kiwi.StringVal)
+	entry := string(f.Finish())
+
+	expected := "PRIORITY=4\nSYSLOG_IDENTIFIER=test\nLEVEL=warning\nMESSAGE=failed\nUSER_ID=12\nSTACK\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"
+	if entry != expected {
+		t.Logf("expected %q got %q", expected, entry)
+		t.Fail()
+	}
+}
+
+// Test of sending the entry to the journal socket.
+func TestWriter_Send(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	SocketPath = filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: SocketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close()
+	w, err := Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte("MESSAGE=hi\n"))
+
+	w.Close()
+	buf := make([]byte, 64)
+	n, _ := conn.Read(buf)
+	if string(buf[:n]) != "MESSAGE=hi\n" {
+		t.Logf("unexpected entry %q", buf[:n])
+		t.Fail()
+	}
+}
+
+// Test of the field names conversion.
+func TestFieldName(t *testing.T) {
+	for key, expected := range map[string]string{"_pid": "PID", "1st": "X_1ST", "a.b-c": "A_B_C", "": "X"} {
+		if name := FieldName(key); name != expected {
+			t.Logf("expected %s for %q got %s", expected, key, name)
+			t.Fail()
+		}
+	}
+}
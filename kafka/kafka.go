@@ -0,0 +1,352 @@
+package kafka
+
+// Sink writer that publishes log records to Kafka topic.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafov/kiwi"
+)
+
+// Defaults for the writer. They may be changed per writer with
+// BatchSize(), FlushInterval() and MaxPending() methods.
+var (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 100 * time.Millisecond
+	DefaultMaxPending    = 10000
+)
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("kafka writer closed")
+
+// Message is the single record published to the topic.
+type Message struct {
+	Topic string
+	// Key selects the partition of the topic. It is nil when the
+	// partition key is not set or the record has no such pair.
+	Key   []byte
+	Value []byte
+}
+
+// Producer publishes the messages to Kafka. The package has no Kafka
+// client itself so the producer adapts the client of your choice
+// (github.com/IBM/sarama, github.com/segmentio/kafka-go,
+// github.com/twmb/franz-go etc.). Produce should return when all the
+// messages were delivered or return the error otherwise.
+type Producer interface {
+	Produce(messages []Message) error
+}
+
+// ProducerFunc is the function that conforms Producer interface.
+type ProducerFunc func(messages []Message) error
+
+// Produce calls the function.
+func (f ProducerFunc) Produce(messages []Message) error {
+	return f(messages)
+}
+
+// ErrorHandler is called with the messages that were not delivered.
+type ErrorHandler func(err error, messages []Message)
+
+// Writer collects formatted records and publishes them to the topic
+// in batches. It conforms io.Writer so it may be used as the output
+// for kiwi.SinkTo(). Wrap the formatter of the sink with Format() for
+// selecting the partitions by the value of the record:
+//
+//	w := kafka.New(producer, "logs").PartitionKey("tenant_id")
+//	kiwi.SinkTo(w, w.Format(kiwi.AsJSON())).Start()
+//
+// The records kept in the memory until the batch is full or the flush
+// interval is expired. If the delivery failed the messages are passed
+// to the error handler (see OnError()) and they stay pending until
+// the next flush. Writer methods are safe for concurrent usage.
+type Writer struct {
+	producer Producer
+	topic    string
+
+	sync.Mutex
+	keyName    string
+	key        []byte
+	onError    ErrorHandler
+	batchSize  int
+	maxPending int
+	interval   time.Duration
+	pending    []Message
+	dropped    int
+	lastErr    error
+	closed     bool
+	started    sync.Once
+	flushing   sync.Mutex
+	flush      chan struct{}
+	done       chan struct{}
+}
+
+// New creates a writer for the topic.
+func New(p Producer, topic string) *Writer {
+	return &Writer{
+		producer:   p,
+		topic:      topic,
+		batchSize:  DefaultBatchSize,
+		maxPending: DefaultMaxPending,
+		interval:   DefaultFlushInterval,
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// PartitionKey sets the key of the record pair which value used as
+// the key of the message. So the records with the same value (of the
+// same tenant for example) go to the same partition and keep their
+// order. It works only with the formatter wrapped by Format().
+func (w *Writer) PartitionKey(key string) *Writer {
+	w.Lock()
+	w.keyName = key
+	w.Unlock()
+	return w
+}
+
+// OnError sets the handler for the messages that were not delivered.
+// It is called from the goroutine that flushes the writer.
+func (w *Writer) OnError(fn ErrorHandler) *Writer {
+	w.Lock()
+	w.onError = fn
+	w.Unlock()
+	return w
+}
+
+// BatchSize sets number of the messages that published at once.
+func (w *Writer) BatchSize(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.batchSize = n
+		w.Unlock()
+	}
+	return w
+}
+
+// FlushInterval sets how long the records may wait in the memory
+// until the batch will be filled. It should be set before the first
+// record will be written.
+func (w *Writer) FlushInterval(d time.Duration) *Writer {
+	if d > 0 {
+		w.Lock()
+		w.interval = d
+		w.Unlock()
+	}
+	return w
+}
+
+// MaxPending restricts number of the messages kept in the memory when
+// Kafka is unavailable. The oldest messages are dropped when the
+// limit is reached.
+func (w *Writer) MaxPending(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.maxPending = n
+		w.Unlock()
+	}
+	return w
+}
+
+// Format wraps the formatter of the sink so the writer gets the value
+// of the partition key of each record. The writer with the wrapped
+// formatter should be used by the single sink.
+func (w *Writer) Format(f kiwi.Formatter) kiwi.Formatter {
+	var k = &keyFormat{Formatter: f, w: w}
+	if t, ok := f.(kiwi.TypedFormatter); ok {
+		return &typedKeyFormat{keyFormat: k, typed: t}
+	}
+	return k
+}
+
+// Write adds a single formatted record to the batch. It never blocks
+// on Kafka. It returns the error of the last failed flush if any, the
+// error is reported only once.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.started.Do(func() { go w.flusher() })
+	var value = bytes.TrimRight(p, "\r\n")
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return 0, ErrClosed
+	}
+	var key = w.key
+	w.key = nil
+	if len(value) > 0 {
+		if len(w.pending) >= w.maxPending {
+			w.pending = w.pending[1:]
+			w.dropped++
+		}
+		w.pending = append(w.pending, Message{
+			Topic: w.topic,
+			Key:   key,
+			Value: append([]byte(nil), value...),
+		})
+	}
+	var full = len(w.pending) >= w.batchSize
+	var err = w.lastErr
+	w.lastErr = nil
+	w.Unlock()
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), err
+}
+
+// Dropped returns number of the messages that were dropped because of
+// MaxPending limit.
+func (w *Writer) Dropped() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.dropped
+}
+
+// Flush publishes all pending messages.
+func (w *Writer) Flush() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+	for {
+		w.Lock()
+		var n = len(w.pending)
+		if n > w.batchSize {
+			n = w.batchSize
+		}
+		var (
+			batch   = w.pending[:n:n]
+			onError = w.onError
+		)
+		w.pending = w.pending[n:]
+		w.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := w.producer.Produce(batch); err != nil {
+			if onError != nil {
+				onError(err, batch)
+			}
+			// Return the failed batch back to the head of the queue.
+			w.Lock()
+			w.pending = append(batch, w.pending...)
+			if extra := len(w.pending) - w.maxPending; extra > 0 {
+				w.pending = w.pending[extra:]
+				w.dropped += extra
+			}
+			w.lastErr = err
+			w.Unlock()
+			return err
+		}
+	}
+}
+
+// Close flushes pending messages and stops the writer. It not closes
+// the producer.
+func (w *Writer) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.Unlock()
+	w.started.Do(func() {})
+	close(w.done)
+	return w.Flush()
+}
+
+func (w *Writer) flusher() {
+	w.Lock()
+	var ticker = time.NewTicker(w.interval)
+	w.Unlock()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.flush:
+		}
+		w.Flush()
+	}
+}
+
+// keyFormat passes the pairs to the formatter and keeps the value of
+// the partition key for the next Write().
+type keyFormat struct {
+	kiwi.Formatter
+	w    *Writer
+	name string
+	key  []byte
+}
+
+func (f *keyFormat) Begin() {
+	f.w.Lock()
+	f.name = f.w.keyName
+	f.w.Unlock()
+	f.key = nil
+	f.Formatter.Begin()
+}
+
+func (f *keyFormat) Pair(key, val string, valType int) {
+	f.keep(key, val)
+	f.Formatter.Pair(key, val, valType)
+}
+
+func (f *keyFormat) Finish() []byte {
+	f.w.Lock()
+	f.w.key = f.key
+	f.w.Unlock()
+	return f.Formatter.Finish()
+}
+
+func (f *keyFormat) keep(key, val string) {
+	if key == f.name && f.name != "" {
+		f.key = []byte(val)
+	}
+}
+
+type typedKeyFormat struct {
+	*keyFormat
+	typed kiwi.TypedFormatter
+}
+
+func (f *typedKeyFormat) TypedPair(key string, val interface{}, valType int) {
+	f.keep(key, fmt.Sprint(val))
+	f.typed.TypedPair(key, val, valType)
+}
@@ -0,0 +1,112 @@
+package kafka
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/grafov/kiwi"
+)
+
+// fakeProducer keeps the published messages.
+type fakeProducer struct {
+	sync.Mutex
+	messages []Message
+	fail     bool
+}
+
+func (p *fakeProducer) Produce(messages []Message) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.fail {
+		return errors.New("leader not available")
+	}
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+// Test of the partition key taken from the record.
+func TestWriter_PartitionKey(t *testing.T) {
+	p := new(fakeProducer)
+	w := New(p, "logs").PartitionKey("tenant_id")
+	out := kiwi.SinkTo(w, w.Format(kiwi.AsLogfmt())).HasKey("kafka-key").Start()
+
+	kiwi.Log("kafka-key", 1, "tenant_id", "acme")
+	kiwi.Log("kafka-key", 2)
+	out.Flush()
+
+	p.Lock()
+	defer p.Unlock()
+	if len(p.messages) != 2 {
+		t.Fatalf("expected 2 messages got %d", len(p.messages))
+	}
+	if p.messages[0].Topic != "logs" || string(p.messages[0].Key) != "acme" || string(p.messages[0].Value) != `kafka-key=1 tenant_id="acme" ` {
+		t.Logf("unexpected message %+v", p.messages[0])
+		t.Fail()
+	}
+	if p.messages[1].Key != nil || string(p.messages[1].Value) != "kafka-key=2 " {
+		t.Logf("unexpected message %+v", p.messages[1])
+		t.Fail()
+	}
+	out.Close()
+}
+
+// Test the undelivered messages passed to the handler and kept.
+func TestWriter_OnError(t *testing.T) {
+	p := &fakeProducer{fail: true}
+	var failed int
+	w := New(p, "logs").OnError(func(err error, messages []Message) {
+		failed += len(messages)
+	})
+
+	w.Write([]byte("a=1\n"))
+	err := w.Flush()
+	p.fail = false
+	w.Flush()
+
+	if err == nil || failed != 1 || len(p.messages) != 1 || string(p.messages[0].Value) != "a=1" {
+		t.Logf("expected the message failed once and delivered later got %v, %d, %+v", err, failed, p.messages)
+		t.Fail()
+	}
+	w.Close()
+}
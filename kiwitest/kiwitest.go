@@ -0,0 +1,171 @@
+package kiwitest
+
+// Package kiwitest helps to check the logged records in the tests.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/grafov/kiwi"
+	"github.com/grafov/kiwi/logfmt"
+)
+
+// Recorder captures the records written by its sink as the maps of the
+// keys to the values. So the tests check the pairs of the records
+// instead of searching the substrings in the output:
+//
+//	rec := kiwitest.NewRecorder()
+//	defer rec.Close()
+//	rec.Sink().HasKey("order")
+//
+//	placeOrder(log)
+//
+//	if !rec.HasPair("level", "error") {
+//		t.Fatal("no errors logged")
+//	}
+//
+// The recorder captures all the records logged while its sink is
+// active so use the filters of the sink for the tests that run in
+// parallel.
+type Recorder struct {
+	sink *kiwi.Sink
+
+	sync.Mutex
+	records []map[string]string
+}
+
+// NewRecorder creates the recorder with the started sink.
+func NewRecorder() *Recorder {
+	var r = new(Recorder)
+	r.sink = kiwi.SinkTo(r, kiwi.AsLogfmt()).Start()
+	return r
+}
+
+// Sink returns the sink of the recorder for setting its filters.
+func (r *Recorder) Sink() *kiwi.Sink {
+	return r.sink
+}
+
+// Write parses the record formatted by the sink.
+func (r *Recorder) Write(p []byte) (int, error) {
+	pairs, err := logfmt.Parse(p)
+	if err != nil {
+		return 0, err
+	}
+	var record = make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		record[pair.Key] = pair.Val
+	}
+	r.Lock()
+	r.records = append(r.records, record)
+	r.Unlock()
+	return len(p), nil
+}
+
+// Records returns the records captured so far. The records queued by
+// the sink are written before.
+func (r *Recorder) Records() []map[string]string {
+	r.sink.Flush()
+	r.Lock()
+	defer r.Unlock()
+	var records = make([]map[string]string, len(r.records))
+	copy(records, r.records)
+	return records
+}
+
+// Find returns the records that have all the pairs passed as the keys
+// and the values.
+func (r *Recorder) Find(keyVals ...string) []map[string]string {
+	var found []map[string]string
+next:
+	for _, record := range r.Records() {
+		for i := 0; i+1 < len(keyVals); i += 2 {
+			if val, ok := record[keyVals[i]]; !ok || val != keyVals[i+1] {
+				continue next
+			}
+		}
+		found = append(found, record)
+	}
+	return found
+}
+
+// Count returns number of the records that have all the pairs (see
+// Find()).
+func (r *Recorder) Count(keyVals ...string) int {
+	return len(r.Find(keyVals...))
+}
+
+// HasPair reports whether any record has the pair.
+func (r *Recorder) HasPair(key, val string) bool {
+	return r.Count(key, val) > 0
+}
+
+// HasKey reports whether any record has the key.
+func (r *Recorder) HasKey(key string) bool {
+	for _, record := range r.Records() {
+		if _, ok := record[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Expect fails the test when there is no record with all the pairs.
+func (r *Recorder) Expect(t testing.TB, keyVals ...string) {
+	t.Helper()
+	if r.Count(keyVals...) == 0 {
+		t.Errorf("no record with %q in %v", keyVals, r.Records())
+	}
+}
+
+// ExpectNone fails the test when there is the record with all the
+// pairs.
+func (r *Recorder) ExpectNone(t testing.TB, keyVals ...string) {
+	t.Helper()
+	if found := r.Find(keyVals...); len(found) > 0 {
+		t.Errorf("unexpected records with %q: %v", keyVals, found)
+	}
+}
+
+// Reset removes the captured records.
+func (r *Recorder) Reset() {
+	r.sink.Flush()
+	r.Lock()
+	r.records = nil
+	r.Unlock()
+}
+
+// Close closes the sink of the recorder.
+func (r *Recorder) Close() {
+	r.sink.Close()
+}
@@ -0,0 +1,336 @@
+package kvstore
+
+// Persistent file realization of the Store interface.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Operations of the entries of the file.
+const (
+	opPut    byte = 'P'
+	opDelete byte = 'D'
+)
+
+// entryHeader is the size of the operation code and the lengths of
+// the key and the value.
+const entryHeader = 9
+
+// CompactAfter is the number of the stale entries (deleted and
+// overwritten records) that the file keeps before the compaction. The
+// file is compacted when the stale entries also outnumber the live
+// ones.
+var CompactAfter = 1024
+
+// ErrCorrupted returned when the file of the store could not be
+// read.
+var ErrCorrupted = errors.New("kvstore file corrupted")
+
+// FileStore keeps the records in the append-only file so they survive
+// the restarts of the program. Puts and deletes are appended to the
+// file, the index of the keys kept in the memory and the values are
+// read from the file. The file is rewritten without the stale entries
+// when they outnumber the live ones (see CompactAfter):
+//
+//	store, err := kvstore.OpenFileStore("/var/lib/app/history.log")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//	w := kvstore.New(store).Retention(7 * 24 * time.Hour)
+//	kiwi.SinkTo(w, kiwi.AsJSON()).Start()
+//
+// The incomplete entry at the end of the file (after the crash for
+// example) is dropped on opening.
+type FileStore struct {
+	sync.RWMutex
+	path  string
+	file  *os.File
+	size  int64
+	keys  [][]byte
+	index map[string]fileEntry
+	stale int
+}
+
+// fileEntry is the position of the value in the file.
+type fileEntry struct {
+	offset int64
+	length uint32
+}
+
+// OpenFileStore opens the store in the file or creates the new one.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var f = &FileStore{path: path, file: file, index: make(map[string]fileEntry)}
+	if err = f.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Put saves the value under the key.
+func (f *FileStore) Put(key, val []byte) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return ErrClosed
+	}
+	var offset, err = f.append(opPut, key, val)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.index[string(key)]; ok {
+		f.stale++
+	} else {
+		f.keys = insertKey(f.keys, key)
+	}
+	f.index[string(key)] = fileEntry{offset, uint32(len(val))}
+	return nil
+}
+
+// Delete removes the key.
+func (f *FileStore) Delete(key []byte) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return ErrClosed
+	}
+	if _, ok := f.index[string(key)]; !ok {
+		return nil
+	}
+	if _, err := f.append(opDelete, key, nil); err != nil {
+		return err
+	}
+	delete(f.index, string(key))
+	f.keys = removeKey(f.keys, key)
+	// The put and the delete entries both are stale now.
+	f.stale += 2
+	if f.stale > CompactAfter && f.stale > len(f.keys) {
+		return f.compact()
+	}
+	return nil
+}
+
+// Scan iterates over the keys in range [from, to). Nil to means no
+// upper bound. The records are read by batches and fn is called
+// without the lock of the store.
+func (f *FileStore) Scan(from, to []byte, fn func(key, val []byte) bool) error {
+	var keys, vals = make([][]byte, 0, scanBatch), make([][]byte, 0, scanBatch)
+	for {
+		keys, vals = keys[:0], vals[:0]
+		f.RLock()
+		if f.file == nil {
+			f.RUnlock()
+			return ErrClosed
+		}
+		var i = searchKey(f.keys, from)
+		for ; i < len(f.keys) && len(keys) < scanBatch; i++ {
+			if to != nil && bytes.Compare(f.keys[i], to) >= 0 {
+				break
+			}
+			var (
+				e   = f.index[string(f.keys[i])]
+				val = make([]byte, e.length)
+			)
+			if _, err := f.file.ReadAt(val, e.offset); err != nil {
+				f.RUnlock()
+				return err
+			}
+			keys = append(keys, f.keys[i])
+			vals = append(vals, val)
+		}
+		f.RUnlock()
+		for i := range keys {
+			if !fn(keys[i], vals[i]) {
+				return nil
+			}
+		}
+		if len(keys) < scanBatch {
+			return nil
+		}
+		from = nextKey(keys[len(keys)-1])
+	}
+}
+
+// Sync commits the written entries to the disk.
+func (f *FileStore) Sync() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return ErrClosed
+	}
+	return f.file.Sync()
+}
+
+// Close syncs and closes the file of the store.
+func (f *FileStore) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.file == nil {
+		return ErrClosed
+	}
+	var err = f.file.Sync()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	f.file = nil
+	return err
+}
+
+// append writes the entry to the end of the file and returns the
+// offset of its value.
+func (f *FileStore) append(op byte, key, val []byte) (int64, error) {
+	var entry = make([]byte, entryHeader+len(key)+len(val))
+	entry[0] = op
+	binary.BigEndian.PutUint32(entry[1:], uint32(len(key)))
+	binary.BigEndian.PutUint32(entry[5:], uint32(len(val)))
+	copy(entry[entryHeader:], key)
+	copy(entry[entryHeader+len(key):], val)
+	if _, err := f.file.WriteAt(entry, f.size); err != nil {
+		// The partial entry is overwritten by the next one.
+		return 0, err
+	}
+	var offset = f.size + entryHeader + int64(len(key))
+	f.size += int64(len(entry))
+	return offset, nil
+}
+
+// load reads the entries of the file to the index.
+func (f *FileStore) load() error {
+	var (
+		r      = bufio.NewReader(io.NewSectionReader(f.file, 0, 1<<62))
+		header = make([]byte, entryHeader)
+		key    []byte
+	)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		var (
+			keyLen = binary.BigEndian.Uint32(header[1:])
+			valLen = binary.BigEndian.Uint32(header[5:])
+		)
+		if header[0] != opPut && header[0] != opDelete {
+			return ErrCorrupted
+		}
+		key = make([]byte, keyLen)
+		if _, err := io.ReadFull(r, key); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if _, err := r.Discard(int(valLen)); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		var offset = f.size + entryHeader + int64(keyLen)
+		f.size = offset + int64(valLen)
+		var _, exists = f.index[string(key)]
+		switch header[0] {
+		case opPut:
+			if exists {
+				f.stale++
+			} else {
+				f.keys = insertKey(f.keys, key)
+			}
+			f.index[string(key)] = fileEntry{offset, valLen}
+		case opDelete:
+			if exists {
+				delete(f.index, string(key))
+				f.keys = removeKey(f.keys, key)
+				f.stale++
+			}
+			f.stale++
+		}
+	}
+	// Drop the incomplete entry at the end.
+	return f.file.Truncate(f.size)
+}
+
+// compact rewrites the file with the live records only.
+func (f *FileStore) compact() error {
+	var tmp, err = os.OpenFile(f.path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var (
+		compacted = &FileStore{path: f.path, file: tmp, index: make(map[string]fileEntry, len(f.keys))}
+		val       []byte
+	)
+	for _, key := range f.keys {
+		var e = f.index[string(key)]
+		if cap(val) < int(e.length) {
+			val = make([]byte, e.length)
+		}
+		val = val[:e.length]
+		if _, err = f.file.ReadAt(val, e.offset); err != nil {
+			break
+		}
+		var offset int64
+		if offset, err = compacted.append(opPut, key, val); err != nil {
+			break
+		}
+		compacted.index[string(key)] = fileEntry{offset, e.length}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err != nil {
+		// The old file is kept as is.
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	f.file.Close()
+	f.file, f.size, f.index, f.stale = tmp, compacted.size, compacted.index, 0
+	return nil
+}
@@ -0,0 +1,217 @@
+package kvstore
+
+// Sink writer that keeps log records in an embedded key-value store.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+)
+
+// KeySize is the length of the keys under which the records stored.
+// The key consists of the timestamp (nanoseconds, big endian) and the
+// sequence number so the keys sorted in order of writing. The
+// timestamps of the keys never go back even if the wall clock does.
+const KeySize = 16
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("kvstore writer closed")
+
+// now is replaced in the tests.
+var now = time.Now
+
+// Store is minimal interface of an ordered key-value storage. The
+// package has the persistent FileStore and the in-memory MemStore.
+// It is easy to realize it over BoltDB, Badger or any other embedded
+// database with ordered keys. For example for bbolt bucket:
+//
+//	func (s boltStore) Put(k, v []byte) error {
+//		return s.db.Update(func(tx *bolt.Tx) error { return tx.Bucket(s.name).Put(k, v) })
+//	}
+//
+// The implementation should be safe for concurrent usage.
+type Store interface {
+	// Put saves the value under the key.
+	Put(key, val []byte) error
+	// Delete removes the key. It should not fail on absent keys.
+	Delete(key []byte) error
+	// Scan iterates over the keys in range [from, to) in ascending
+	// order until fn returns false. Nil to means no upper bound. fn
+	// may write to the store so it should be called without the
+	// locks of the store.
+	Scan(from, to []byte, fn func(key, val []byte) bool) error
+}
+
+// Writer saves formatted records to the Store under keys made of the
+// timestamp and sequence number. It conforms io.Writer so it may be
+// used as the output for kiwi.SinkTo(). The records older than the
+// retention period are pruned periodically.
+type Writer struct {
+	store Store
+
+	sync.Mutex
+	seq     uint64
+	last    int64
+	ttl     time.Duration
+	started sync.Once
+	closed  bool
+	done    chan struct{}
+}
+
+// New creates a writer for the store. The records are kept forever
+// until the retention is set with Retention().
+func New(store Store) *Writer {
+	return &Writer{store: store, done: make(chan struct{})}
+}
+
+// Retention sets how long the records are kept in the store. The
+// older records are pruned every tenth part of the period but not
+// often than once a second.
+func (w *Writer) Retention(ttl time.Duration) *Writer {
+	w.Lock()
+	w.ttl = ttl
+	w.Unlock()
+	w.started.Do(func() { go w.pruner() })
+	return w
+}
+
+// Write saves a single record to the store.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return 0, ErrClosed
+	}
+	w.seq++
+	// The timestamp kept monotonic so the keys stay in order of
+	// writing when the wall clock steps back.
+	var at = now().UnixNano()
+	if at < w.last {
+		at = w.last
+	}
+	w.last = at
+	var key = makeKey(time.Unix(0, at), w.seq)
+	w.Unlock()
+	// The sink reuses the buffer so the record should be copied.
+	var val = make([]byte, len(p))
+	copy(val, p)
+	if err := w.store.Put(key, val); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Scan calls fn for each record written in the time range [from,
+// to) in order of writing. It stops when fn returns false. Zero
+// value of to means no upper bound.
+func (w *Writer) Scan(from, to time.Time, fn func(at time.Time, record []byte) bool) error {
+	var toKey []byte
+	if !to.IsZero() {
+		toKey = makeKey(to, 0)
+	}
+	return w.store.Scan(makeKey(from, 0), toKey, func(key, val []byte) bool {
+		return fn(keyTime(key), val)
+	})
+}
+
+// Prune removes the records written before the time.
+func (w *Writer) Prune(before time.Time) error {
+	var (
+		keys [][]byte
+		err  error
+	)
+	err = w.store.Scan(makeKey(time.Time{}, 0), makeKey(before, 0), func(key, _ []byte) bool {
+		keys = append(keys, append([]byte(nil), key...))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = w.store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the pruning. It not closes the store.
+func (w *Writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	close(w.done)
+	return nil
+}
+
+func (w *Writer) pruner() {
+	for {
+		w.Lock()
+		var (
+			ttl   = w.ttl
+			every = ttl / 10
+		)
+		w.Unlock()
+		if every < time.Second {
+			every = time.Second
+		}
+		select {
+		case <-w.done:
+			return
+		case <-time.After(every):
+		}
+		if ttl > 0 {
+			w.Prune(now().Add(-ttl))
+		}
+	}
+}
+
+func makeKey(t time.Time, seq uint64) []byte {
+	var key = make([]byte, KeySize)
+	if !t.IsZero() && t.UnixNano() > 0 {
+		binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	}
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	if len(key) < 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
@@ -0,0 +1,195 @@
+package kvstore
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that the records could be scanned in order of writing.
+func TestWriter_Scan(t *testing.T) {
+	w := New(NewMemStore())
+	start := time.Now()
+
+	w.Write([]byte("first\n"))
+	w.Write([]byte("second\n"))
+	w.Write([]byte("third\n"))
+	var got []string
+	w.Scan(start, time.Time{}, func(at time.Time, record []byte) bool {
+		got = append(got, string(record))
+		return len(got) < 2
+	})
+
+	if len(got) != 2 || got[0] != "first\n" || got[1] != "second\n" {
+		t.Logf("unexpected records %q", got)
+		t.Fail()
+	}
+}
+
+// Test of pruning the old records.
+func TestWriter_Prune(t *testing.T) {
+	w := New(NewMemStore())
+	w.Write([]byte("old"))
+	time.Sleep(time.Millisecond)
+	border := time.Now()
+	w.Write([]byte("new"))
+
+	w.Prune(border)
+	var got []string
+	w.Scan(time.Time{}, time.Time{}, func(_ time.Time, record []byte) bool {
+		got = append(got, string(record))
+		return true
+	})
+
+	if len(got) != 1 || got[0] != "new" {
+		t.Logf("unexpected records %q", got)
+		t.Fail()
+	}
+}
+
+// Test that the keys stay in order of writing when the clock steps
+// back.
+func TestWriter_ClockStepBack(t *testing.T) {
+	w := New(NewMemStore())
+	clock := time.Now()
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	w.Write([]byte("first"))
+	clock = clock.Add(-time.Hour)
+	w.Write([]byte("second"))
+	var got []string
+	w.Scan(time.Time{}, time.Time{}, func(_ time.Time, record []byte) bool {
+		got = append(got, string(record))
+		return true
+	})
+
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Logf("unexpected records %q", got)
+		t.Fail()
+	}
+}
+
+// Test that the callback of Scan could write to the store.
+func TestMemStore_ScanWrites(t *testing.T) {
+	m := NewMemStore()
+	for i := 0; i < scanBatch+10; i++ {
+		m.Put([]byte(fmt.Sprintf("a%04d", i)), []byte("v"))
+	}
+	var scanned int
+
+	done := make(chan struct{})
+	go func() {
+		m.Scan([]byte("a"), []byte("b"), func(key, _ []byte) bool {
+			scanned++
+			m.Delete(key)
+			m.Put(append([]byte("b"), key...), []byte("v"))
+			return true
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan deadlocked")
+	}
+
+	if scanned != scanBatch+10 || len(m.keys) != scanBatch+10 {
+		t.Logf("expected %d scanned and kept records got %d and %d", scanBatch+10, scanned, len(m.keys))
+		t.Fail()
+	}
+}
+
+// Test that the records of the file store survive reopening and the
+// stale entries removed by the compaction.
+func TestFileStore_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompactAfter = 4
+	defer func() { CompactAfter = 1024 }()
+
+	for i := 0; i < 10; i++ {
+		store.Put([]byte(fmt.Sprintf("k%02d", i)), []byte(fmt.Sprintf("v%d", i)))
+	}
+	for i := 0; i < 8; i++ {
+		store.Delete([]byte(fmt.Sprintf("k%02d", i)))
+	}
+	store.Close()
+	// The incomplete entry left by the crash.
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write([]byte{opPut, 0, 0, 0, 3, 0, 0, 0, 5, 'k'})
+	file.Close()
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var got []string
+	store.Scan(nil, nil, func(key, val []byte) bool {
+		got = append(got, string(key)+"="+string(val))
+		return true
+	})
+	info, _ := os.Stat(path)
+
+	if len(got) != 2 || got[0] != "k08=v8" || got[1] != "k09=v9" {
+		t.Logf("unexpected records %q", got)
+		t.Fail()
+	}
+	// The last compaction left three records of 3 bytes keys and 2
+	// bytes values, then the delete entry was appended.
+	if info.Size() != 3*(entryHeader+5)+entryHeader+3 {
+		t.Logf("expected compacted file got %d bytes", info.Size())
+		t.Fail()
+	}
+}
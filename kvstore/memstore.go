@@ -0,0 +1,147 @@
+package kvstore
+
+// In-memory realization of the Store interface.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// scanBatch is the number of the records copied by Scan() at once.
+// The callbacks are called without the lock so they could write to
+// the store.
+const scanBatch = 256
+
+// MemStore keeps the records in the memory. It useful for tests and
+// for the cases when the history should not survive restarts.
+type MemStore struct {
+	sync.RWMutex
+	keys [][]byte
+	vals map[string][]byte
+}
+
+// NewMemStore creates an empty in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{vals: make(map[string][]byte)}
+}
+
+// Put saves the value under the key. The keys of Writer grow so
+// they are appended to the end of the index in constant time.
+func (m *MemStore) Put(key, val []byte) error {
+	m.Lock()
+	if _, ok := m.vals[string(key)]; !ok {
+		m.keys = insertKey(m.keys, key)
+	}
+	m.vals[string(key)] = val
+	m.Unlock()
+	return nil
+}
+
+// Delete removes the key. The oldest keys removed by Writer.Prune()
+// are cut from the head of the index in constant time.
+func (m *MemStore) Delete(key []byte) error {
+	m.Lock()
+	if _, ok := m.vals[string(key)]; ok {
+		delete(m.vals, string(key))
+		m.keys = removeKey(m.keys, key)
+	}
+	m.Unlock()
+	return nil
+}
+
+// Scan iterates over the keys in range [from, to). Nil to means no
+// upper bound. The records are copied by batches and fn is called
+// without the lock of the store.
+func (m *MemStore) Scan(from, to []byte, fn func(key, val []byte) bool) error {
+	var keys, vals = make([][]byte, 0, scanBatch), make([][]byte, 0, scanBatch)
+	for {
+		keys, vals = keys[:0], vals[:0]
+		m.RLock()
+		var i = searchKey(m.keys, from)
+		for ; i < len(m.keys) && len(keys) < scanBatch; i++ {
+			if to != nil && bytes.Compare(m.keys[i], to) >= 0 {
+				break
+			}
+			keys = append(keys, m.keys[i])
+			vals = append(vals, m.vals[string(m.keys[i])])
+		}
+		m.RUnlock()
+		for i := range keys {
+			if !fn(keys[i], vals[i]) {
+				return nil
+			}
+		}
+		if len(keys) < scanBatch {
+			return nil
+		}
+		from = nextKey(keys[len(keys)-1])
+	}
+}
+
+// searchKey returns the position of the first key not less than the
+// key.
+func searchKey(keys [][]byte, key []byte) int {
+	return sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], key) >= 0 })
+}
+
+// insertKey adds the copy of the key to the sorted keys.
+func insertKey(keys [][]byte, key []byte) [][]byte {
+	key = append([]byte(nil), key...)
+	if len(keys) == 0 || bytes.Compare(keys[len(keys)-1], key) < 0 {
+		return append(keys, key)
+	}
+	var i = searchKey(keys, key)
+	keys = append(keys, nil)
+	copy(keys[i+1:], keys[i:])
+	keys[i] = key
+	return keys
+}
+
+// removeKey removes the key from the sorted keys.
+func removeKey(keys [][]byte, key []byte) [][]byte {
+	var i = searchKey(keys, key)
+	switch {
+	case i == len(keys) || !bytes.Equal(keys[i], key):
+		return keys
+	case i == 0:
+		keys[0] = nil
+		return keys[1:]
+	}
+	return append(keys[:i], keys[i+1:]...)
+}
+
+// nextKey returns the least key greater than the key.
+func nextKey(key []byte) []byte {
+	return append(append(make([]byte, 0, len(key)+1), key...), 0)
+}
@@ -0,0 +1,146 @@
+package kiwi
+
+// Values evaluated only for the records that are written.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import "sync"
+
+// lazyValue keeps the function func() interface{} passed as the
+// value. It is called once for the record by the first sink that
+// writes the record.
+type lazyValue struct {
+	fn      func() interface{}
+	once    sync.Once
+	val     string
+	valType int
+	// text is the value of the object for the formatters that don't
+	// write the objects (see ObjectFormatter).
+	text string
+}
+
+// get evaluates the value once for all the sinks.
+func (v *lazyValue) get() (string, int) {
+	v.once.Do(func() {
+		var p = toPair("", v.fn())
+		if f, ok := p.Eval.(func() string); ok {
+			p.Val = f()
+		}
+		v.val, v.valType = p.Val, p.Type
+		if t, ok := p.Eval.(objectText); ok {
+			v.text = string(t)
+		}
+	})
+	return v.val, v.valType
+}
+
+// value returns the value of the pair. The lazy values passed as
+// func() interface{} are evaluated here. Unlike func() string values
+// that evaluated when the record is logged they are evaluated only
+// when the record passed the filters of the active sink (or when the
+// sink has the filter for the key of the value):
+//
+//	log.Log("stats", func() interface{} { return expensiveSnapshot() })
+//
+// The values are empty for other checks (the record filters, the
+// sampling, the schema etc.).
+func (p *Pair) value() (string, int) {
+	if v, ok := p.Eval.(*lazyValue); ok {
+		return v.get()
+	}
+	return p.Val, p.Type
+}
+
+// textValue returns the value of the pair for the formatters that
+// don't write the objects (see ObjectFormatter). The objects are
+// formatted by fmt with %+v verb for them.
+func (p *Pair) textValue() (string, int) {
+	switch eval := p.Eval.(type) {
+	case objectText:
+		return string(eval), StringVal
+	case *lazyValue:
+		if val, valType := eval.get(); valType != ObjectVal {
+			return val, valType
+		}
+		return eval.text, StringVal
+	}
+	return p.Val, p.Type
+}
+
+// lazyPairs keeps the generator of the pairs from the context of the
+// logger (see With()). It is called once for the record by the first
+// sink that passed the record through the filters of other pairs. The
+// hooks and the schema of the logger don't see the generated pairs.
+type lazyPairs struct {
+	fn        func() []*Pair
+	clock     Clock
+	collector *Collector
+	once      sync.Once
+	pairs     []*Pair
+}
+
+// get calls the generator once for all the sinks.
+func (g *lazyPairs) get() []*Pair {
+	g.once.Do(func() {
+		// The pairs are not taken from the storage of the record
+		// because the sinks expand the generators concurrently.
+		var rec = record{clock: g.clock, collector: g.collector}
+		for _, p := range g.fn() {
+			if p != nil {
+				g.pairs = rec.appendEvaluated(g.pairs, p)
+			}
+		}
+	})
+	return g.pairs
+}
+
+// expandPairs returns the copy of the record with the generated pairs
+// in place of the generators. The record without the generators
+// returned as is.
+func expandPairs(record []*Pair) ([]*Pair, bool) {
+	for i, p := range record {
+		if _, ok := p.Eval.(*lazyPairs); !ok {
+			continue
+		}
+		var expanded = make([]*Pair, i, len(record)+4)
+		copy(expanded, record[:i])
+		for _, p := range record[i:] {
+			if g, ok := p.Eval.(*lazyPairs); ok {
+				var generated, _ = expandPairs(g.get())
+				expanded = append(expanded, generated...)
+			} else {
+				expanded = append(expanded, p)
+			}
+		}
+		return expanded, true
+	}
+	return record, false
+}
@@ -0,0 +1,203 @@
+package kiwi
+
+// This file consists of Logger methods for logging with severity levels.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Debug logs the record with SeverityKey="debug". The level pair
+// follows the context of the logger and it is not prefixed (see
+// Prefix()):
+//
+//	log.Debug("msg", "cache miss", "key", k)
+//	// level="debug" msg="cache miss" key="users:12"
+func (l *Logger) Debug(keyVals ...interface{}) {
+	if !l.Enabled("debug") {
+		return
+	}
+	l.log(&Pair{SeverityKey, "debug", nil, StringVal}, keyVals)
+}
+
+// Info logs the record with SeverityKey="info" (see Debug()).
+func (l *Logger) Info(keyVals ...interface{}) {
+	if !l.Enabled("info") {
+		return
+	}
+	l.log(&Pair{SeverityKey, "info", nil, StringVal}, keyVals)
+}
+
+// Warn logs the record with SeverityKey="warning" (see Debug()).
+func (l *Logger) Warn(keyVals ...interface{}) {
+	if !l.Enabled("warning") {
+		return
+	}
+	l.log(&Pair{SeverityKey, "warning", nil, StringVal}, keyVals)
+}
+
+// Error logs the record with SeverityKey="error" (see Debug()).
+func (l *Logger) Error(keyVals ...interface{}) {
+	if !l.Enabled("error") {
+		return
+	}
+	l.log(&Pair{SeverityKey, "error", nil, StringVal}, keyVals)
+}
+
+// exit is replaced in the tests.
+var exit = os.Exit
+
+// Fatal logs the record with SeverityKey="fatal" (see Debug()), waits
+// until the sinks of the logger wrote their queued records (see
+// Collector.Flush()) and exits the program with status 1. So the last
+// record reaches the outputs before the process dies. The muted
+// logger (see When() and Unless()) suppresses the record only, the
+// program exits anyway.
+func (l *Logger) Fatal(keyVals ...interface{}) {
+	l.log(&Pair{SeverityKey, "fatal", nil, StringVal}, keyVals)
+	l.flush()
+	exit(1)
+}
+
+// Panic logs the record with SeverityKey="panic" (see Debug()), waits
+// until the sinks of the logger wrote their queued records (see
+// Collector.Flush()) and panics. The panic value is the string with
+// the pairs of the record passed in the arguments. The muted logger
+// (see When() and Unless()) suppresses the record only, the panic is
+// raised anyway.
+func (l *Logger) Panic(keyVals ...interface{}) {
+	l.log(&Pair{SeverityKey, "panic", nil, StringVal}, keyVals)
+	l.flush()
+	panic(panicText(keyVals))
+}
+
+// panicText joins the keys and the values as "key=value" pairs.
+func panicText(keyVals []interface{}) string {
+	var text strings.Builder
+	for i := 0; i < len(keyVals); i += 2 {
+		if i > 0 {
+			text.WriteByte(' ')
+		}
+		if i+1 < len(keyVals) {
+			fmt.Fprintf(&text, "%v=%v", keyVals[i], keyVals[i+1])
+		} else {
+			fmt.Fprint(&text, keyVals[i])
+		}
+	}
+	return text.String()
+}
+
+// globalLevel is the rank of the minimal level set by
+// SetGlobalLevel() increased by one. Zero means all the levels are
+// enabled.
+var globalLevel int32
+
+// SetGlobalLevel sets the minimal level of the records logged by
+// Debug(), Info(), Warn() and Error() methods of the loggers which
+// have no own level (see Logger.SetLevel()). The levels ranked by
+// Severities. Unlike WithLevelAtLeast() filter of the sink the
+// disabled records are not constructed at all so disabled debug
+// logging costs near zero. It is safe to change the level at runtime
+// from any goroutine. Empty level enables all the levels.
+func SetGlobalLevel(level string) {
+	atomic.StoreInt32(&globalLevel, levelThreshold(level))
+}
+
+// SetLevel sets the minimal level of the records logged by the
+// logger that overrides the global level (see SetGlobalLevel()). The
+// loggers forked after the call inherit the level. It is safe to
+// change the level at runtime from any goroutine. Empty level means
+// the global level.
+func (l *Logger) SetLevel(level string) *Logger {
+	atomic.StoreInt32(&l.level, levelThreshold(level))
+	return l
+}
+
+// Enabled reports whether the records of the level are logged by the
+// logger. It allows to skip the expensive preparation of the values
+// for disabled levels:
+//
+//	if log.Enabled("debug") {
+//		log.Debug("state", dumpState())
+//	}
+func (l *Logger) Enabled(level string) bool {
+	var min = atomic.LoadInt32(&l.level)
+	if min == 0 {
+		if min = atomic.LoadInt32(&globalLevel); min == 0 {
+			return true
+		}
+	}
+	return int32(severityRank(level)) >= min-1
+}
+
+func levelThreshold(level string) int32 {
+	if level == "" {
+		return 0
+	}
+	return int32(severityRank(level)) + 1
+}
+
+// WithLevelAtLeast sets restriction for records output. Only the
+// records with severity (the value of SeverityKey ranked by
+// Severities) not lower than the level passed to output:
+//
+//	kiwi.SinkTo(os.Stderr, kiwi.AsLogfmt()).WithLevelAtLeast("warning").Start()
+//
+// The unknown levels in the records ranked as "info". The records
+// without SeverityKey are passed to output, the same way as the
+// records without the keys of other filters.
+func (s *Sink) WithLevelAtLeast(level string) *Sink {
+	return s.WithFilter(SeverityKey, &levelFilter{Min: severityRank(level)})
+}
+
+type levelFilter struct {
+	Min int
+}
+
+func (f *levelFilter) Check(key, val string) bool {
+	return severityRank(val) >= f.Min
+}
+
+// severityRank returns the rank of the level. The case of the level
+// is ignored.
+func severityRank(level string) int {
+	if rank, ok := Severities[level]; ok {
+		return rank
+	}
+	if rank, ok := Severities[strings.ToLower(level)]; ok {
+		return rank
+	}
+	return Severities["info"]
+}
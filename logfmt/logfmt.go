@@ -0,0 +1,198 @@
+package logfmt
+
+// Parser of the records in logfmt format.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/grafov/kiwi"
+)
+
+// SyntaxError describes the malformed line.
+type SyntaxError struct {
+	Msg string
+	// Pos is the offset in the line.
+	Pos int
+}
+
+func (e *SyntaxError) Error() string {
+	return "logfmt: " + e.Msg + " at offset " + strconv.Itoa(e.Pos)
+}
+
+// Parse parses the line in logfmt format (kiwi.AsLogfmt() output in
+// both default and strict mode) back to the pairs. The types of the
+// values are restored as close as possible: the quoted values are
+// strings, the unquoted values are recognized as booleans, integers,
+// floats, times in kiwi.TimeLayout and null. The keys without values
+// have kiwi.VoidVal type:
+//
+//	pairs, err := logfmt.Parse([]byte(`msg="user found" id=12`))
+//	// [{msg user found <nil> kiwi.StringVal} {id 12 <nil> kiwi.IntegerVal}]
+func Parse(line []byte) ([]kiwi.Pair, error) {
+	var (
+		pairs []kiwi.Pair
+		i     int
+	)
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return pairs, nil
+		}
+		var (
+			key string
+			err error
+		)
+		if line[i] == '"' {
+			if key, i, err = quoted(line, i); err != nil {
+				return pairs, err
+			}
+		} else {
+			var start = i
+			for i < len(line) && line[i] != '=' && !isSpace(line[i]) {
+				if line[i] == '"' {
+					return pairs, &SyntaxError{"unexpected quote in the key", i}
+				}
+				i++
+			}
+			key = string(line[start:i])
+		}
+		if i >= len(line) || line[i] != '=' {
+			// The key without value.
+			pairs = append(pairs, kiwi.Pair{Key: key, Type: kiwi.VoidVal})
+			continue
+		}
+		i++
+		if i < len(line) && line[i] == '"' {
+			var val string
+			if val, i, err = quoted(line, i); err != nil {
+				return pairs, err
+			}
+			pairs = append(pairs, kiwi.Pair{Key: key, Val: val, Type: kiwi.StringVal})
+			continue
+		}
+		var start = i
+		for i < len(line) && !isSpace(line[i]) {
+			if line[i] == '"' || line[i] == '=' {
+				return pairs, &SyntaxError{"unexpected char in the unquoted value", i}
+			}
+			i++
+		}
+		var val = string(line[start:i])
+		pairs = append(pairs, kiwi.Pair{Key: key, Val: val, Type: kindOf(val)})
+	}
+}
+
+// ParseString is the same as Parse() for the strings.
+func ParseString(line string) ([]kiwi.Pair, error) {
+	return Parse([]byte(line))
+}
+
+// Decoder reads the records from the input line by line.
+type Decoder struct {
+	scanner *bufio.Scanner
+}
+
+// NewDecoder creates the decoder for the input. The lines are limited
+// by bufio.MaxScanTokenSize.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{scanner: bufio.NewScanner(r)}
+}
+
+// Decode returns the pairs of the next record. It returns io.EOF when
+// the input ended. The empty lines are skipped.
+func (d *Decoder) Decode() ([]kiwi.Pair, error) {
+	for d.scanner.Scan() {
+		var pairs, err = Parse(d.scanner.Bytes())
+		if err != nil || len(pairs) > 0 {
+			return pairs, err
+		}
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// quoted returns the unquoted string that starts at the offset and
+// the offset after the closing quote.
+func quoted(line []byte, start int) (string, int, error) {
+	var i = start + 1
+	for ; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			var raw = line[start : i+1]
+			if s, err := strconv.Unquote(string(raw)); err == nil {
+				return s, i + 1, nil
+			}
+			// The strict mode escapes the strings as JSON does.
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return "", i, &SyntaxError{"invalid escape in the quoted string", start}
+			}
+			return s, i + 1, nil
+		}
+	}
+	return "", i, &SyntaxError{"unterminated quoted string", start}
+}
+
+// kindOf recognizes the type of the unquoted value.
+func kindOf(val string) int {
+	switch val {
+	case "true", "false":
+		return kiwi.BooleanVal
+	case "null", "<nil>":
+		return kiwi.VoidVal
+	}
+	if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return kiwi.IntegerVal
+	}
+	if _, err := strconv.ParseFloat(val, 64); err == nil {
+		return kiwi.FloatVal
+	}
+	if _, err := time.Parse(kiwi.TimeLayout, val); err == nil {
+		return kiwi.TimeVal
+	}
+	return kiwi.StringVal
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,88 @@
+package logfmt
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/grafov/kiwi"
+)
+
+// Test of round-tripping the output of the logfmt formatter.
+func TestParse_RoundTrip(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := kiwi.SinkTo(output, kiwi.AsLogfmt()).HasKey("parse-key").Start()
+	kiwi.Log("parse-key", "a \"quoted\"\nline", "n", 12, "f", 0.5, "b", true, "nil", nil)
+	out.Close()
+
+	pairs, err := NewDecoder(output).Decode()
+	_, eof := NewDecoder(bytes.NewBufferString("\n")).Decode()
+
+	expected := []kiwi.Pair{
+		{Key: "parse-key", Val: "a \"quoted\"\nline", Type: kiwi.StringVal},
+		{Key: "n", Val: "12", Type: kiwi.IntegerVal},
+		{Key: "f", Val: "5e-01", Type: kiwi.FloatVal},
+		{Key: "b", Val: "true", Type: kiwi.BooleanVal},
+		{Key: "nil", Val: "<nil>", Type: kiwi.StringVal},
+	}
+	if err != nil || !reflect.DeepEqual(pairs, expected) || eof != io.EOF {
+		t.Logf("expected %v got %v (%v, %v)", expected, pairs, err, eof)
+		t.Fail()
+	}
+}
+
+// Test of the malformed lines.
+func TestParse_SyntaxError(t *testing.T) {
+	_, unterminated := ParseString(`a="b`)
+	_, quote := ParseString(`a=b"c`)
+
+	if _, ok := unterminated.(*SyntaxError); !ok {
+		t.Logf("expected syntax error got %v", unterminated)
+		t.Fail()
+	}
+	if _, ok := quote.(*SyntaxError); !ok {
+		t.Logf("expected syntax error got %v", quote)
+		t.Fail()
+	}
+}
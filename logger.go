@@ -1,6 +1,9 @@
 package kiwi
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 // This file consists of Logger related structures and functions.
 
@@ -37,16 +40,40 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 var (
 	UnpairedKey = "message"
 	ErrorKey    = "kiwi-error"
+	// PrefixSeparator joins the prefix set by Logger.Prefix() and the
+	// key.
+	PrefixSeparator = "."
+	// MessageKey is the key for human readable text of the record
+	// added by Msg().
+	MessageKey = "msg"
 )
 
 type (
 	// Logger keeps context and log record. There are many loggers initialized
-	// in different places of application. Loggers are not safe for
-	// concurrent usage so then you need logger for another goroutine you will need clone existing instance.
-	// See Logger.New() method below for details.
+	// in different places of application. The methods that change the
+	// logger (With(), Add(), Without() etc.) are not safe for
+	// concurrent usage. The logger that only logs the records (Log(),
+	// Msg(), Debug() etc.) and derives other loggers (Fork(), Clone(),
+	// Prefix()) could be shared by the goroutines. So for another
+	// goroutine you need clone existing instance, see Logger.Clone().
 	Logger struct {
 		context []*Pair
 		pairs   []*Pair
+		// typed keeps the pairs added by the typed Add methods,
+		// they are reused for the next records.
+		typed  []Pair
+		prefix string
+		muted  bool
+		schema *Schema
+		hooks  []Hook
+		// collector gets the records, nil means DefaultCollector.
+		collector *Collector
+		// clock evaluates the timestamps, nil means the clock of
+		// the collector.
+		clock Clock
+		// level is the rank of the minimal level increased by one
+		// (see SetLevel()), it is accessed atomically.
+		level int32
 	}
 	// Stringer is the same as fmt.Stringer
 	Stringer interface {
@@ -90,7 +117,7 @@ func New() *Logger {
 // from the logger from the parent logger. But the values of the
 // current record of the parent logger discarded.
 func (l *Logger) Fork() *Logger {
-	var fork = Logger{context: make([]*Pair, len(l.context))}
+	var fork = Logger{context: make([]*Pair, len(l.context)), prefix: l.prefix, schema: l.schema, hooks: l.hooks, collector: l.collector, clock: l.clock, level: atomic.LoadInt32(&l.level), muted: l.muted}
 	copy(fork.context, l.context)
 	return &fork
 }
@@ -102,26 +129,103 @@ func (l *Logger) New() *Logger {
 	return new(Logger)
 }
 
+// Prefix creates a new instance of the logger with the context of the
+// parent logger (see Fork()). All the keys of the pairs added to the
+// new logger by Add(), Log() and With() prefixed with the name and
+// PrefixSeparator. The prefixes of nested loggers are accumulated:
+//
+//	dbLog := log.Prefix("db")
+//	dbLog.Log("query", q)           // db.query="..."
+//	dbLog.Prefix("tx").Log("id", 1) // db.tx.id=1
+//
+// The keys of the context inherited from the parent logger are not
+// changed.
+func (l *Logger) Prefix(name string) *Logger {
+	var child = l.Fork()
+	child.prefix = l.prefix + name + PrefixSeparator
+	return child
+}
+
+// Namespace is the same as Prefix(). It is intended for the libraries
+// that embed their keys in the records of the application without
+// collisions. AsJSON().Nested() emits the namespaces as the nested
+// objects.
+func (l *Logger) Namespace(name string) *Logger {
+	return l.Prefix(name)
+}
+
+// prefixed returns the pair with the key prefixed by the logger
+// prefix. The original pair is not changed.
+func (l *Logger) prefixed(p *Pair) *Pair {
+	if l.prefix == "" {
+		return p
+	}
+	return &Pair{l.prefix + p.Key, p.Val, p.Eval, p.Type}
+}
+
+// noop returns the logger for When() and Unless() when the condition
+// is not met. It ignores all the pairs passed to it and the loggers
+// forked from it are muted too. Each call returns new logger so the
+// callers could not change the settings of each other.
+func noop() *Logger {
+	return &Logger{muted: true}
+}
+
+// When returns the logger itself if the condition is true. Elsewere
+// it returns the logger that ignores all the records so the calls
+// like:
+//
+//	if debug {
+//		log.Log("request", req)
+//	}
+//
+// could be written in a single line:
+//
+//	log.When(debug).Log("request", req)
+//
+// The pairs passed to ignoring logger not converted and not passed to
+// the sinks.
+func (l *Logger) When(cond bool) *Logger {
+	if cond {
+		return l
+	}
+	return noop()
+}
+
+// Unless is opposite of When(). It returns the logger that ignores
+// all the records if the condition is true.
+func (l *Logger) Unless(cond bool) *Logger {
+	return l.When(!cond)
+}
+
 // Log is the most common method for flushing previously added key-val pairs to an output.
 // After current record is flushed all pairs removed from a record except contextSrc pairs.
 func (l *Logger) Log(keyVals ...interface{}) {
+	l.log(nil, keyVals)
+}
+
+// log logs the record. The pair passed separately (the level for
+// example) follows the context and it is not prefixed.
+func (l *Logger) log(first *Pair, keyVals []interface{}) {
+	if l.muted {
+		return
+	}
 	// 1. Log the context.
-	var record = make([]*Pair, 0, len(l.context)+len(l.pairs)+len(keyVals))
+	var (
+		rec    = newRecord(len(l.context) + len(l.pairs) + len(keyVals) + 1)
+		record = rec.pairs
+	)
+	rec.clock, rec.collector = l.clock, l.collector
 	for _, p := range l.context {
-		if p.Eval != nil {
-			// Evaluate delayed context value here before output.
-			record = append(record, &Pair{p.Key, p.Eval.(func() string)(), p.Eval, p.Type})
-		} else {
-			record = append(record, &Pair{p.Key, p.Val, nil, p.Type})
-		}
+		// Evaluate delayed context value here before output.
+		record = rec.appendEvaluated(record, p)
 	}
 	// 2. Log the regular key-value pairs that added before by Add() calls.
 	for _, p := range l.pairs {
-		if p.Eval != nil {
-			record = append(record, &Pair{p.Key, p.Eval.(func() string)(), p.Eval, p.Type})
-		} else {
-			record = append(record, &Pair{p.Key, p.Val, nil, p.Type})
-		}
+		record = rec.appendEvaluated(record, p)
+	}
+	if first != nil {
+		record = append(record, first)
 	}
 	// 3. Log the regular key-value pairs that come in the args.
 	var (
@@ -134,14 +238,14 @@ func (l *Logger) Log(keyVals ...interface{}) {
 			case string:
 				key = val.(string)
 			case *Pair:
-				record = append(record, val.(*Pair))
+				record = append(record, l.prefixed(val.(*Pair)))
 				continue
 			default:
 				record = append(record, toPair(ErrorKey, fmt.Sprintf("non a string type (%T) for the key (%v)", val, val)))
 				key = UnpairedKey
 			}
 		} else {
-			record = append(record, toPair(key, val))
+			record = append(record, toPair(l.prefix+key, val))
 		}
 		shouldBeAKey = !shouldBeAKey
 	}
@@ -149,8 +253,22 @@ func (l *Logger) Log(keyVals ...interface{}) {
 		record = append(record, toPair(UnpairedKey, key))
 	}
 	// 4. Pass the record to the collector.
-	sinkRecord(record)
-	l.pairs = nil
+	record = runHooks(l.hooks, record)
+	if l.schema != nil {
+		record, _ = l.schema.apply(record)
+	}
+	rec.pairs = record
+	l.sinkRecord(rec)
+	l.resetPairs()
+}
+
+// Msg logs the record with human readable text under MessageKey. The
+// text goes first then other key-value pairs follow:
+//
+//	log.Msg("user created", "id", 123)
+//	// msg="user created" id=123
+func (l *Logger) Msg(text string, keyVals ...interface{}) {
+	l.Log(append([]interface{}{MessageKey, text}, keyVals...)...)
 }
 
 // Add a new key-value pairs to the log record. If a key already added then value will be
@@ -158,6 +276,9 @@ func (l *Logger) Log(keyVals ...interface{}) {
 // value for a current record only. After flushing a record with Log() old context value
 // will be restored.
 func (l *Logger) Add(keyVals ...interface{}) *Logger {
+	if l.muted {
+		return l
+	}
 	var (
 		key          string
 		shouldBeAKey = true
@@ -169,14 +290,14 @@ func (l *Logger) Add(keyVals ...interface{}) *Logger {
 			case string:
 				key = val.(string)
 			case *Pair:
-				l.pairs = append(l.pairs, val.(*Pair))
+				l.pairs = append(l.pairs, l.prefixed(val.(*Pair)))
 				continue
 			default:
 				l.pairs = append(l.pairs, toPair(ErrorKey, fmt.Sprintf("non a string type (%T) for the key (%v)", val, val)))
 				continue
 			}
 		} else {
-			l.pairs = append(l.pairs, toPair(key, val))
+			l.pairs = append(l.pairs, toPair(l.prefix+key, val))
 		}
 		shouldBeAKey = !shouldBeAKey
 	}
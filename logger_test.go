@@ -35,6 +35,7 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -332,3 +333,442 @@ func TestLogger_ResetContext_Logfmt(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Test logging of the message with pairs.
+func TestLogger_Msg_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	log.Msg("user created", "id", 123)
+
+	out.Flush()
+	expected := `msg="user created" id=123`
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of conditional logging.
+func TestLogger_WhenUnless_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	log.When(false).Add("k", "skipped").Log("k2", "skipped")
+	log.Unless(true).With("k", "skipped").Log()
+	log.When(true).Log("k", "passed")
+	log.Unless(false).Log("k2", "passed")
+
+	out.Flush()
+	expected := "k=\"passed\" \nk2=\"passed\""
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of the keys prefixed for the sub-logger.
+func TestLogger_Prefix_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New().With("app", "test")
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	db := log.Prefix("db").With("name", "main")
+	db.Add("rows", 1).Log("query", "select")
+	db.Prefix("tx").Log("id", 2)
+
+	out.Flush()
+	expected := "app=\"test\" db.name=\"main\" db.rows=1 db.query=\"select\" \napp=\"test\" db.name=\"main\" db.tx.id=2"
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test logging on the function exit.
+func TestLogger_LogDeferred_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	func() {
+		defer log.LogDeferred("msg", "done")()
+	}()
+	func() {
+		defer func() { recover() }()
+		defer log.LogDeferred("msg", "failed")()
+		panic("oops")
+	}()
+
+	out.Flush()
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], `msg="done" elapsed=`) || !strings.HasSuffix(strings.TrimSpace(lines[0]), "panicked=false") ||
+		!strings.HasPrefix(lines[1], `msg="failed" elapsed=`) || !strings.HasSuffix(lines[1], "panicked=true") {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the lone value logged as the message on the function exit.
+func TestLogger_LogDeferredMessage_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	func() {
+		defer log.LogDeferred("handler_done")()
+	}()
+
+	out.Flush()
+	line := strings.TrimSpace(output.String())
+	if !strings.HasPrefix(line, `msg="handler_done" elapsed=`) || !strings.HasSuffix(line, "panicked=false") {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the *Pair arguments not counted for the lone message on
+// the function exit.
+func TestLogger_LogDeferredPairs_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	pair := &Pair{"p", "1", nil, IntegerVal}
+
+	func() {
+		defer log.LogDeferred(pair, "k", "v")()
+	}()
+	func() {
+		defer log.LogDeferred(pair, "done")()
+	}()
+
+	out.Flush()
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `p=1 k="v" elapsed=`) || !strings.HasPrefix(lines[1], `p=1 msg="done" elapsed=`) {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the panic raised again after logging on the function exit.
+func TestLogger_LogDeferredRepanic_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	var repanicked interface{}
+
+	func() {
+		defer func() { repanicked = recover() }()
+		defer log.LogDeferred("path", "/", "handler_failed")()
+		panic("oops")
+	}()
+
+	out.Flush()
+	line := strings.TrimSpace(output.String())
+	if repanicked != "oops" {
+		t.Logf("expected repanic with oops got %v", repanicked)
+		t.Fail()
+	}
+	if !strings.HasPrefix(line, `path="/" msg="handler_failed" elapsed=`) || !strings.HasSuffix(line, "panicked=true") {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the loggers derived from the muted logger are muted too.
+func TestLogger_WhenFalseDerived_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	log.When(false).Prefix("db").Log("a", 1)
+	log.When(false).Clone("b", 2).Log("x", 1)
+	log.Unless(true).Namespace("n").Log("c", 3)
+	log.When(false).UseCollector(nil)
+	log.Log("d", 4)
+
+	out.Flush()
+	if output.String() != "d=4 \n" || log.When(false) == log.When(false) {
+		t.Logf("expected only d=4 from own muted loggers got %q", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the objects formatted by fmt for logfmt unless flattened.
+func TestLogger_ObjectValues_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	type private struct {
+		id   int
+		name string
+	}
+
+	log.Log("user", private{1, "bob"}, "ids", []int{3, 4})
+	log.With("ctx", private{2, "eve"}).Log("lazy", func() interface{} { return map[string]int{"a": 1} })
+
+	out.Flush()
+	expected := "user=\"{id:1 name:bob}\" ids=\"[3 4]\" \nctx=\"{id:2 name:eve}\" lazy=\"map[a:1]\" \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of the context with generator of pairs.
+func TestLogger_WithGenerator_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	var calls int
+
+	log.With("k", "v", func() []*Pair {
+		calls++
+		return []*Pair{{"calls", fmt.Sprint(calls), nil, IntegerVal}}
+	})
+	log.When(false).Log("skipped", true)
+	log.Log()
+	log.Log()
+
+	out.Flush()
+	expected := "k=\"v\" calls=1 \nk=\"v\" calls=2"
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test that the generator of pairs is not called for the records
+// filtered out by the sinks.
+func TestLogger_WithGeneratorFiltered_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).HasNotValue("skipped", "true").Start()
+	defer out.Close()
+	var calls int
+
+	log.With(func() []Pair {
+		calls++
+		return []Pair{{"calls", fmt.Sprint(calls), nil, IntegerVal}}
+	})
+	log.Log("skipped", true)
+	log.Log("skipped", false)
+
+	out.Flush()
+	expected := "calls=1 skipped=false"
+	if calls != 1 || strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v (%d calls)", expected, output.String(), calls)
+		t.Fail()
+	}
+}
+
+// Test of the records validated against the logger schema.
+func TestLogger_Schema_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	schema := NewSchema("v2").Require("level", StringVal).Enum("level", "info", "error").Optional("took", IntegerVal)
+	log := New().Schema(schema)
+	out := SinkTo(output, AsLogfmt()).HasKey(SchemaKey).Start()
+	defer out.Close()
+
+	log.Log("level", "info", "took", 12)
+	log.Log("level", "fatal", "took", "long")
+	log.Log("took", 1)
+
+	out.Flush()
+	expected := `schema="v2" level="info" took=12 ` + "\n" +
+		`schema="v2" level="fatal" took="long" schema-error="level: unexpected value \"fatal\"; took: unexpected kind of value" ` + "\n" +
+		`schema="v2" took=1 schema-error="level: required key missed" ` + "\n"
+	if output.String() != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of the leveled methods and the sink filter by level.
+func TestLogger_Levels_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New().Prefix("lvl")
+	out := SinkTo(output, AsLogfmt()).HasKey("lvl.k").WithLevelAtLeast("warning").Start()
+	defer out.Close()
+
+	log.Debug("k", 1)
+	log.Info("k", 2)
+	log.Warn("k", 3)
+	log.Error("k", 4)
+
+	out.Flush()
+	expected := "level=\"warning\" lvl.k=3 \nlevel=\"error\" lvl.k=4 \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test that the records without the level pass the sink filter by
+// level.
+func TestLogger_LevelsWithoutLevel_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).WithLevelAtLeast("warning").Start()
+	defer out.Close()
+
+	log.Info("k", 1)
+	log.Log("k", 2)
+
+	out.Flush()
+	expected := "k=2 \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of the minimal levels of the logger and the global level.
+func TestLogger_SetLevel_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New().Prefix("setlvl")
+	out := SinkTo(output, AsLogfmt()).HasKey("setlvl.k").Start()
+	defer out.Close()
+
+	SetGlobalLevel("warning")
+	log.Info("k", 1)
+	log.Fork().SetLevel("debug").Debug("k", 2)
+	log.Warn("k", 3)
+	SetGlobalLevel("")
+	log.SetLevel("error").Warn("k", 4)
+	log.SetLevel("").Debug("k", 5)
+
+	out.Flush()
+	expected := "level=\"debug\" setlvl.k=2 \nlevel=\"warning\" setlvl.k=3 \nlevel=\"debug\" setlvl.k=5 \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of the records of Fatal() and Panic() written before the exit.
+func TestLogger_FatalAndPanic_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New().Prefix("fatal")
+	out := SinkTo(output, AsLogfmt()).HasKey("fatal.k").Start()
+	defer out.Close()
+	var status int
+	exit = func(code int) { status = code }
+	defer func() { exit = os.Exit }()
+	var recovered interface{}
+
+	log.Fatal("k", 1)
+	func() {
+		defer func() { recovered = recover() }()
+		log.Panic("k", 2, "msg", "broken")
+	}()
+
+	expected := "level=\"fatal\" fatal.k=1 \nlevel=\"panic\" fatal.k=2 fatal.msg=\"broken\" \n"
+	if output.String() != expected || status != 1 || recovered != "k=2 msg=broken" {
+		t.Logf("expected %q got %q with status %d and panic %v", expected, output.String(), status, recovered)
+		t.Fail()
+	}
+}
+
+// Test that Fatal() and Panic() flush the asynchronous sinks of the
+// own collector of the logger.
+func TestLogger_FatalAndPanicCollector_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).Async(16, Block).Start()
+	defer out.Close()
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+
+	log.Fatal("k", 1)
+	func() {
+		defer func() { recover() }()
+		log.Panic("k", 2)
+	}()
+
+	expected := "level=\"fatal\" k=1 \nlevel=\"panic\" k=2 \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test that the muted logger exits and panics without the records.
+func TestLogger_FatalAndPanicMuted_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	var status int
+	exit = func(code int) { status = code }
+	defer func() { exit = os.Exit }()
+	var recovered interface{}
+
+	log.When(false).Fatal("k", 1)
+	func() {
+		defer func() { recovered = recover() }()
+		log.Unless(true).Panic("k", 2)
+	}()
+
+	out.Flush()
+	if output.String() != "" || status != 1 || recovered != "k=2" {
+		t.Logf("expected no output got %q with status %d and panic %v", output.String(), status, recovered)
+		t.Fail()
+	}
+}
+
+// Test of the typed Add methods and reusing of their pairs.
+func TestLogger_TypedAdd_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New().Prefix("typed")
+	out := SinkTo(output, AsLogfmt()).HasKey("typed.s").Start()
+	defer out.Close()
+
+	log.AddString("s", "a").AddInt("i", -2).AddUint("u", 3).AddBool("b", true).Log()
+	log.AddString("s", "b").AddFloat("f", 0.5).Log()
+
+	out.Flush()
+	expected := "typed.s=\"a\" typed.i=-2 typed.u=3 typed.b=true \ntyped.s=\"b\" typed.f=5e-01 \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of the fields passed as the maps.
+func TestLogger_WithFields_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).HasKey("fields.k").Start()
+	defer out.Close()
+
+	log.WithFields(Fields{"fields.k": 1, "addr": "a"})
+	log.LogFields(map[string]interface{}{"z": true, "b": 2})
+
+	out.Flush()
+	expected := "addr=\"a\" fields.k=1 b=2 z=true \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
@@ -102,6 +102,23 @@ func BenchmarkLevelsKiwi_Logfmt(b *testing.B) {
 	out.Close()
 }
 
+func BenchmarkLevelsKiwi_Null(b *testing.B) {
+	b.ResetTimer()
+	l := level.New()
+	l.With("_n", "bench", "_p", pid)
+	l.With(timestamp.Set(time.RFC3339))
+	level.LevelName = "l"
+	out := kiwi.SinkToNull().Start()
+	for i := 0; i < b.N; i++ {
+		l.Debug("key", 1, "key2", 3.141592, "key3", "string", "key4", false)
+		l.Info("key", 1, "key2", 3.141592, "key3", "string", "key4", false)
+		l.Warn("key", 1, "key2", 3.141592, "key3", "string", "key4", false)
+		l.Error("key", 1, "key2", 3.141592, "key3", "string", "key4", false)
+	}
+	b.StopTimer()
+	out.Stop()
+}
+
 func BenchmarkLevelsKiwiComplex_Logfmt(b *testing.B) {
 	buf := &bytes.Buffer{}
 	b.ResetTimer()
@@ -133,3 +150,30 @@ func BenchmarkLevelsKiwiGlobal_Logfmt(b *testing.B) {
 	b.StopTimer()
 	out.Close()
 }
+
+func BenchmarkKiwiTyped_Null(b *testing.B) {
+	l := kiwi.New()
+	l.With("_n", "bench", "_p", pid)
+	out := kiwi.SinkToNull().Start()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.AddInt("key", 1).AddFloat("key2", 3.141592).AddString("key3", "string").AddBool("key4", false).Log()
+	}
+	b.StopTimer()
+	out.Stop()
+}
+
+func BenchmarkKiwiTyped_Logfmt(b *testing.B) {
+	buf := &bytes.Buffer{}
+	l := kiwi.New()
+	l.With("_n", "bench", "_p", pid)
+	out := kiwi.SinkTo(buf, kiwi.AsLogfmt()).Start()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.AddInt("key", 1).AddFloat("key2", 3.141592).AddString("key3", "string").AddBool("key4", false).Log()
+	}
+	b.StopTimer()
+	out.Close()
+}
@@ -0,0 +1,158 @@
+package kiwi
+
+// This file consists of the formatting of the durations and the byte sizes.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Bytes is the size in bytes. It is rendered according to
+// BytesFormat:
+//
+//	log.Log("size", kiwi.Bytes(4404019)) // size="4.2MiB"
+type Bytes int64
+
+// String returns the size in the mode of BytesFormat.
+func (b Bytes) String() string {
+	var str, _ = measure{n: int64(b)}.render(BytesFormat)
+	return str
+}
+
+// Modes of Bytes to String conversion.
+const (
+	// BytesIEC renders the sizes with binary units: "4.2MiB".
+	BytesIEC = iota
+	// BytesSI renders the sizes with decimal units: "4.4MB".
+	BytesSI
+	// BytesInteger renders the sizes as integer number of bytes.
+	BytesInteger
+)
+
+// BytesFormat used in Bytes to String conversion.
+var BytesFormat = BytesIEC
+
+// measure keeps the duration or the size in the pair so the sinks
+// could render it in their own way (see Sink.DurationFormat() and
+// Sink.BytesFormat()).
+type measure struct {
+	n        int64
+	duration bool
+}
+
+// render returns the value in the mode of DurationFormat or
+// BytesFormat.
+func (m measure) render(mode int) (string, int) {
+	if m.duration {
+		var d = time.Duration(m.n)
+		switch mode {
+		case DurationInteger:
+			return strconv.FormatInt(m.n, 10), IntegerVal
+		case DurationISO8601:
+			return formatISO8601Duration(d), StringVal
+		case DurationMillis:
+			return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64), FloatVal
+		}
+		return d.String(), StringVal
+	}
+	switch mode {
+	case BytesSI:
+		return formatBytes(m.n, 1000, "kMGTPE", ""), StringVal
+	case BytesInteger:
+		return strconv.FormatInt(m.n, 10), IntegerVal
+	}
+	return formatBytes(m.n, 1024, "KMGTPE", "i"), StringVal
+}
+
+// formatBytes formats the size with a single digit of the fraction.
+func formatBytes(n int64, base int64, prefixes, infix string) string {
+	var u = uint64(n)
+	if n < 0 {
+		u = -u
+	}
+	if u < uint64(base) {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	var (
+		f = float64(u)
+		i = -1
+	)
+	for f >= float64(base) && i < len(prefixes)-1 {
+		f /= float64(base)
+		i++
+	}
+	var str = strconv.FormatFloat(f, 'f', 1, 64)
+	if len(str) > 2 && str[len(str)-2:] == ".0" {
+		str = str[:len(str)-2]
+	}
+	if n < 0 {
+		str = "-" + str
+	}
+	return str + prefixes[i:i+1] + infix + "B"
+}
+
+// DurationFormat overrides the global DurationFormat for the sink.
+// So a sink for humans could display "1.25s" while a sink for
+// machines writes 1250 milliseconds.
+func (s *Sink) DurationFormat(mode int) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.durationFormat = &mode
+		s.Unlock()
+	}
+	return s
+}
+
+// BytesFormat overrides the global BytesFormat for the values of
+// Bytes type in the sink.
+func (s *Sink) BytesFormat(mode int) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.bytesFormat = &mode
+		s.Unlock()
+	}
+	return s
+}
+
+// rendered returns the value of the pair rendered by the modes of the
+// sink.
+func (s *Sink) rendered(m measure, val string, valType int) (string, int) {
+	switch {
+	case m.duration && s.durationFormat != nil:
+		return m.render(*s.durationFormat)
+	case !m.duration && s.bytesFormat != nil:
+		return m.render(*s.bytesFormat)
+	}
+	return val, valType
+}
@@ -0,0 +1,115 @@
+package kiwi
+
+// This file consists of the sink keeping the last records in memory.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrNotRing returned by Dump() of the sink not created by
+// SinkToRing().
+var ErrNotRing = errors.New("the sink does not keep the records in memory")
+
+// memoryRing keeps the last n records written to it.
+type memoryRing struct {
+	sync.Mutex
+	records [][]byte
+	next    int
+	full    bool
+}
+
+// SinkToRing creates the sink that keeps the last n formatted records
+// in memory instead of writing them out. It is stopped by default
+// like the sink of SinkTo() and it formats the records with
+// AsLogfmt(). The records are written out with Dump() when they are
+// needed. So the debug records could be kept without writing them
+// to disk and dumped by the panic handler:
+//
+//	var history = kiwi.SinkToRing(1000).Start()
+//	...
+//	defer func() {
+//		if r := recover(); r != nil {
+//			history.Dump(os.Stderr)
+//			panic(r)
+//		}
+//	}()
+func SinkToRing(n int) *Sink {
+	if n < 1 {
+		n = 1
+	}
+	return SinkTo(&memoryRing{records: make([][]byte, n)}, AsLogfmt())
+}
+
+// Write keeps the copy of the record replacing the oldest one if the
+// ring is full.
+func (r *memoryRing) Write(p []byte) (int, error) {
+	r.Lock()
+	r.records[r.next] = append(r.records[r.next][:0], p...)
+	r.next++
+	if r.next == len(r.records) {
+		r.next = 0
+		r.full = true
+	}
+	r.Unlock()
+	return len(p), nil
+}
+
+// dump writes the records from the oldest to the newest.
+func (r *memoryRing) dump(w io.Writer) error {
+	r.Lock()
+	defer r.Unlock()
+	var records = r.records[:r.next]
+	if r.full {
+		records = append(r.records[r.next:len(r.records):len(r.records)], records...)
+	}
+	for _, record := range records {
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump writes the records kept by the sink created by SinkToRing()
+// to the writer, the oldest record goes first. The records queued by
+// the sink are flushed before (see Flush()). The records are kept in
+// the sink after dumping. It returns ErrNotRing for the other sinks.
+func (s *Sink) Dump(w io.Writer) error {
+	var ring, ok = s.writer.(*memoryRing)
+	if !ok {
+		return ErrNotRing
+	}
+	s.Flush()
+	return ring.dump(w)
+}
@@ -0,0 +1,119 @@
+//go:build prometheus
+// +build prometheus
+
+package metrics
+
+// Collector of the metrics for the Prometheus client library.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"github.com/grafov/kiwi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements prometheus.Collector for the metrics of the
+// logging pipeline. It is built with "prometheus" build tag:
+//
+//	prometheus.MustRegister(metrics.NewCollector())
+type Collector struct {
+	records   *prometheus.Desc
+	levels    *prometheus.Desc
+	counters  []*prometheus.Desc
+	fill      *prometheus.Desc
+	depth     *prometheus.Desc
+	highWater *prometheus.Desc
+	healthy   *prometheus.Desc
+	latency   *prometheus.Desc
+}
+
+// NewCollector creates the collector. The names of the metrics are
+// the same as served by Handler().
+func NewCollector() *Collector {
+	var c = &Collector{
+		records:   prometheus.NewDesc(Namespace+"_records_logged_total", recordsHelp, nil, nil),
+		levels:    prometheus.NewDesc(Namespace+"_records_total", levelsHelp, []string{"level"}, nil),
+		fill:      prometheus.NewDesc(Namespace+"_sink_queue_fill", queueFillHelp, []string{"sink"}, nil),
+		depth:     prometheus.NewDesc(Namespace+"_sink_queue_depth", queueDepthHelp, []string{"sink"}, nil),
+		highWater: prometheus.NewDesc(Namespace+"_sink_queue_high_water", highWaterHelp, []string{"sink"}, nil),
+		healthy:   prometheus.NewDesc(Namespace+"_sink_healthy", healthyHelp, []string{"sink"}, nil),
+		latency:   prometheus.NewDesc(Namespace+"_sink_write_seconds", writeLatencyHelp, []string{"sink"}, nil),
+	}
+	for _, counter := range sinkCounters {
+		c.counters = append(c.counters, prometheus.NewDesc(Namespace+"_"+counter.name, counter.help, []string{"sink"}, nil))
+	}
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.records
+	ch <- c.levels
+	for _, desc := range c.counters {
+		ch <- desc
+	}
+	ch <- c.fill
+	ch <- c.depth
+	ch <- c.highWater
+	ch <- c.healthy
+	ch <- c.latency
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.records, prometheus.CounterValue, float64(kiwi.RecordsLogged()))
+	for level, n := range kiwi.LevelCounts() {
+		ch <- prometheus.MustNewConstMetric(c.levels, prometheus.CounterValue, float64(n), level)
+	}
+	for _, s := range snapshot() {
+		for i, counter := range sinkCounters {
+			ch <- prometheus.MustNewConstMetric(c.counters[i], prometheus.CounterValue, float64(counter.value(s.stats)), s.label)
+		}
+		ch <- prometheus.MustNewConstMetric(c.fill, prometheus.GaugeValue, s.stats.QueueFill, s.label)
+		ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(s.stats.QueueDepth), s.label)
+		ch <- prometheus.MustNewConstMetric(c.highWater, prometheus.GaugeValue, float64(s.stats.QueueHighWater), s.label)
+		var healthy float64
+		if s.healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.healthy, prometheus.GaugeValue, healthy, s.label)
+		var (
+			h          = s.stats.WriteLatency
+			buckets    = make(map[float64]uint64, len(kiwi.LatencyBounds))
+			cumulative uint64
+		)
+		for i, bound := range kiwi.LatencyBounds {
+			cumulative += h.Counts[i]
+			buckets[bound.Seconds()] = cumulative
+		}
+		ch <- prometheus.MustNewConstHistogram(c.latency, h.Count, h.Sum.Seconds(), buckets, s.label)
+	}
+}
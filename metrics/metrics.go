@@ -0,0 +1,187 @@
+package metrics
+
+// Metrics of the logging pipeline in Prometheus formats.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/kiwi"
+)
+
+// Namespace is the prefix of the names of the metrics.
+var Namespace = "kiwi"
+
+// counter is the counter of the sink taken from its stats.
+type counter struct {
+	name  string
+	help  string
+	value func(kiwi.SinkStats) uint64
+}
+
+// sinkCounters are exported for each sink with "sink" label.
+var sinkCounters = []counter{
+	{"sink_written_total", "Successful writes to the output of the sink.", func(s kiwi.SinkStats) uint64 { return s.Written }},
+	{"sink_failed_total", "Records not written because of the output errors or timeouts.", func(s kiwi.SinkStats) uint64 { return s.Failed }},
+	{"sink_dropped_total", "Records dropped by the sink without writing.", func(s kiwi.SinkStats) uint64 { return s.Dropped }},
+	{"sink_filtered_total", "Records rejected by the filters of the sink.", func(s kiwi.SinkStats) uint64 { return s.Filtered }},
+	{"sink_sampled_total", "Records skipped by the sampling.", func(s kiwi.SinkStats) uint64 { return s.Sampled }},
+	{"sink_shed_total", "Low severity records shed under the load.", func(s kiwi.SinkStats) uint64 { return s.Shed }},
+	{"sink_invalid_total", "Records that violate the schema of the sink.", func(s kiwi.SinkStats) uint64 { return s.Invalid }},
+	{"sink_deduplicated_total", "Repeated records suppressed by the deduplication.", func(s kiwi.SinkStats) uint64 { return s.Deduplicated }},
+	{"sink_guarded_total", "Records that broke the limits of the guard.", func(s kiwi.SinkStats) uint64 { return s.Guarded }},
+}
+
+const (
+	recordsHelp      = "Records logged by all the loggers."
+	levelsHelp       = "Logged records by the level."
+	queueFillHelp    = "Filled part of the sink queue (0-1)."
+	queueDepthHelp   = "Records in the sink queue."
+	highWaterHelp    = "Maximal number of the records in the sink queue."
+	healthyHelp      = "Whether the last write to the output succeeded in time (1 or 0)."
+	writeLatencyHelp = "Time spent for the writes to the output of the sink."
+)
+
+// sinkStats is the snapshot of the counters of the sink.
+type sinkStats struct {
+	label   string
+	stats   kiwi.SinkStats
+	healthy bool
+}
+
+// snapshot takes the counters of all the sinks. The sinks without
+// names (see kiwi.Sink.Named()) labeled by their order numbers.
+func snapshot() []sinkStats {
+	var sinks = kiwi.Sinks()
+	var stats = make([]sinkStats, len(sinks))
+	for i, s := range sinks {
+		var label = s.Name()
+		if label == "" {
+			label = strconv.Itoa(i)
+		}
+		stats[i] = sinkStats{label: label, stats: s.Stats(), healthy: s.Healthy()}
+	}
+	return stats
+}
+
+// Handler serves the metrics in Prometheus text exposition format so
+// they could be scraped without the Prometheus client library:
+//
+//	http.Handle("/metrics", metrics.Handler())
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Write writes the metrics in Prometheus text exposition format.
+func Write(w io.Writer) error {
+	var (
+		out   = bufio.NewWriter(w)
+		sinks = snapshot()
+	)
+	header(out, "records_logged_total", recordsHelp, "counter")
+	sample(out, "records_logged_total", "", kiwi.RecordsLogged())
+	header(out, "records_total", levelsHelp, "counter")
+	for level, n := range kiwi.LevelCounts() {
+		sample(out, "records_total", label("level", level), n)
+	}
+	for _, c := range sinkCounters {
+		header(out, c.name, c.help, "counter")
+		for _, s := range sinks {
+			sample(out, c.name, label("sink", s.label), c.value(s.stats))
+		}
+	}
+	header(out, "sink_queue_fill", queueFillHelp, "gauge")
+	for _, s := range sinks {
+		out.WriteString(Namespace + "_sink_queue_fill" + label("sink", s.label) + " " + formatFloat(s.stats.QueueFill) + "\n")
+	}
+	header(out, "sink_queue_depth", queueDepthHelp, "gauge")
+	for _, s := range sinks {
+		sample(out, "sink_queue_depth", label("sink", s.label), uint64(s.stats.QueueDepth))
+	}
+	header(out, "sink_queue_high_water", highWaterHelp, "gauge")
+	for _, s := range sinks {
+		sample(out, "sink_queue_high_water", label("sink", s.label), uint64(s.stats.QueueHighWater))
+	}
+	header(out, "sink_healthy", healthyHelp, "gauge")
+	for _, s := range sinks {
+		var healthy uint64
+		if s.healthy {
+			healthy = 1
+		}
+		sample(out, "sink_healthy", label("sink", s.label), healthy)
+	}
+	header(out, "sink_write_seconds", writeLatencyHelp, "histogram")
+	for _, s := range sinks {
+		var (
+			h          = s.stats.WriteLatency
+			cumulative uint64
+			sinkLabel  = `sink="` + escape(s.label) + `"`
+		)
+		for i, bound := range kiwi.LatencyBounds {
+			cumulative += h.Counts[i]
+			sample(out, "sink_write_seconds_bucket", "{"+sinkLabel+`,le="`+formatFloat(bound.Seconds())+`"}`, cumulative)
+		}
+		sample(out, "sink_write_seconds_bucket", "{"+sinkLabel+`,le="+Inf"}`, h.Count)
+		out.WriteString(Namespace + "_sink_write_seconds_sum{" + sinkLabel + "} " + formatFloat(h.Sum.Seconds()) + "\n")
+		sample(out, "sink_write_seconds_count", "{"+sinkLabel+"}", h.Count)
+	}
+	return out.Flush()
+}
+
+func header(out *bufio.Writer, name, help, kind string) {
+	out.WriteString("# HELP " + Namespace + "_" + name + " " + help + "\n")
+	out.WriteString("# TYPE " + Namespace + "_" + name + " " + kind + "\n")
+}
+
+func sample(out *bufio.Writer, name, labels string, val uint64) {
+	out.WriteString(Namespace + "_" + name + labels + " " + strconv.FormatUint(val, 10) + "\n")
+}
+
+func label(name, val string) string {
+	return "{" + name + `="` + escape(val) + `"}`
+}
+
+// escape escapes the value of the label.
+func escape(val string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(val)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,104 @@
+package metrics
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/grafov/kiwi"
+)
+
+// Test of the metrics of the named sink in text format. The counters
+// are global for the process so their increments are checked.
+func TestWrite_Sink(t *testing.T) {
+	out := kiwi.SinkTo(bytes.NewBufferString(""), kiwi.AsLogfmt()).Named("metrics-test").HasValue("metrics-key", "pass").Start()
+	before := bytes.NewBufferString("")
+	Write(before)
+	kiwi.Log("metrics-key", "pass", "level", "warning")
+	kiwi.Log("metrics-key", "reject", "level", "trace")
+	output := bytes.NewBufferString("")
+
+	Write(output)
+
+	out.Close()
+	for _, expected := range []struct {
+		metric string
+		delta  float64
+	}{
+		{`kiwi_records_total{level="warning"}`, 1},
+		{`kiwi_records_total{level="other"}`, 1},
+		{`kiwi_sink_written_total{sink="metrics-test"}`, 1},
+		{`kiwi_sink_filtered_total{sink="metrics-test"}`, 1},
+		{`kiwi_sink_write_seconds_bucket{sink="metrics-test",le="+Inf"}`, 1},
+		{`kiwi_sink_write_seconds_count{sink="metrics-test"}`, 1},
+	} {
+		delta := value(output.String(), expected.metric) - value(before.String(), expected.metric)
+		if delta != expected.delta {
+			t.Logf("expected %s increased by %v got %v in %s", expected.metric, expected.delta, delta, output.String())
+			t.Fail()
+		}
+	}
+	for _, expected := range []string{
+		`kiwi_sink_queue_depth{sink="metrics-test"} 0`,
+		"# TYPE kiwi_sink_queue_high_water gauge",
+		"# TYPE kiwi_sink_write_seconds histogram",
+	} {
+		if !strings.Contains(output.String(), expected+"\n") {
+			t.Logf("expected %s in %s", expected, output.String())
+			t.Fail()
+		}
+	}
+}
+
+// value returns the value of the metric in the text format or zero if
+// the metric is absent.
+func value(text, metric string) float64 {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, metric+" ") {
+			v, _ := strconv.ParseFloat(strings.TrimPrefix(line, metric+" "), 64)
+			return v
+		}
+	}
+	return 0
+}
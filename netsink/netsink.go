@@ -0,0 +1,511 @@
+package netsink
+
+// Sink writer that sends log records to the network sockets.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/grafov/kiwi/codec"
+)
+
+// Defaults for the writer. They may be changed per writer with
+// BatchSize(), BatchBytes(), FlushInterval() and MaxPending() methods.
+var (
+	DefaultBatchSize     = 64
+	DefaultBatchBytes    = 64 * 1024
+	DefaultFlushInterval = 100 * time.Millisecond
+	DefaultMaxPending    = 10000
+	DefaultDialTimeout   = 5 * time.Second
+	DefaultRetryInterval = time.Second
+)
+
+var (
+	// ErrClosed returned on writing to the closed writer.
+	ErrClosed = errors.New("network writer closed")
+	// ErrNotConnected returned when the records could not be sent
+	// because the connection is not established.
+	ErrNotConnected = errors.New("network writer not connected")
+)
+
+// dial is replaced in the tests.
+var dial = net.DialTimeout
+
+// Writer accumulates formatted records and sends them to the socket
+// in batches. The batch is written with net.Buffers so for TCP and
+// Unix sockets all the records of the batch are passed to the kernel
+// by a single writev syscall and they are not split to separate
+// packets. It conforms io.Writer so it may be used as the output for
+// kiwi.SinkTo():
+//
+//	w, err := netsink.Dial("tcp", "logs.example.com:5140")
+//	kiwi.SinkTo(w, kiwi.AsLogfmt()).Start()
+//
+// The records kept in the memory until the batch is full or the flush
+// interval is expired. If the connection was broken the writer dials
+// the address again on the next flush and the records stay pending
+// until then. Writer methods are safe for concurrent usage.
+type Writer struct {
+	network string
+	addr    string
+	tls     *tls.Config
+
+	sync.Mutex
+	conn       net.Conn
+	connecting bool
+	batchSize  int
+	batchBytes int
+	maxPending int
+	interval   time.Duration
+	codec      codec.Codec
+	pending    net.Buffers
+	size       int
+	dropped    int
+	lastErr    error
+	closed     bool
+	started    sync.Once
+	flushing   sync.Mutex
+	flush      chan struct{}
+	done       chan struct{}
+}
+
+// New creates a writer for the connection. The writer can't restore
+// the connection created outside so the records stay pending after
+// the connection was broken.
+func New(conn net.Conn) *Writer {
+	return &Writer{
+		conn:       conn,
+		batchSize:  DefaultBatchSize,
+		batchBytes: DefaultBatchBytes,
+		maxPending: DefaultMaxPending,
+		interval:   DefaultFlushInterval,
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// Dial connects to the address and creates a writer for the
+// connection. Unlike the writer created with New() it reconnects by
+// itself when the connection was broken.
+func Dial(network, addr string) (*Writer, error) {
+	return DialTLS(network, addr, nil)
+}
+
+// DialTLS is like Dial() but it establishes TLS connection with the
+// config. The server name for the certificate verification is taken
+// from the address when it is not set in the config. The config with
+// the client certificates enables mutual TLS (see LoadTLSConfig()).
+// Nil config means the plain connection.
+func DialTLS(network, addr string, config *tls.Config) (*Writer, error) {
+	w := New(nil)
+	w.network = network
+	w.addr = addr
+	w.tls = tlsConfig(addr, config)
+	conn, err := w.dial()
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+	return w, nil
+}
+
+// DialLazy creates a writer that connects to the address in
+// background. The writer accepts the records immediately so the
+// application is not blocked on startup. The records are kept in the
+// memory up to MaxPending() limit until the connection established,
+// the writer retries to dial every DefaultRetryInterval until then.
+func DialLazy(network, addr string) *Writer {
+	return DialLazyTLS(network, addr, nil)
+}
+
+// DialLazyTLS is like DialLazy() but it establishes TLS connection
+// with the config (see DialTLS()).
+func DialLazyTLS(network, addr string, config *tls.Config) *Writer {
+	w := New(nil)
+	w.network = network
+	w.addr = addr
+	w.tls = tlsConfig(addr, config)
+	w.connecting = true
+	go w.connect()
+	return w
+}
+
+// LoadTLSConfig creates TLS config that verifies the server with the
+// CA certificates from the PEM file instead of the system ones (when
+// caFile is not empty) and presents the client certificate from the
+// PEM files for mutual TLS (when certFile is not empty). TLS 1.2 is
+// the minimal version allowed. The returned config may be adjusted
+// before passing to DialTLS().
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	var config = &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// tlsConfig returns the copy of the config with the server name
+// taken from the address if it is not set.
+func tlsConfig(addr string, config *tls.Config) *tls.Config {
+	if config == nil {
+		return nil
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+	return config
+}
+
+// BatchSize sets number of the records that sent by a single write.
+func (w *Writer) BatchSize(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.batchSize = n
+		w.Unlock()
+	}
+	return w
+}
+
+// BatchBytes sets the size of the batch in bytes. The batch is sent
+// when it is reached regardless of number of the records.
+func (w *Writer) BatchBytes(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.batchBytes = n
+		w.Unlock()
+	}
+	return w
+}
+
+// FlushInterval sets how long the records may wait in the memory
+// until the batch will be filled. It should be set before the first
+// record will be written.
+func (w *Writer) FlushInterval(d time.Duration) *Writer {
+	if d > 0 {
+		w.Lock()
+		w.interval = d
+		w.Unlock()
+	}
+	return w
+}
+
+// MaxPending restricts number of the records kept in the memory when
+// the connection is broken. The oldest records are dropped when the
+// limit is reached.
+func (w *Writer) MaxPending(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.maxPending = n
+		w.Unlock()
+	}
+	return w
+}
+
+// Compress sets the codec for compression of the batches. Each batch
+// is compressed separately and sent as a single write. The batches
+// compressed by gzip form the valid multimember gzip stream. Nil
+// codec disables the compression.
+func (w *Writer) Compress(c codec.Codec) *Writer {
+	w.Lock()
+	w.codec = c
+	w.Unlock()
+	return w
+}
+
+// Write adds a single formatted record to the batch. The record is
+// copied because the sink reuses its buffer. Write never blocks on
+// the network. It returns the error of the last failed flush if any,
+// the error is reported only once.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.started.Do(func() { go w.flusher() })
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return 0, ErrClosed
+	}
+	if len(p) > 0 {
+		if len(w.pending) >= w.maxPending {
+			w.size -= len(w.pending[0])
+			w.pending = w.pending[1:]
+			w.dropped++
+		}
+		w.pending = append(w.pending, append([]byte(nil), p...))
+		w.size += len(p)
+	}
+	var full = len(w.pending) >= w.batchSize || w.size >= w.batchBytes
+	var err = w.lastErr
+	w.lastErr = nil
+	w.Unlock()
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), err
+}
+
+// Dropped returns number of the records that were dropped because of
+// MaxPending limit.
+func (w *Writer) Dropped() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.dropped
+}
+
+// Flush sends all pending records to the socket. Each batch is sent
+// by a single vectored write.
+func (w *Writer) Flush() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+	for {
+		w.Lock()
+		if w.connecting {
+			// The records wait for the connection.
+			w.Unlock()
+			return nil
+		}
+		var (
+			batch net.Buffers
+			size  int
+		)
+		for len(batch) < len(w.pending) && len(batch) < w.batchSize && size < w.batchBytes {
+			size += len(w.pending[len(batch)])
+			batch = w.pending[: len(batch)+1 : len(batch)+1]
+		}
+		w.pending = w.pending[len(batch):]
+		w.size -= size
+		var (
+			conn = w.conn
+			c    = w.codec
+		)
+		w.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		var err = ErrNotConnected
+		switch {
+		case conn == nil:
+		case c != nil:
+			// The whole batch is sent again on error because the
+			// compressed data can't be split by the records.
+			err = sendCompressed(conn, c, batch)
+		default:
+			// WriteTo consumes the written buffers so only the
+			// unsent tail of the batch is left in it on error.
+			_, err = batch.WriteTo(conn)
+		}
+		if err != nil {
+			w.Lock()
+			w.requeue(batch)
+			w.lastErr = err
+			w.Unlock()
+			w.reconnect(conn)
+			return err
+		}
+	}
+}
+
+// Close flushes pending records and closes the connection. The
+// records buffered by the lazy writer that not connected yet are
+// lost and ErrNotConnected returned.
+func (w *Writer) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.Unlock()
+	w.started.Do(func() {})
+	close(w.done)
+	var err = w.Flush()
+	w.Lock()
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	if err == nil && w.connecting && len(w.pending) > 0 {
+		err = ErrNotConnected
+	}
+	w.Unlock()
+	return err
+}
+
+// connect dials the address in background until the connection
+// established or the writer closed.
+func (w *Writer) connect() {
+	for {
+		conn, err := w.dial()
+		if err == nil {
+			w.Lock()
+			if w.closed {
+				w.Unlock()
+				conn.Close()
+				return
+			}
+			w.conn = conn
+			w.connecting = false
+			w.Unlock()
+			// Send the records buffered before the connection.
+			w.started.Do(func() { go w.flusher() })
+			select {
+			case w.flush <- struct{}{}:
+			default:
+			}
+			return
+		}
+		select {
+		case <-w.done:
+			return
+		case <-time.After(DefaultRetryInterval):
+		}
+	}
+}
+
+func (w *Writer) flusher() {
+	w.Lock()
+	var ticker = time.NewTicker(w.interval)
+	w.Unlock()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.flush:
+		}
+		w.Flush()
+	}
+}
+
+// sendCompressed compresses the batch with the codec and writes the
+// result to the connection. The batch is not changed.
+func sendCompressed(conn net.Conn, c codec.Codec, batch net.Buffers) error {
+	var buf bytes.Buffer
+	cw, err := c.NewWriter(&buf)
+	if err != nil {
+		return err
+	}
+	if _, err = batch.WriteTo(cw); err != nil {
+		return err
+	}
+	if err = cw.Close(); err != nil {
+		return err
+	}
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
+
+// requeue returns unsent records back to the head of the queue. It
+// should be called under the lock.
+func (w *Writer) requeue(batch net.Buffers) {
+	var size int
+	for _, b := range batch {
+		size += len(b)
+	}
+	w.pending = append(batch[:len(batch):len(batch)], w.pending...)
+	w.size += size
+	for len(w.pending) > w.maxPending {
+		w.size -= len(w.pending[0])
+		w.pending = w.pending[1:]
+		w.dropped++
+	}
+}
+
+// reconnect dials the address again if the writer was created by
+// Dial(). The broken connection is closed. The address dialed without
+// the lock so Write() is not blocked meanwhile.
+func (w *Writer) reconnect(broken net.Conn) {
+	w.Lock()
+	var skip = w.addr == "" || w.conn != broken || w.closed
+	w.Unlock()
+	if skip {
+		return
+	}
+	conn, err := w.dial()
+	if err != nil {
+		return
+	}
+	w.Lock()
+	if w.conn != broken || w.closed {
+		// Reconnected by other flush or closed meanwhile.
+		w.Unlock()
+		conn.Close()
+		return
+	}
+	w.conn = conn
+	w.Unlock()
+	if broken != nil {
+		broken.Close()
+	}
+}
+
+// dial connects to the address of the writer through the proxy (see
+// Proxy) and completes TLS handshake if TLS is used.
+func (w *Writer) dial() (net.Conn, error) {
+	conn, err := dialProxy(w.network, w.addr, DefaultDialTimeout)
+	if err != nil || w.tls == nil {
+		return conn, err
+	}
+	var tlsConn = tls.Client(conn, w.tls)
+	conn.SetDeadline(time.Now().Add(DefaultDialTimeout))
+	if err = tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
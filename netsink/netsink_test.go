@@ -0,0 +1,383 @@
+package netsink
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafov/kiwi"
+	"github.com/grafov/kiwi/codec"
+)
+
+// brokenConn fails all writes.
+type brokenConn struct{ net.Conn }
+
+func (brokenConn) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+func (brokenConn) Close() error              { return nil }
+
+// Test the records sent to TCP socket in batches.
+func TestWriter_SendBatchesToTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	var received = make(chan []byte)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		received <- data
+	}()
+	w, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.BatchSize(2).FlushInterval(time.Hour)
+
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("k=\"v\"\n"))
+	}
+	w.Close()
+
+	data := <-received
+	if !bytes.Equal(data, bytes.Repeat([]byte("k=\"v\"\n"), 5)) {
+		t.Logf("unexpected data %q", data)
+		t.Fail()
+	}
+}
+
+// Test the unsent records stay pending when the connection broken.
+func TestWriter_KeepPendingOnError(t *testing.T) {
+	w := New(brokenConn{}).MaxPending(3).FlushInterval(time.Hour)
+	log := kiwi.New()
+	out := kiwi.SinkTo(w, kiwi.AsLogfmt()).HasKey("netsink-key").Start()
+
+	for i := 0; i < 5; i++ {
+		log.Log("netsink-key", i)
+	}
+	err := w.Flush()
+
+	out.Close()
+	w.Lock()
+	pending := len(w.pending)
+	w.Unlock()
+	if err == nil || w.Dropped() != 2 || pending != 3 {
+		t.Logf("expected error and 3 pending records but got %v, %d pending, %d dropped", err, pending, w.Dropped())
+		t.Fail()
+	}
+}
+
+// Test that Write() is not blocked while the writer reconnects.
+func TestWriter_WriteWhileReconnect(t *testing.T) {
+	var dialing, release = make(chan struct{}), make(chan struct{})
+	dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		close(dialing)
+		<-release
+		return nil, errors.New("connection refused")
+	}
+	defer func() { dial = net.DialTimeout }()
+	w := New(brokenConn{}).FlushInterval(time.Hour)
+	w.network, w.addr = "tcp", "logs.example.com:5140"
+	w.Write([]byte("k=1\n"))
+	go w.Flush()
+	<-dialing
+
+	written := make(chan struct{})
+	go func() {
+		w.Write([]byte("k=2\n"))
+		close(written)
+	}()
+	var blocked bool
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		blocked = true
+	}
+	close(release)
+
+	if blocked {
+		t.Log("expected Write() not blocked by the dial")
+		t.Fail()
+	}
+}
+
+// Test the lazy writer buffers the records until it connected.
+func TestWriter_LazyConnection(t *testing.T) {
+	var (
+		ready          = make(chan struct{})
+		client, server = net.Pipe()
+		received       = make(chan []byte)
+	)
+	dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		<-ready
+		return client, nil
+	}
+	defer func() { dial = net.DialTimeout }()
+	go func() {
+		data, _ := ioutil.ReadAll(server)
+		received <- data
+	}()
+	w := DialLazy("tcp", "logs.example.com:5140").FlushInterval(time.Hour)
+
+	w.Write([]byte("k=1\n"))
+	w.Write([]byte("k=2\n"))
+	errBefore := w.Flush()
+	close(ready)
+	for i := 0; i < 100; i++ {
+		w.Lock()
+		connecting := w.connecting
+		w.Unlock()
+		if !connecting {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	errAfter := w.Close()
+
+	data := <-received
+	if errBefore != nil || errAfter != nil || string(data) != "k=1\nk=2\n" {
+		t.Logf("expected buffered records sent after connection but got %q (%v, %v)", data, errBefore, errAfter)
+		t.Fail()
+	}
+}
+
+// selfSigned writes the self-signed certificate for 127.0.0.1 and its
+// key to PEM files in the dir.
+func selfSigned(t *testing.T, dir, name string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+// Test the records sent over mutual TLS.
+func TestWriter_MutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netsink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	serverCert, serverKey := selfSigned(t, dir, "server")
+	clientCert, clientKey := selfSigned(t, dir, "client")
+	serverConfig, err := LoadTLSConfig(clientCert, serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig.ClientCAs = serverConfig.RootCAs
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	var received = make(chan []byte)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		received <- data
+	}()
+	clientConfig, err := LoadTLSConfig(serverCert, clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := DialTLS("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("k=1\n"))
+	w.Close()
+
+	data := <-received
+	if string(data) != "k=1\n" {
+		t.Logf("unexpected data %q", data)
+		t.Fail()
+	}
+}
+
+// Test the connection tunneled through HTTP proxy.
+func TestWriter_HTTPProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	var (
+		received = make(chan []byte)
+		target   = make(chan string, 1)
+	)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			close(received)
+			return
+		}
+		target <- req.Method + " " + req.Host + " " + req.Header.Get("Proxy-Authorization")
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		data, _ := ioutil.ReadAll(reader)
+		received <- data
+	}()
+	proxy, _ := url.Parse("http://user:secret@" + ln.Addr().String())
+	Proxy = ProxyURL(proxy)
+	defer func() { Proxy = ProxyFromEnvironment }()
+
+	w, err := Dial("tcp", "logs.example.com:5140")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("k=1\n"))
+	w.Close()
+
+	data := <-received
+	if string(data) != "k=1\n" || <-target != "CONNECT logs.example.com:5140 Basic dXNlcjpzZWNyZXQ=" {
+		t.Logf("unexpected data %q", data)
+		t.Fail()
+	}
+}
+
+// Test SOCKS5 handshake with the proxy.
+func TestConnectSOCKS5(t *testing.T) {
+	client, server := net.Pipe()
+	var request = make(chan []byte, 1)
+	go func() {
+		greeting := make([]byte, 3)
+		io.ReadFull(server, greeting)
+		server.Write([]byte{5, 0})
+		// Header, address type, length and the domain name, port.
+		req := make([]byte, 5+len("logs.example.com")+2)
+		io.ReadFull(server, req)
+		request <- req
+		server.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0x14, 0x14})
+	}()
+
+	err := connectSOCKS5(client, "logs.example.com:5140", nil)
+
+	req := <-request
+	expected := append(append([]byte{5, 1, 0, 3, byte(len("logs.example.com"))}, "logs.example.com"...), 0x14, 0x14)
+	if err != nil || !bytes.Equal(req, expected) {
+		t.Logf("unexpected request %v: %v", req, err)
+		t.Fail()
+	}
+}
+
+// Test the batches compressed by gzip form the single stream.
+func TestWriter_CompressGzip(t *testing.T) {
+	client, server := net.Pipe()
+	var received = make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(server)
+		received <- data
+	}()
+	w := New(client).Compress(codec.Gzip).BatchSize(2).FlushInterval(time.Hour)
+
+	for i := 0; i < 3; i++ {
+		w.Write([]byte("k=\"v\"\n"))
+	}
+	w.Close()
+
+	zr, err := gzip.NewReader(bytes.NewReader(<-received))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(zr)
+	if !bytes.Equal(data, bytes.Repeat([]byte("k=\"v\"\n"), 3)) {
+		t.Logf("unexpected data %q", data)
+		t.Fail()
+	}
+}
@@ -0,0 +1,226 @@
+package netsink
+
+// Tunneling of the network writer connections through HTTP and SOCKS5 proxies.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Proxy returns the proxy for TCP connections to the address. Nil
+// URL means the direct connection. The schemes "http", "https" (HTTP
+// CONNECT tunnel) and "socks5", "socks5h" are supported. By default
+// the proxy is taken from HTTPS_PROXY and NO_PROXY environment
+// variables, set Proxy to nil to disable the proxies at all.
+var Proxy = ProxyFromEnvironment
+
+// ProxyFromEnvironment returns the proxy for the address from
+// HTTPS_PROXY environment variable unless the address excluded by
+// NO_PROXY. The connections to localhost never proxied.
+func ProxyFromEnvironment(addr string) (*url.URL, error) {
+	return http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+}
+
+// ProxyURL returns the Proxy function that always uses the fixed
+// proxy.
+func ProxyURL(proxy *url.URL) func(string) (*url.URL, error) {
+	return func(string) (*url.URL, error) { return proxy, nil }
+}
+
+// dialProxy connects to the address through the proxy if it is set
+// for the address.
+func dialProxy(network, addr string, timeout time.Duration) (net.Conn, error) {
+	if Proxy == nil || !strings.HasPrefix(network, "tcp") {
+		return dial(network, addr, timeout)
+	}
+	proxy, err := Proxy(addr)
+	if err != nil || proxy == nil {
+		if err != nil {
+			return nil, err
+		}
+		return dial(network, addr, timeout)
+	}
+	var proxyAddr = proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), defaultProxyPort(proxy.Scheme))
+	}
+	conn, err := dial(network, proxyAddr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	switch proxy.Scheme {
+	case "https":
+		var tlsConn = tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+		if err = tlsConn.Handshake(); err == nil {
+			conn = tlsConn
+			err = connectHTTP(conn, addr, proxy.User)
+		}
+	case "http":
+		err = connectHTTP(conn, addr, proxy.User)
+	case "socks5", "socks5h":
+		err = connectSOCKS5(conn, addr, proxy.User)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func defaultProxyPort(scheme string) string {
+	switch scheme {
+	case "https":
+		return "443"
+	case "socks5", "socks5h":
+		return "1080"
+	}
+	return "80"
+}
+
+// connectHTTP opens the tunnel with HTTP CONNECT request.
+func connectHTTP(conn net.Conn, addr string, user *url.Userinfo) error {
+	var req = "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if user != nil {
+		var password, _ = user.Password()
+		req += "Proxy-Authorization: Basic " +
+			base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)) + "\r\n"
+	}
+	if _, err := conn.Write([]byte(req + "\r\n")); err != nil {
+		return err
+	}
+	// The data buffered beyond the response would be lost but the
+	// log servers send nothing before the client writes to the
+	// tunnel.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("proxy: " + resp.Status)
+	}
+	return nil
+}
+
+// connectSOCKS5 opens the tunnel with SOCKS5 CONNECT command (RFC
+// 1928). The host name resolved by the proxy.
+func connectSOCKS5(conn net.Conn, addr string, user *url.Userinfo) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || len(host) > 255 {
+		return errors.New("socks5: invalid address " + addr)
+	}
+	// Greeting with the supported authentication methods.
+	var method byte = 0x00
+	if user != nil {
+		method = 0x02
+	}
+	if _, err = conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	var buf = make([]byte, 2, 262)
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != 5 || buf[1] != method {
+		return errors.New("socks5: authentication method not accepted")
+	}
+	if method == 0x02 {
+		var password, _ = user.Password()
+		var auth = append([]byte{1, byte(len(user.Username()))}, user.Username()...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err = conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return errors.New("socks5: authentication failed")
+		}
+	}
+	var req = []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else {
+		req = append(append(req, 4), ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+	// Reply: version, status, reserved, address type.
+	buf = buf[:4]
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[1] != 0 {
+		return fmt.Errorf("socks5: connect failed with code %d", buf[1])
+	}
+	// Skip the bound address and the port.
+	var skip int
+	switch buf[3] {
+	case 1:
+		skip = net.IPv4len + 2
+	case 4:
+		skip = net.IPv6len + 2
+	case 3:
+		if _, err = io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		skip = int(buf[0]) + 2
+	default:
+		return errors.New("socks5: invalid reply")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
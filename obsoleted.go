@@ -32,15 +32,8 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 ॐ तारे तुत्तारे तुरे स्व */
 
-// FlushAll should wait for all the sinks to be flushed. It does
-// nothing currently. It has left for compatibility with old API.
-func FlushAll() {
-	return
-}
-
-// Flush waits that all previously sent to the output records
-// worked. It does nothing currently. It has left for compatibility
+// FlushAll is the same as Flush(). It has left for compatibility
 // with old API.
-func (s *Sink) Flush() *Sink {
-	return s
+func FlushAll() {
+	Flush()
 }
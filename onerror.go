@@ -0,0 +1,83 @@
+package kiwi
+
+// Handlers of the failures of the writes to the sink outputs.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrWriteTimeout passed to the error handlers when the record was
+// not written within the deadline of the sink (see WriteTimeout()).
+var ErrWriteTimeout = errors.New("kiwi: write timeout")
+
+// ErrorHandler gets the error of the write to the output of the sink
+// and the formatted record that was not written. The record is only
+// valid during the call, copy it to keep it. The record is nil for
+// the errors of flushing the writer (see Flusher).
+type ErrorHandler func(err error, record []byte)
+
+// globalErrorHandler keeps ErrorHandler called for the sinks without
+// own handler.
+var globalErrorHandler atomic.Value
+
+// OnError sets the handler of the write failures for all sinks that
+// have no own handler (see Sink.OnError()). Nil removes the handler.
+func OnError(fn ErrorHandler) {
+	globalErrorHandler.Store(fn)
+}
+
+// OnError sets the handler called when the output of the sink fails
+// to write the record (broken pipe, full disk, closed connection
+// etc.) or the write was not finished in time. The handler called
+// from the goroutine of the sink so it should not block: it may count
+// the failures, log them elsewhere or switch the sink to another
+// output. Nil handler restores the global one (see OnError()).
+func (s *Sink) OnError(fn ErrorHandler) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.onError.Store(fn)
+	}
+	return s
+}
+
+// reportError passes the error to the handler of the sink or to the
+// global handler.
+func (s *Sink) reportError(err error, line []byte) {
+	var fn, _ = s.onError.Load().(ErrorHandler)
+	if fn == nil {
+		fn, _ = globalErrorHandler.Load().(ErrorHandler)
+	}
+	if fn != nil {
+		fn(err, line)
+	}
+}
@@ -0,0 +1,104 @@
+package kiwi
+
+// This file consists of the ordering of the keys of the records.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// The orders of the keys for Sink.OrderKeys().
+const (
+	// KeysInserted keeps the keys in order they were added to the
+	// record: the context first then the pairs of the record.
+	KeysInserted = iota
+	// KeysSorted sorts the keys alphabetically.
+	KeysSorted
+)
+
+type keyOrder struct {
+	sorted bool
+	first  map[string]int
+}
+
+// OrderKeys sets the order of the keys of the records written by the
+// sink. The keys listed in first go at the beginning of the record in
+// that order, the rest follow in the order set by the mode
+// (KeysInserted or KeysSorted). So the records have the same layout
+// wherever they were logged:
+//
+//	kiwi.SinkTo(os.Stdout, kiwi.AsLogfmt()).OrderKeys(kiwi.KeysSorted, "ts", "level", "msg").Start()
+//	// ts="2019-01-02T15:04:05Z" level="info" msg="started" addr=":80" pid=42
+//
+// KeysInserted without the keys restores the default order.
+func (s *Sink) OrderKeys(mode int, first ...string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if mode == KeysInserted && len(first) == 0 {
+			s.keyOrder = nil
+		} else {
+			var order = &keyOrder{sorted: mode == KeysSorted, first: make(map[string]int, len(first))}
+			for i, key := range first {
+				if _, ok := order.first[key]; !ok {
+					order.first[key] = i
+				}
+			}
+			s.keyOrder = order
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// apply returns the ordered copy of the record. The record itself is
+// shared by the sinks so it is not changed.
+func (o *keyOrder) apply(record []*Pair) []*Pair {
+	var ordered = make([]*Pair, len(record))
+	copy(ordered, record)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		var (
+			a, b    = ordered[i].Key, ordered[j].Key
+			ia, aok = o.first[a]
+			ib, bok = o.first[b]
+		)
+		switch {
+		case aok && bok:
+			return ia < ib
+		case aok || bok:
+			return aok
+		case o.sorted:
+			return a < b
+		}
+		return false
+	})
+	return ordered
+}
@@ -0,0 +1,188 @@
+//go:build otel
+// +build otel
+
+package otelkiwi
+
+// OpenTelemetry trace correlation and logs exporter for kiwi. Build with "otel" tag.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/grafov/kiwi"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys of the trace correlation pairs and of the record fields
+// recognized by Exporter.
+var (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+	TimeKey    = "time"
+)
+
+// FromContext returns trace_id and span_id pairs of the span active in
+// the context or nil if there is no valid span. Add them to the
+// context of the logger of the request:
+//
+//	log := kiwi.Fork().With(otelkiwi.FromContext(ctx))
+//	log.Log("msg", "order created")
+//	// trace_id="4bf92f3577b34da6a3ce929d0e0e4736" span_id="00f067aa0ba902b7" msg="order created"
+func FromContext(ctx context.Context) []*kiwi.Pair {
+	var sc = trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []*kiwi.Pair{
+		{Key: TraceIDKey, Val: sc.TraceID().String(), Type: kiwi.StringVal},
+		{Key: SpanIDKey, Val: sc.SpanID().String(), Type: kiwi.StringVal},
+	}
+}
+
+// Exporter passes the records of kiwi sink to the logger of
+// OpenTelemetry Logs API. It is both the formatter and the writer of
+// the sink:
+//
+//	e := otelkiwi.NewExporter(global.GetLoggerProvider().Logger("billing"))
+//	kiwi.SinkTo(e, e).Start()
+//
+// The value of kiwi.MessageKey becomes the body of the record, the
+// value of kiwi.SeverityKey becomes its severity and the time under
+// TimeKey becomes its timestamp. Other pairs are passed as the
+// attributes with their types. The record is emitted when it is
+// formatted so the sink should not be batched (see Sink.Batch()).
+type Exporter struct {
+	logger otellog.Logger
+	record otellog.Record
+	ctx    context.Context
+}
+
+// NewExporter creates the exporter for the OpenTelemetry logger.
+func NewExporter(logger otellog.Logger) *Exporter {
+	return &Exporter{logger: logger, ctx: context.Background()}
+}
+
+// Begin starts the record.
+func (e *Exporter) Begin() {
+	e.record = otellog.Record{}
+}
+
+// Pair adds the pair to the record. It is called when the sink not
+// recognized the exporter as kiwi.TypedFormatter.
+func (e *Exporter) Pair(key, val string, valType int) {
+	e.TypedPair(key, kiwi.TypedValue(val, valType), valType)
+}
+
+// TypedPair adds the pair to the record.
+func (e *Exporter) TypedPair(key string, val interface{}, valType int) {
+	switch key {
+	case kiwi.MessageKey:
+		if s, ok := val.(string); ok {
+			e.record.SetBody(otellog.StringValue(s))
+			return
+		}
+	case kiwi.SeverityKey:
+		if s, ok := val.(string); ok {
+			e.record.SetSeverityText(s)
+			e.record.SetSeverity(severity(s))
+			return
+		}
+	case TimeKey:
+		if t, ok := val.(time.Time); ok {
+			e.record.SetTimestamp(t)
+			return
+		}
+	}
+	e.record.AddAttributes(attribute(key, val))
+}
+
+// Finish emits the record. The sink gets nothing to write.
+func (e *Exporter) Finish() []byte {
+	if e.record.Timestamp().IsZero() {
+		e.record.SetTimestamp(time.Now())
+	}
+	e.logger.Emit(e.ctx, e.record)
+	return nil
+}
+
+// Write discards the output of the sink, the records are emitted by
+// Finish().
+func (e *Exporter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// attribute converts the value decoded by kiwi.TypedValue().
+func attribute(key string, val interface{}) otellog.KeyValue {
+	switch v := val.(type) {
+	case int64:
+		return otellog.Int64(key, v)
+	case uint64:
+		return otellog.String(key, strconv.FormatUint(v, 10))
+	case float64:
+		return otellog.Float64(key, v)
+	case bool:
+		return otellog.Bool(key, v)
+	case time.Time:
+		return otellog.String(key, v.Format(kiwi.TimeLayout))
+	case string:
+		return otellog.String(key, v)
+	case json.RawMessage:
+		return otellog.String(key, string(v))
+	case nil:
+		return otellog.KeyValue{Key: key}
+	default:
+		return otellog.String(key, fmt.Sprint(v))
+	}
+}
+
+// severity maps the severities of kiwi (see kiwi.Severities) to the
+// severity numbers of OpenTelemetry.
+func severity(level string) otellog.Severity {
+	switch level {
+	case "debug":
+		return otellog.SeverityDebug
+	case "warn", "warning":
+		return otellog.SeverityWarn
+	case "error":
+		return otellog.SeverityError
+	case "critical":
+		return otellog.SeverityError2
+	case "fatal", "panic":
+		return otellog.SeverityFatal
+	default:
+		return otellog.SeverityInfo
+	}
+}
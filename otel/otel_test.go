@@ -0,0 +1,109 @@
+//go:build otel
+// +build otel
+
+package otelkiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafov/kiwi"
+	otellog "go.opentelemetry.io/otel/log"
+)
+
+// Test of the conversion of the values to the attributes.
+func TestAttribute(t *testing.T) {
+	moment := time.Date(2019, 3, 1, 12, 30, 0, 0, time.UTC)
+	cases := []struct {
+		val      interface{}
+		expected otellog.KeyValue
+	}{
+		{int64(-42), otellog.Int64("k", -42)},
+		{uint64(18446744073709551615), otellog.String("k", "18446744073709551615")},
+		{1.5, otellog.Float64("k", 1.5)},
+		{true, otellog.Bool("k", true)},
+		{moment, otellog.String("k", moment.Format(kiwi.TimeLayout))},
+		{"text", otellog.String("k", "text")},
+		{json.RawMessage(`{"a":1}`), otellog.String("k", `{"a":1}`)},
+		{nil, otellog.KeyValue{Key: "k"}},
+		{[]int{1, 2}, otellog.String("k", "[1 2]")},
+	}
+
+	for _, c := range cases {
+		attr := attribute("k", c.val)
+
+		if !attr.Equal(c.expected) {
+			t.Logf("for %#v expected %v got %v", c.val, c.expected, attr)
+			t.Fail()
+		}
+	}
+}
+
+// Test of the mapping of the levels to the severities.
+func TestSeverity(t *testing.T) {
+	cases := []struct {
+		level    string
+		expected otellog.Severity
+	}{
+		{"debug", otellog.SeverityDebug},
+		{"info", otellog.SeverityInfo},
+		{"warn", otellog.SeverityWarn},
+		{"warning", otellog.SeverityWarn},
+		{"error", otellog.SeverityError},
+		{"critical", otellog.SeverityError2},
+		{"fatal", otellog.SeverityFatal},
+		{"panic", otellog.SeverityFatal},
+		{"notice", otellog.SeverityInfo},
+		{"", otellog.SeverityInfo},
+	}
+
+	for _, c := range cases {
+		sev := severity(c.level)
+
+		if sev != c.expected {
+			t.Logf("for %q expected %v got %v", c.level, c.expected, sev)
+			t.Fail()
+		}
+	}
+}
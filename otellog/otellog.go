@@ -0,0 +1,235 @@
+package otellog
+
+// Implementation of OpenTelemetry Logs Bridge API that emits the records to kiwi sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafov/kiwi"
+)
+
+// Keys of the record fields. The resource and the scope attributes
+// are added with ResourcePrefix and ScopePrefix to their keys.
+var (
+	TimeKey           = "time"
+	ObservedTimeKey   = "observed_time"
+	SeverityNumberKey = "severity_number"
+	TraceIDKey        = "trace_id"
+	SpanIDKey         = "span_id"
+	ResourcePrefix    = "resource."
+	ScopePrefix       = "scope."
+)
+
+// Severity is the severity number of OpenTelemetry log data model.
+type Severity int
+
+// Severity numbers defined by OpenTelemetry. Each range has four
+// numbers, the first one defined here.
+const (
+	SeverityUndefined Severity = 0
+	SeverityTrace     Severity = 1
+	SeverityDebug     Severity = 5
+	SeverityInfo      Severity = 9
+	SeverityWarn      Severity = 13
+	SeverityError     Severity = 17
+	SeverityFatal     Severity = 21
+)
+
+// String returns the name of the severity known by kiwi (see
+// kiwi.Severities).
+func (s Severity) String() string {
+	switch {
+	case s >= SeverityFatal:
+		return "fatal"
+	case s >= SeverityError:
+		return "error"
+	case s >= SeverityWarn:
+		return "warning"
+	case s >= SeverityInfo || s == SeverityUndefined:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// KeyValue is the attribute of the record, the resource or the
+// scope. The values are converted by kiwi as usual.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// Record is the log record of OpenTelemetry log data model.
+type Record struct {
+	Timestamp         time.Time
+	ObservedTimestamp time.Time
+	Severity          Severity
+	SeverityText      string
+	Body              interface{}
+	Attributes        []KeyValue
+	TraceID           string
+	SpanID            string
+}
+
+// LoggerProvider creates the loggers for the instrumentation scopes.
+// The resource attributes of the provider are added to all the
+// records. Use it as the logger provider of OpenTelemetry bridges:
+//
+//	provider := otellog.NewLoggerProvider(
+//		otellog.KeyValue{"service.name", "billing"})
+//	log := provider.Logger("github.com/acme/billing", otellog.WithVersion("1.2.0"))
+//	log.Emit(ctx, otellog.Record{Severity: otellog.SeverityInfo, Body: "invoice sent"})
+//
+// The types of the package follow go.opentelemetry.io/otel/log Bridge
+// API but the package does not depend on OpenTelemetry modules, so
+// the adapter of a few lines that converts log.Record to Record is
+// needed to plug it to OpenTelemetry SDK. The provider and its
+// loggers are safe for concurrent usage.
+type LoggerProvider struct {
+	resource []interface{}
+	min      Severity
+}
+
+// NewLoggerProvider creates the provider with the resource
+// attributes.
+func NewLoggerProvider(resource ...KeyValue) *LoggerProvider {
+	return &LoggerProvider{resource: flatten(nil, ResourcePrefix, resource)}
+}
+
+// MinSeverity sets the lowest severity of the records that are
+// enabled for the loggers of the provider. It should be set before
+// the loggers are created.
+func (p *LoggerProvider) MinSeverity(s Severity) *LoggerProvider {
+	p.min = s
+	return p
+}
+
+// LoggerOption configures the instrumentation scope of the logger.
+type LoggerOption func(*scope)
+
+type scope struct {
+	version   string
+	schemaURL string
+	attrs     []KeyValue
+}
+
+// WithVersion sets the version of the instrumentation scope.
+func WithVersion(version string) LoggerOption {
+	return func(s *scope) { s.version = version }
+}
+
+// WithSchemaURL sets the schema URL of the instrumentation scope.
+func WithSchemaURL(url string) LoggerOption {
+	return func(s *scope) { s.schemaURL = url }
+}
+
+// WithScopeAttributes sets the attributes of the instrumentation
+// scope.
+func WithScopeAttributes(attrs ...KeyValue) LoggerOption {
+	return func(s *scope) { s.attrs = append(s.attrs, attrs...) }
+}
+
+// Logger emits the records of the instrumentation scope.
+type Logger struct {
+	context []interface{}
+	min     Severity
+}
+
+// Logger returns the logger for the instrumentation scope.
+func (p *LoggerProvider) Logger(name string, opts ...LoggerOption) *Logger {
+	var sc scope
+	for _, opt := range opts {
+		opt(&sc)
+	}
+	var context = append([]interface{}(nil), p.resource...)
+	context = append(context, ScopePrefix+"name", name)
+	if sc.version != "" {
+		context = append(context, ScopePrefix+"version", sc.version)
+	}
+	if sc.schemaURL != "" {
+		context = append(context, ScopePrefix+"schema_url", sc.schemaURL)
+	}
+	return &Logger{context: flatten(context, ScopePrefix, sc.attrs), min: p.min}
+}
+
+// Enabled reports whether the record of the severity would be
+// emitted.
+func (l *Logger) Enabled(ctx context.Context, severity Severity) bool {
+	return severity == SeverityUndefined || severity >= l.min
+}
+
+// Emit passes the record to kiwi sinks. The body is logged under
+// kiwi.MessageKey and the severity under kiwi.SeverityKey so the
+// sink filters and the severity aware features work with the
+// records of OpenTelemetry.
+func (l *Logger) Emit(ctx context.Context, r Record) {
+	if !l.Enabled(ctx, r.Severity) {
+		return
+	}
+	var keyVals = make([]interface{}, 0, len(l.context)+16+len(r.Attributes)*2)
+	keyVals = append(keyVals, l.context...)
+	if !r.Timestamp.IsZero() {
+		keyVals = append(keyVals, TimeKey, r.Timestamp)
+	}
+	if !r.ObservedTimestamp.IsZero() {
+		keyVals = append(keyVals, ObservedTimeKey, r.ObservedTimestamp)
+	}
+	var severity = r.SeverityText
+	if severity == "" {
+		severity = r.Severity.String()
+	}
+	keyVals = append(keyVals, kiwi.SeverityKey, severity)
+	if r.Severity != SeverityUndefined {
+		keyVals = append(keyVals, SeverityNumberKey, int(r.Severity))
+	}
+	if r.Body != nil {
+		keyVals = append(keyVals, kiwi.MessageKey, r.Body)
+	}
+	keyVals = flatten(keyVals, "", r.Attributes)
+	if r.TraceID != "" {
+		keyVals = append(keyVals, TraceIDKey, r.TraceID)
+	}
+	if r.SpanID != "" {
+		keyVals = append(keyVals, SpanIDKey, r.SpanID)
+	}
+	kiwi.Log(keyVals...)
+}
+
+// flatten appends the attributes as key-value pairs with the prefix.
+func flatten(keyVals []interface{}, prefix string, attrs []KeyValue) []interface{} {
+	for _, kv := range attrs {
+		keyVals = append(keyVals, prefix+kv.Key, kv.Value)
+	}
+	return keyVals
+}
@@ -0,0 +1,72 @@
+package otellog
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/grafov/kiwi"
+)
+
+// Test the record emitted with the resource and the scope.
+func TestLogger_Emit(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := kiwi.SinkTo(output, kiwi.AsLogfmt()).HasKey("scope.name").Start()
+	provider := NewLoggerProvider(KeyValue{"service.name", "billing"}).MinSeverity(SeverityInfo)
+	log := provider.Logger("otel-test", WithVersion("1.2.0"))
+
+	log.Emit(context.Background(), Record{Severity: SeverityDebug, Body: "skipped"})
+	log.Emit(context.Background(), Record{
+		Severity:   SeverityWarn + 1,
+		Body:       "invoice sent",
+		Attributes: []KeyValue{{"invoice", 42}},
+		TraceID:    "0af7651916cd43dd8448eb211c80319c",
+	})
+
+	out.Close()
+	expected := `resource.service.name="billing" scope.name="otel-test" scope.version="1.2.0" level="warning" severity_number=14 msg="invoice sent" invoice=42 trace_id="0af7651916cd43dd8448eb211c80319c"` + " \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
@@ -0,0 +1,141 @@
+package kiwi
+
+// Counters of the logging pipeline for the monitoring.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBounds are the upper bounds of the buckets of the write
+// latency histogram (see SinkStats.WriteLatency).
+var LatencyBounds = [...]time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Histogram is the distribution of the write latencies.
+type Histogram struct {
+	// Counts[i] is the number of the writes with the latency
+	// greater than LatencyBounds[i-1] and not greater than
+	// LatencyBounds[i]. The last one counts the writes longer than
+	// all the bounds.
+	Counts [len(LatencyBounds) + 1]uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+type latencyCounters struct {
+	counts [len(LatencyBounds) + 1]uint64
+	count  uint64
+	sum    int64
+}
+
+func (c *latencyCounters) observe(d time.Duration) {
+	var i = 0
+	for i < len(LatencyBounds) && d > LatencyBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&c.counts[i], 1)
+	atomic.AddInt64(&c.sum, int64(d))
+	atomic.AddUint64(&c.count, 1)
+}
+
+func (c *latencyCounters) snapshot() Histogram {
+	var h Histogram
+	for i := range c.counts {
+		h.Counts[i] = atomic.LoadUint64(&c.counts[i])
+	}
+	h.Count = atomic.LoadUint64(&c.count)
+	h.Sum = time.Duration(atomic.LoadInt64(&c.sum))
+	return h
+}
+
+// OtherLevel is the level reported by LevelCounts() for the values
+// of SeverityKey not listed in Severities.
+const OtherLevel = "other"
+
+var (
+	// levelCounts keeps *uint64 counters by the level.
+	levelCounts sync.Map
+	// recordsLogged counts all the records passed to the sinks.
+	recordsLogged uint64
+)
+
+// RecordsLogged returns the number of the records logged by all the
+// loggers since the start of the program.
+func RecordsLogged() uint64 {
+	return atomic.LoadUint64(&recordsLogged)
+}
+
+// LevelCounts returns the number of the logged records by the values
+// of SeverityKey. The records without the key are not counted. The
+// values not listed in Severities counted as OtherLevel.
+func LevelCounts() map[string]uint64 {
+	var counts = make(map[string]uint64)
+	levelCounts.Range(func(level, counter interface{}) bool {
+		counts[level.(string)] = atomic.LoadUint64(counter.(*uint64))
+		return true
+	})
+	return counts
+}
+
+// countRecord updates the counters of the logged records.
+func countRecord(record []*Pair) {
+	atomic.AddUint64(&recordsLogged, 1)
+	for _, p := range record {
+		if p.Key != SeverityKey {
+			continue
+		}
+		var level = p.Val
+		if _, ok := Severities[level]; !ok {
+			level = OtherLevel
+		}
+		counter, ok := levelCounts.Load(level)
+		if !ok {
+			counter, _ = levelCounts.LoadOrStore(level, new(uint64))
+		}
+		atomic.AddUint64(counter.(*uint64), 1)
+		return
+	}
+}
@@ -0,0 +1,109 @@
+package postgres
+
+// Formatter that builds JSON documents suitable for JSONB columns.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/grafov/kiwi"
+)
+
+type formatJSONB struct {
+	line  *bytes.Buffer
+	first bool
+}
+
+// AsJSONB says that a sink formats records as JSON objects that
+// accepted by PostgreSQL JSONB type. Unlike kiwi.AsJSON() it emits
+// strictly valid JSON: the strings escaped according RFC-7159 and
+// the numbers that JSON can't represent (NaN, Inf) saved as strings.
+func AsJSONB() *formatJSONB {
+	return &formatJSONB{line: bytes.NewBuffer(make([]byte, 0, 256))}
+}
+
+func (f *formatJSONB) Begin() {
+	f.line.Reset()
+	f.line.WriteByte('{')
+	f.first = true
+}
+
+func (f *formatJSONB) Pair(key, val string, valType int) {
+	if !f.first {
+		f.line.WriteByte(',')
+	}
+	f.first = false
+	writeString(f.line, key)
+	f.line.WriteByte(':')
+	switch valType {
+	case kiwi.VoidVal:
+		if val == "<nil>" || val == "null" {
+			f.line.WriteString("null")
+			return
+		}
+	case kiwi.BooleanVal:
+		if val == "true" || val == "false" {
+			f.line.WriteString(val)
+			return
+		}
+	case kiwi.IntegerVal:
+		if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+			f.line.WriteString(val)
+			return
+		}
+		if _, err := strconv.ParseUint(val, 10, 64); err == nil {
+			f.line.WriteString(val)
+			return
+		}
+	case kiwi.FloatVal:
+		if v, err := strconv.ParseFloat(val, 64); err == nil && !math.IsInf(v, 0) && !math.IsNaN(v) {
+			f.line.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+			return
+		}
+	}
+	writeString(f.line, val)
+}
+
+func (f *formatJSONB) Finish() []byte {
+	f.line.WriteByte('}')
+	f.line.WriteByte('\n')
+	return f.line.Bytes()
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	// Marshalling of a string never fails.
+	data, _ := json.Marshal(s)
+	buf.Write(data)
+}
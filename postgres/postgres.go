@@ -0,0 +1,428 @@
+package postgres
+
+// Sink writer that stores log records in PostgreSQL table as JSONB documents.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the writer. They may be changed per writer with
+// BatchSize(), FlushInterval() and MaxPending() methods.
+var (
+	DefaultColumn        = "record"
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultMaxPending    = 10000
+)
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("postgres writer closed")
+
+// Writer collects formatted records and saves them to PostgreSQL
+// table in batches. It conforms io.Writer so it may be used as the
+// output for kiwi.SinkTo(). Use it with AsJSONB() formatter because
+// each record stored as a document in the JSONB column:
+//
+//	w := postgres.New(db, "logs")
+//	kiwi.SinkTo(w, postgres.AsJSONB()).Start()
+//
+// The records kept in the memory until the batch is full or the flush
+// interval is expired. If the database unavailable the records stay
+// pending and the writer tries to save them again on the next flush.
+// Writer methods are safe for concurrent usage.
+type Writer struct {
+	table  string
+	column string
+
+	sync.Mutex
+	db         *sql.DB
+	driver     string
+	dsn        string
+	useCopy    bool
+	batchSize  int
+	workers    int
+	maxPending int
+	interval   time.Duration
+	pending    []string
+	dropped    int
+	lastErr    error
+	closed     bool
+	started    sync.Once
+	flushing   sync.Mutex
+	flush      chan struct{}
+	done       chan struct{}
+}
+
+// New creates a writer for the opened database. The table should
+// have the column for the records of JSONB type (it is "record" by
+// default, see Column()):
+//
+//	CREATE TABLE logs (id bigserial PRIMARY KEY, record jsonb NOT NULL);
+func New(db *sql.DB, table string) *Writer {
+	return &Writer{
+		db:         db,
+		table:      table,
+		column:     DefaultColumn,
+		batchSize:  DefaultBatchSize,
+		workers:    1,
+		maxPending: DefaultMaxPending,
+		interval:   DefaultFlushInterval,
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// Open opens the database with the driver and DSN and creates a
+// writer for it. Unlike the writer created with New() it reopens the
+// database connection by itself when the database is not available.
+func Open(driver, dsn, table string) (*Writer, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	w := New(db, table)
+	w.driver = driver
+	w.dsn = dsn
+	return w, nil
+}
+
+// Column sets the name of JSONB column for the records.
+func (w *Writer) Column(name string) *Writer {
+	w.Lock()
+	w.column = name
+	w.Unlock()
+	return w
+}
+
+// BatchSize sets number of the records that saved by a single query.
+func (w *Writer) BatchSize(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.batchSize = n
+		w.Unlock()
+	}
+	return w
+}
+
+// FlushInterval sets how long the records may wait in the memory
+// until the batch will be filled. It should be set before the first
+// record will be written.
+func (w *Writer) FlushInterval(d time.Duration) *Writer {
+	if d > 0 {
+		w.Lock()
+		w.interval = d
+		w.Unlock()
+	}
+	return w
+}
+
+// MaxPending restricts number of the records kept in the memory when
+// the database is unavailable. The oldest records are dropped when
+// the limit is reached.
+func (w *Writer) MaxPending(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.maxPending = n
+		w.Unlock()
+	}
+	return w
+}
+
+// Workers sets how many batches could be saved concurrently. It is 1
+// by default so the batches saved one by one in order of writing.
+// More workers allow higher throughput for slow databases but the
+// order of the records between the batches is not kept.
+func (w *Writer) Workers(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.workers = n
+		w.Unlock()
+	}
+	return w
+}
+
+// UseCopy says to save the batches with COPY FROM STDIN instead of
+// multirow INSERT. COPY is faster for big batches but requires the
+// driver that supports COPY through database/sql interface
+// (github.com/lib/pq does).
+func (w *Writer) UseCopy() *Writer {
+	w.Lock()
+	w.useCopy = true
+	w.Unlock()
+	return w
+}
+
+// Write adds a single formatted record to the batch. It never blocks
+// on the database. It returns the error of the last failed flush if
+// any, the error is reported only once.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.started.Do(func() { go w.flusher() })
+	var record = strings.TrimSpace(string(p))
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return 0, ErrClosed
+	}
+	if record != "" {
+		if len(w.pending) >= w.maxPending {
+			w.pending = w.pending[1:]
+			w.dropped++
+		}
+		w.pending = append(w.pending, record)
+	}
+	var full = len(w.pending) >= w.batchSize
+	var err = w.lastErr
+	w.lastErr = nil
+	w.Unlock()
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), err
+}
+
+// Dropped returns number of the records that were dropped because of
+// MaxPending limit.
+func (w *Writer) Dropped() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.dropped
+}
+
+// Flush saves all pending records to the database. Up to Workers()
+// batches are saved concurrently.
+func (w *Writer) Flush() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+	for {
+		w.Lock()
+		var batches [][]string
+		for len(w.pending) > 0 && len(batches) < w.workers {
+			var n = len(w.pending)
+			if n > w.batchSize {
+				n = w.batchSize
+			}
+			batches = append(batches, w.pending[:n:n])
+			w.pending = w.pending[n:]
+		}
+		w.Unlock()
+		if len(batches) == 0 {
+			return nil
+		}
+		var (
+			errs = make([]error, len(batches))
+			wg   sync.WaitGroup
+		)
+		for i := range batches {
+			wg.Add(1)
+			go func(i int) {
+				errs[i] = w.save(batches[i])
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
+		var (
+			failed []string
+			err    error
+		)
+		for i, e := range errs {
+			if e != nil {
+				failed = append(failed, batches[i]...)
+				err = e
+			}
+		}
+		if err != nil {
+			// Return the failed batches back to the head of the queue.
+			w.Lock()
+			w.pending = append(failed, w.pending...)
+			if extra := len(w.pending) - w.maxPending; extra > 0 {
+				w.pending = w.pending[extra:]
+				w.dropped += extra
+			}
+			w.lastErr = err
+			w.Unlock()
+			w.reconnect()
+			return err
+		}
+	}
+}
+
+// Close flushes pending records and stops the writer. It not closes
+// the database passed to New() but closes the database opened by
+// Open().
+func (w *Writer) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	w.Unlock()
+	w.started.Do(func() {})
+	close(w.done)
+	var err = w.Flush()
+	if w.dsn != "" {
+		w.Lock()
+		w.db.Close()
+		w.Unlock()
+	}
+	return err
+}
+
+func (w *Writer) flusher() {
+	w.Lock()
+	var ticker = time.NewTicker(w.interval)
+	w.Unlock()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.flush:
+		}
+		w.Flush()
+	}
+}
+
+func (w *Writer) save(batch []string) error {
+	w.Lock()
+	var (
+		db      = w.db
+		useCopy = w.useCopy
+		table   = quoteIdent(w.table)
+		column  = quoteIdent(w.column)
+	)
+	w.Unlock()
+	if useCopy {
+		return copyBatch(db, table, column, batch)
+	}
+	return insertBatch(db, table, column, batch)
+}
+
+func insertBatch(db *sql.DB, table, column string, batch []string) error {
+	var (
+		query = make([]byte, 0, 32+len(table)+len(column)+len(batch)*8)
+		args  = make([]interface{}, len(batch))
+	)
+	query = append(query, "INSERT INTO "...)
+	query = append(query, table...)
+	query = append(query, " ("...)
+	query = append(query, column...)
+	query = append(query, ") VALUES "...)
+	for i, record := range batch {
+		if i > 0 {
+			query = append(query, ',')
+		}
+		query = append(query, "($"...)
+		query = strconv.AppendInt(query, int64(i+1), 10)
+		query = append(query, "::jsonb)"...)
+		args[i] = record
+	}
+	_, err := db.Exec(string(query), args...)
+	return err
+}
+
+func copyBatch(db *sql.DB, table, column string, batch []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("COPY " + table + " (" + column + ") FROM STDIN")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, record := range batch {
+		if _, err = stmt.Exec(record); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+	// Exec without arguments finishes COPY.
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		tx.Rollback()
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// reconnect reopens the database if it was opened by Open() and it
+// not answers to ping. The database pinged and opened without the
+// lock so Write() is not blocked meanwhile.
+func (w *Writer) reconnect() {
+	if w.dsn == "" {
+		return
+	}
+	w.Lock()
+	var broken = w.db
+	w.Unlock()
+	if broken.Ping() == nil {
+		return
+	}
+	db, err := sql.Open(w.driver, w.dsn)
+	if err != nil {
+		return
+	}
+	w.Lock()
+	if w.db != broken || w.closed {
+		// Reopened by other flush or closed meanwhile.
+		w.Unlock()
+		db.Close()
+		return
+	}
+	w.db = db
+	w.Unlock()
+	broken.Close()
+}
+
+func quoteIdent(name string) string {
+	var parts = strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.Replace(part, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,275 @@
+package postgres
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafov/kiwi"
+)
+
+// fakeDriver records executed queries with their arguments.
+type fakeDriver struct {
+	sync.Mutex
+	queries []string
+	args    [][]driver.Value
+	fail    bool
+	// pinging is closed when the ping started.
+	pinging chan struct{}
+	// release unblocks the ping.
+	release chan struct{}
+}
+
+type fakeConn struct{ d *fakeDriver }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.d, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *fakeConn) Commit() error                             { return nil }
+func (c *fakeConn) Rollback() error                           { return nil }
+func (c *fakeConn) Ping(context.Context) error {
+	c.d.Lock()
+	var pinging, release, fail = c.d.pinging, c.d.release, c.d.fail
+	c.d.pinging = nil
+	c.d.Unlock()
+	if pinging != nil {
+		close(pinging)
+		<-release
+	}
+	if fail {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.Lock()
+	defer s.d.Unlock()
+	if s.d.fail {
+		return nil, errors.New("connection refused")
+	}
+	s.d.queries = append(s.d.queries, s.query)
+	s.d.args = append(s.d.args, args)
+	return driver.RowsAffected(len(args)), nil
+}
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var fake = &fakeDriver{}
+
+func init() {
+	sql.Register("fakepg", fake)
+}
+
+func reset(fail bool) {
+	fake.Lock()
+	fake.queries = nil
+	fake.args = nil
+	fake.fail = fail
+	fake.Unlock()
+}
+
+// Test of saving the batch with multirow INSERT.
+func TestWriter_FlushInsert(t *testing.T) {
+	reset(false)
+	db, _ := sql.Open("fakepg", "")
+	w := New(db, "logs").BatchSize(10)
+
+	w.Write([]byte(`{"a":1}` + "\n"))
+	w.Write([]byte(`{"b":2}` + "\n"))
+	err := w.Flush()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.queries) != 1 {
+		t.Fatalf("expected single query but got %d", len(fake.queries))
+	}
+	if fake.queries[0] != `INSERT INTO "logs" ("record") VALUES ($1::jsonb),($2::jsonb)` {
+		t.Logf("unexpected query %s", fake.queries[0])
+		t.Fail()
+	}
+	if len(fake.args[0]) != 2 || fake.args[0][1] != `{"b":2}` {
+		t.Logf("unexpected args %v", fake.args[0])
+		t.Fail()
+	}
+}
+
+// Test of saving the batch with COPY.
+func TestWriter_FlushCopy(t *testing.T) {
+	reset(false)
+	db, _ := sql.Open("fakepg", "")
+	w := New(db, "audit.logs").Column("data").UseCopy()
+
+	w.Write([]byte(`{"a":1}`))
+	w.Write([]byte(`{"b":2}`))
+	err := w.Flush()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two records and the final Exec() without args.
+	if len(fake.queries) != 3 || fake.queries[0] != `COPY "audit"."logs" ("data") FROM STDIN` {
+		t.Logf("unexpected queries %v", fake.queries)
+		t.Fail()
+	}
+	if len(fake.args[2]) != 0 {
+		t.Fail()
+	}
+}
+
+// Test that the records kept pending when the database fails.
+func TestWriter_KeepPendingOnFailure(t *testing.T) {
+	reset(true)
+	db, _ := sql.Open("fakepg", "")
+	w := New(db, "logs").MaxPending(2)
+
+	w.Write([]byte(`{"a":1}`))
+	w.Write([]byte(`{"b":2}`))
+	w.Write([]byte(`{"c":3}`))
+	err := w.Flush()
+	reset(false)
+	err2 := w.Flush()
+
+	if err == nil || err2 != nil {
+		t.Fatalf("unexpected errors: %v, %v", err, err2)
+	}
+	if w.Dropped() != 1 {
+		t.Logf("expected one dropped record but got %d", w.Dropped())
+		t.Fail()
+	}
+	if len(fake.args) != 1 || len(fake.args[0]) != 2 || fake.args[0][0] != `{"b":2}` {
+		t.Logf("unexpected args %v", fake.args)
+		t.Fail()
+	}
+}
+
+// Test of the JSONB formatter output.
+func TestFormatJSONB(t *testing.T) {
+	f := AsJSONB()
+
+	f.Begin()
+	f.Pair("msg", "say \"hi\"\x01", kiwi.StringVal)
+	f.Pair("n", "12", kiwi.IntegerVal)
+	f.Pair("f", "1.5e+00", kiwi.FloatVal)
+	f.Pair("nan", "NaN", kiwi.FloatVal)
+	f.Pair("ok", "true", kiwi.BooleanVal)
+	out := strings.TrimSpace(string(f.Finish()))
+
+	if out != `{"msg":"say \"hi\"\u0001","n":12,"f":1.5,"nan":"NaN","ok":true}` {
+		t.Logf("unexpected output %s", out)
+		t.Fail()
+	}
+}
+
+// Test of saving the batches by several workers.
+func TestWriter_FlushWorkers(t *testing.T) {
+	reset(false)
+	db, _ := sql.Open("fakepg", "")
+	w := New(db, "logs").BatchSize(2).Workers(3)
+
+	for i := 0; i < 7; i++ {
+		w.Write([]byte(`{"a":1}`))
+	}
+	err := w.Flush()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved int
+	for _, args := range fake.args {
+		saved += len(args)
+	}
+	if len(fake.queries) != 4 || saved != 7 {
+		t.Logf("expected 4 queries with 7 records got %d with %d", len(fake.queries), saved)
+		t.Fail()
+	}
+}
+
+// Test that Write() is not blocked while the writer pings the failed
+// database.
+func TestWriter_WriteWhileReconnect(t *testing.T) {
+	reset(true)
+	w, _ := Open("fakepg", "reconnect", "logs")
+	defer w.Close()
+	pinging, release := make(chan struct{}), make(chan struct{})
+	fake.Lock()
+	fake.pinging, fake.release = pinging, release
+	fake.Unlock()
+	w.Write([]byte(`{"a":1}`))
+	go w.Flush()
+	<-pinging
+
+	written := make(chan struct{})
+	go func() {
+		w.Write([]byte(`{"b":2}`))
+		close(written)
+	}()
+	var blocked bool
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		blocked = true
+	}
+	close(release)
+
+	if blocked {
+		t.Log("expected Write() not blocked by the ping")
+		t.Fail()
+	}
+}
@@ -0,0 +1,132 @@
+package proc
+
+// Helper for adding the process information to the logger context
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"sync"
+
+	"github.com/grafov/kiwi"
+)
+
+const (
+	// Names that define what parts of the process information
+	// should be passed.
+	Hostname   = 1
+	PID        = 2
+	Executable = 4
+	// Build adds the Go version, the path and the version of the main
+	// module and the VCS revision when the binary has them.
+	Build = 8
+	All   = Hostname | PID | Executable | Build
+)
+
+// Keys of the pairs.
+var (
+	HostnameKey   = "host"
+	PIDKey        = "pid"
+	ExecutableKey = "exe"
+	GoVersionKey  = "go_version"
+	ModuleKey     = "module"
+	VersionKey    = "version"
+	RevisionKey   = "revision"
+)
+
+var (
+	once sync.Once
+	info struct {
+		hostname, pid, executable  string
+		goVersion, module, version string
+		revision                   string
+	}
+)
+
+// What returns the pairs with the information about the process for
+// the logger context. The information is gathered once and cached.
+// Remember that it returns a slice of pairs so add it this way:
+//
+//	log.With(proc.What(proc.Hostname | proc.PID | proc.Build))
+//	// host="api-3" pid=4242 go_version="go1.21.5" module="github.com/acme/api" version="v1.4.0"
+//
+// The pairs of the empty values (the binary without the build
+// information for example) are skipped.
+func What(parts int) []*kiwi.Pair {
+	once.Do(gather)
+	var pairs []*kiwi.Pair
+	add := func(key, val string, valType int) {
+		if val != "" {
+			pairs = append(pairs, &kiwi.Pair{Key: key, Val: val, Type: valType})
+		}
+	}
+	if parts&Hostname > 0 {
+		add(HostnameKey, info.hostname, kiwi.StringVal)
+	}
+	if parts&PID > 0 {
+		add(PIDKey, info.pid, kiwi.IntegerVal)
+	}
+	if parts&Executable > 0 {
+		add(ExecutableKey, info.executable, kiwi.StringVal)
+	}
+	if parts&Build > 0 {
+		add(GoVersionKey, info.goVersion, kiwi.StringVal)
+		add(ModuleKey, info.module, kiwi.StringVal)
+		add(VersionKey, info.version, kiwi.StringVal)
+		add(RevisionKey, info.revision, kiwi.StringVal)
+	}
+	return pairs
+}
+
+// gather gathers the information about the process.
+func gather() {
+	info.hostname, _ = os.Hostname()
+	info.pid = strconv.Itoa(os.Getpid())
+	if exe, err := os.Executable(); err == nil {
+		info.executable = filepath.Base(exe)
+	} else if len(os.Args) > 0 {
+		info.executable = filepath.Base(os.Args[0])
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.goVersion = build.GoVersion
+		info.module = build.Main.Path
+		if build.Main.Version != "(devel)" {
+			info.version = build.Main.Version
+		}
+		for _, s := range build.Settings {
+			if s.Key == "vcs.revision" {
+				info.revision = s.Value
+			}
+		}
+	}
+}
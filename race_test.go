@@ -404,3 +404,30 @@ func TestRace_ForkInside_Logfmt(t *testing.T) {
 //		t.Fail()
 //	}
 // }
+
+// Test of the base logger shared by the goroutines.
+func TestRace_Clone_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, AsLogfmt()).HasKey("clone-k").Start()
+	defer out.Close()
+	var (
+		base = New().With("base", 1)
+		wg   sync.WaitGroup
+	)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			base.Log("clone-k", i)
+			base.Clone("instance", i).Add("clone-k", i).Log()
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+
+	out.Flush()
+	if len(base.context) != 1 {
+		t.Logf("the base logger changed: %d pairs in the context", len(base.context))
+		t.Fail()
+	}
+}
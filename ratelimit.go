@@ -0,0 +1,139 @@
+package kiwi
+
+// This file consists of the rate limits per the values of the keys.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxKeyBuckets is the limit of the buckets of the key. The least
+// recently used bucket is removed for the new value when the limit
+// reached, so the value gets the full burst again.
+const maxKeyBuckets = 1024
+
+// keyLimit keeps the token buckets for each value of the key.
+type keyLimit struct {
+	rate  float64
+	burst float64
+
+	sync.Mutex
+	buckets map[string]*list.Element
+	// The buckets from the most to the least recently used.
+	lru *list.List
+}
+
+type tokenBucket struct {
+	val    string
+	tokens float64
+	last   time.Time
+}
+
+// LimitByKey passes no more than eventsPerSecond records with the
+// same value of the key (with bursts up to burst records, at least
+// one). Each value has its own limit so a single noisy tenant could
+// not suppress the records of others:
+//
+//	kiwi.SinkTo(os.Stdout, kiwi.AsLogfmt()).LimitByKey("tenant", 10, 50).Start()
+//
+// The records without the key are not limited. The skipped records
+// are counted in Stats() as sampled. Zero rate removes the limit for
+// the key.
+func (s *Sink) LimitByKey(key string, eventsPerSecond float64, burst int) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		key = s.foldKey(key)
+		if eventsPerSecond <= 0 {
+			delete(s.keyLimits, key)
+		} else {
+			if s.keyLimits == nil {
+				s.keyLimits = make(map[string]*keyLimit)
+			}
+			if burst < 1 {
+				burst = 1
+			}
+			s.keyLimits[key] = &keyLimit{rate: eventsPerSecond, burst: float64(burst), buckets: make(map[string]*list.Element), lru: list.New()}
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// limitByKeys reports whether the record passes the limits of its
+// keys. It should be called under the lock of the sink.
+func (s *Sink) limitByKeys(record []*Pair) bool {
+	if len(s.keyLimits) == 0 {
+		return true
+	}
+	var now = s.collector.now()
+	for _, pair := range record {
+		if limit, ok := s.keyLimits[s.foldKey(pair.Key)]; ok {
+			var val, _ = pair.value()
+			if !limit.take(val, now) {
+				atomic.AddUint64(&s.stats.sampled, 1)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// take takes the token from the bucket of the value.
+func (l *keyLimit) take(val string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	var b *tokenBucket
+	if e, ok := l.buckets[val]; ok {
+		l.lru.MoveToFront(e)
+		b = e.Value.(*tokenBucket)
+	} else {
+		if l.lru.Len() >= maxKeyBuckets {
+			var oldest = l.lru.Back()
+			delete(l.buckets, oldest.Value.(*tokenBucket).val)
+			l.lru.Remove(oldest)
+		}
+		b = &tokenBucket{val: val, tokens: l.burst, last: now}
+		l.buckets[val] = l.lru.PushFront(b)
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,182 @@
+package kiwi
+
+// This file consists of the pooled records shared by the sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// record is the list of pairs passed to all the sinks at once. The
+// sinks share the same record without copying. The record counts
+// the references of the logger and the sinks that hold it and returns
+// to the pool when the last of them released it. So the record is
+// recycled safely even when the logger stopped waiting the slow sinks
+// by timeout.
+type record struct {
+	pairs []*Pair
+	// values keeps the pairs copied to the record so they are
+	// recycled with the record instead of the allocation for each
+	// pair.
+	values []Pair
+	// refs counts the logger and the sinks that hold the record.
+	refs int32
+	// pending counts the sinks that not processed the record yet
+	// plus the logger until it starts waiting.
+	pending int32
+	done    chan struct{}
+	// timer limits the waiting, it is reused with the record.
+	timer *time.Timer
+	// clock and collector tell the time for the pairs evaluated
+	// with the clock (see Clock).
+	clock     Clock
+	collector *Collector
+}
+
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		return &record{done: make(chan struct{}, 1)}
+	},
+}
+
+// newRecord takes the record from the pool. The record is held by
+// the caller.
+func newRecord(size int) *record {
+	var r = recordPool.Get().(*record)
+	if cap(r.pairs) < size {
+		r.pairs = make([]*Pair, 0, size)
+	}
+	if cap(r.values) < size {
+		r.values = make([]Pair, 0, size)
+	}
+	r.refs = 1
+	r.pending = 1
+	return r
+}
+
+// hold is called before passing the record to a sink.
+func (r *record) hold() {
+	atomic.AddInt32(&r.refs, 1)
+	atomic.AddInt32(&r.pending, 1)
+}
+
+// retain is called before passing the record to the sink that the
+// logger does not wait for. The sink releases the record.
+func (r *record) retain() {
+	atomic.AddInt32(&r.refs, 1)
+}
+
+// processed is called by the sink when it has done with the record.
+func (r *record) processed() {
+	if atomic.AddInt32(&r.pending, -1) == 0 {
+		r.done <- struct{}{}
+	}
+	r.release()
+}
+
+// wait waits until all the sinks processed the record but not longer
+// than the timeout. Then the logger releases the record.
+func (r *record) wait(timeout time.Duration) {
+	if atomic.AddInt32(&r.pending, -1) != 0 {
+		if r.timer == nil {
+			r.timer = time.NewTimer(timeout)
+		} else {
+			r.timer.Reset(timeout)
+		}
+		select {
+		case <-r.done:
+		case <-r.timer.C:
+		}
+		if !r.timer.Stop() {
+			select {
+			case <-r.timer.C:
+			default:
+			}
+		}
+	}
+	r.release()
+}
+
+// release returns the record to the pool when nobody holds it.
+func (r *record) release() {
+	if atomic.AddInt32(&r.refs, -1) != 0 {
+		return
+	}
+	for i := range r.pairs {
+		r.pairs[i] = nil
+	}
+	r.pairs = r.pairs[:0]
+	for i := range r.values {
+		r.values[i] = Pair{}
+	}
+	r.values = r.values[:0]
+	r.clock, r.collector = nil, nil
+	select {
+	case <-r.done:
+	default:
+	}
+	recordPool.Put(r)
+}
+
+// newPair returns the pair that belongs to the record. The pairs are
+// taken from the storage of the record while it has the room. The
+// storage never grows so the pointers to the pairs stay valid.
+func (r *record) newPair(key, val string, eval interface{}, valType int) *Pair {
+	if len(r.values) < cap(r.values) {
+		r.values = append(r.values, Pair{key, val, eval, valType})
+		return &r.values[len(r.values)-1]
+	}
+	return &Pair{key, val, eval, valType}
+}
+
+// appendEvaluated appends a copy of the pair to the record. The
+// delayed value of the pair evaluated here. The pair with a generator
+// of pairs is expanded later by the sinks.
+func (r *record) appendEvaluated(record []*Pair, p *Pair) []*Pair {
+	switch eval := p.Eval.(type) {
+	case func() string:
+		return append(record, r.newPair(p.Key, eval(), p.Eval, p.Type))
+	case func(time.Time) string:
+		return append(record, r.newPair(p.Key, eval(r.now()), p.Eval, p.Type))
+	case *lazyValue:
+		// The context keeps the function for all the records.
+		return append(record, r.newPair(p.Key, "", &lazyValue{fn: eval.fn}, p.Type))
+	case measure, objectText:
+		return append(record, r.newPair(p.Key, p.Val, eval, p.Type))
+	case func() []*Pair:
+		// The sinks call the generator (see lazyPairs).
+		return append(record, r.newPair("", "", &lazyPairs{fn: eval, clock: r.clock, collector: r.collector}, p.Type))
+	}
+	return append(record, r.newPair(p.Key, p.Val, nil, p.Type))
+}
@@ -0,0 +1,131 @@
+package kiwi
+
+// Filters that check the whole record and their combinators.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import "sync/atomic"
+
+// RecordFilter checks the whole record. If the filter passed it
+// should return true. Unlike Filter it could combine the conditions
+// on several keys (see And(), Or(), Not()).
+type RecordFilter interface {
+	CheckRecord([]*Pair) bool
+}
+
+// RecordFilterFunc is an adapter to use ordinary functions as record
+// filters.
+type RecordFilterFunc func([]*Pair) bool
+
+// CheckRecord calls fn(record).
+func (fn RecordFilterFunc) CheckRecord(record []*Pair) bool {
+	return fn(record)
+}
+
+// Has passes the records that have the key.
+func Has(key string) RecordFilter {
+	return Match(key, &keyFilter{})
+}
+
+// Is passes the records that have the key with one of the values.
+func Is(key string, vals ...string) RecordFilter {
+	return Match(key, &valsFilter{Vals: vals})
+}
+
+// Match passes the records that have the key with the value accepted
+// by the filter.
+func Match(key string, filter Filter) RecordFilter {
+	return RecordFilterFunc(func(record []*Pair) bool {
+		for _, pair := range record {
+			if pair.Key == key && filter.Check(pair.Key, pair.Val) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// And passes the records accepted by all the filters.
+func And(filters ...RecordFilter) RecordFilter {
+	return RecordFilterFunc(func(record []*Pair) bool {
+		for _, f := range filters {
+			if !f.CheckRecord(record) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or passes the records accepted by any of the filters.
+func Or(filters ...RecordFilter) RecordFilter {
+	return RecordFilterFunc(func(record []*Pair) bool {
+		for _, f := range filters {
+			if f.CheckRecord(record) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not passes the records rejected by the filter.
+func Not(filter RecordFilter) RecordFilter {
+	return RecordFilterFunc(func(record []*Pair) bool {
+		return !filter.CheckRecord(record)
+	})
+}
+
+// WithRecordFilter adds the filter that checks the whole record. The
+// records should pass the key filters of the sink and all its record
+// filters:
+//
+//	sink.WithRecordFilter(kiwi.And(
+//		kiwi.Or(kiwi.Is("level", "error"), kiwi.Is("module", "billing")),
+//		kiwi.Not(kiwi.Is("path", "/health"))))
+func (s *Sink) WithRecordFilter(filter RecordFilter) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.recordFilters = append(s.recordFilters, filter)
+		s.Unlock()
+	}
+	return s
+}
+
+// WithoutRecordFilters removes all the record filters of the sink.
+func (s *Sink) WithoutRecordFilters() *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.recordFilters = nil
+		s.Unlock()
+	}
+	return s
+}
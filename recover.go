@@ -0,0 +1,79 @@
+package kiwi
+
+// This file consists of helpers for logging of panics.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import "fmt"
+
+// PanicStackDepth sets how many frames of the stack trace logged by
+// RecoverAndLog() and RecoverLogAndRepanic().
+var PanicStackDepth = 32
+
+// RecoverAndLog recovers the panic and logs the panic value under the
+// key with the stack trace of the panic. It should be called
+// directly by defer:
+//
+//	defer kiwi.RecoverAndLog(log, "panic")
+//
+// The sinks are flushed before returning. Nil logger means the logger
+// forked from the global logger.
+func RecoverAndLog(l *Logger, key string) {
+	if r := recover(); r != nil {
+		logPanic(l, key, r)
+	}
+}
+
+// RecoverLogAndRepanic is the same as RecoverAndLog() but it panics
+// again with the same value after the panic has been logged. It
+// should be called directly by defer:
+//
+//	defer kiwi.RecoverLogAndRepanic(log, "panic")
+func RecoverLogAndRepanic(l *Logger, key string) {
+	if r := recover(); r != nil {
+		logPanic(l, key, r)
+		panic(r)
+	}
+}
+
+func logPanic(l *Logger, key string, r interface{}) {
+	if l == nil {
+		l = Fork()
+	}
+	var val = r
+	if err, ok := r.(error); ok {
+		val = err.Error()
+	} else if _, ok := r.(string); !ok {
+		val = fmt.Sprintf("%+v", r)
+	}
+	l.Log(key, val, stackPair(PanicStackDepth))
+	l.flush()
+}
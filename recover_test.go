@@ -0,0 +1,130 @@
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Test of logging of the recovered panic.
+func TestRecoverAndLog_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+
+	func() {
+		defer RecoverAndLog(log, "panic")
+		panic("oops")
+	}()
+
+	out.Flush()
+	if !strings.HasPrefix(output.String(), `panic="oops" stack="`) {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the panic raised again after logging.
+func TestRecoverLogAndRepanic_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	var repanicked interface{}
+
+	func() {
+		defer func() { repanicked = recover() }()
+		defer RecoverLogAndRepanic(log, "panic")
+		panic("oops")
+	}()
+
+	out.Flush()
+	if repanicked != "oops" {
+		t.Logf("expected repanic with oops got %v", repanicked)
+		t.Fail()
+	}
+	if !strings.HasPrefix(output.String(), `panic="oops"`) {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the recovered panic written by the asynchronous sink
+// before RecoverAndLog returns.
+func TestRecoverAndLog_AsyncFlushed_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Async(16, Block).Start()
+	defer out.Close()
+
+	func() {
+		defer RecoverAndLog(log, "panic")
+		panic("oops")
+	}()
+
+	if !strings.HasPrefix(output.String(), `panic="oops" stack="`) {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
+
+// Test that the recovered panic written by the asynchronous sink of
+// the own collector of the logger.
+func TestRecoverAndLog_CollectorFlushed_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	c := NewCollector()
+	log := New().UseCollector(c)
+	out := c.SinkTo(output, AsLogfmt()).Async(16, Block).Start()
+	defer out.Close()
+
+	func() {
+		defer RecoverAndLog(log, "panic")
+		panic("oops")
+	}()
+
+	if !strings.HasPrefix(output.String(), `panic="oops" stack="`) {
+		t.Logf("unexpected output %v", output.String())
+		t.Fail()
+	}
+}
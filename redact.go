@@ -0,0 +1,165 @@
+package kiwi
+
+// Masking and redaction of the sensitive values.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sync/atomic"
+)
+
+// MaskString replaces the values of the keys masked by Sink.Mask()
+// and the values changed by the built-in redactors.
+var MaskString = "***"
+
+// Redactor changes the sensitive values before they formatted by the
+// sink. It returns the new value and true when the value was changed.
+// The redacted values are always output as strings.
+type Redactor interface {
+	Redact(key, val string) (string, bool)
+}
+
+// RedactorFunc is an adapter to use ordinary functions as redactors.
+type RedactorFunc func(key, val string) (string, bool)
+
+// Redact calls fn(key, val).
+func (fn RedactorFunc) Redact(key, val string) (string, bool) {
+	return fn(key, val)
+}
+
+var (
+	// RedactEmails masks the e-mail addresses in any values.
+	RedactEmails = RedactPattern(regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`))
+	// RedactCardNumbers masks the numbers of the payment cards
+	// (13-19 digits optionally separated by spaces or dashes) in any
+	// values.
+	RedactCardNumbers = RedactPattern(regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`))
+	// RedactBearerTokens masks the tokens of the HTTP authorization
+	// headers in any values.
+	RedactBearerTokens = RedactPattern(regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`))
+)
+
+// RedactPattern returns the redactor that replaces all the parts of
+// values that match the regular expression with MaskString.
+func RedactPattern(re *regexp.Regexp) Redactor {
+	return RedactorFunc(func(key, val string) (string, bool) {
+		if !re.MatchString(val) {
+			return val, false
+		}
+		return re.ReplaceAllLiteralString(val, MaskString), true
+	})
+}
+
+// HashKeys returns the redactor that replaces the values of the keys
+// with the hex encoded prefix of their SHA-256 hashes. Unlike masking
+// the hashed values are still could be correlated between the
+// records:
+//
+//	sink.Redact(kiwi.HashKeys("user-email"))
+//	// user-email=7c0f2ab9e6d1a3f4
+func HashKeys(keys ...string) Redactor {
+	var hashed = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		hashed[key] = true
+	}
+	return RedactorFunc(func(key, val string) (string, bool) {
+		if !hashed[key] {
+			return val, false
+		}
+		var sum = sha256.Sum256([]byte(val))
+		return hex.EncodeToString(sum[:8]), true
+	})
+}
+
+// Mask replaces the values of the keys with MaskString in the output
+// of the sink. The filters still operate with the original values.
+func (s *Sink) Mask(keys ...string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if s.maskedKeys == nil {
+			s.maskedKeys = make(map[string]bool, len(keys))
+		}
+		for _, key := range keys {
+			s.maskedKeys[key] = true
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// Unmask removes masking of the keys set by Mask().
+func (s *Sink) Unmask(keys ...string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		for _, key := range keys {
+			delete(s.maskedKeys, key)
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// Redact adds the redactors applied to all the values of the records
+// before formatting by the sink. The redactors called in the order
+// they were added, each one gets the value changed by the previous:
+//
+//	sink.Mask("password").Redact(kiwi.RedactEmails, kiwi.RedactBearerTokens)
+//
+// Call without redactors removes all the redactors of the sink.
+func (s *Sink) Redact(redactors ...Redactor) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if len(redactors) == 0 {
+			s.redactors = nil
+		} else {
+			s.redactors = append(s.redactors, redactors...)
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// redacted returns the value of the pair after masking and redaction.
+// It should be called under the lock of the sink.
+func (s *Sink) redacted(key, val string, valType int) (string, int) {
+	if s.maskedKeys[key] {
+		return MaskString, StringVal
+	}
+	for _, r := range s.redactors {
+		if v, ok := r.Redact(key, val); ok {
+			val, valType = v, StringVal
+		}
+	}
+	return val, valType
+}
@@ -0,0 +1,107 @@
+package kiwi
+
+// This file consists of the retries of the failed writes.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// IsTransient reports whether the write error is temporary so the
+// write could be retried (see Sink.Retry()). By default EAGAIN, EINTR
+// and the temporary network errors are transient.
+var IsTransient = func(err error) bool {
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || isTemporary(netErr)
+	}
+	return false
+}
+
+// isTemporary checks the deprecated Temporary() method that is still
+// implemented by many network errors.
+func isTemporary(err error) bool {
+	var t, ok = err.(interface{ Temporary() bool })
+	return ok && t.Temporary()
+}
+
+// Retry sets how many times the write failed with the transient error
+// (see IsTransient) is attempted. The delay before the next attempt
+// starts with the backoff and doubles after each attempt. The record
+// is counted as failed and passed to the error handler (see OnError())
+// only when all the attempts failed. The sink does not process other
+// records while it waits so keep the backoff short or use Async().
+// The attempts less than 2 turn off the retries.
+func (s *Sink) Retry(maxAttempts int, backoff time.Duration) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		if maxAttempts < 2 {
+			s.retry.Store((*retryPolicy)(nil))
+		} else {
+			s.retry.Store(&retryPolicy{attempts: maxAttempts, backoff: backoff})
+		}
+	}
+	return s
+}
+
+// writeRetrying writes the line to the output and retries the
+// transient errors.
+func (s *Sink) writeRetrying(line []byte) error {
+	n, err := s.writer.Write(line)
+	var r, _ = s.retry.Load().(*retryPolicy)
+	if err == nil || r == nil {
+		return err
+	}
+	var delay = r.backoff
+	for attempt := 1; attempt < r.attempts && IsTransient(err); attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		// The part of the line written before the error is not
+		// written again.
+		line = line[n:]
+		if n, err = s.writer.Write(line); err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package kiwi
+
+// This file consists of the ring buffer used as a queue for the sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// ringBatchSize is the maximum number of the records the sink takes
+// from the ring buffer at once.
+const ringBatchSize = 64
+
+// ringBuffer is a bounded multi-producer single-consumer queue. Each
+// slot has a sequence number that tells whether the slot is free
+// for the producer or filled for the consumer, so the producers only
+// compete for the tail index with CAS and never lock.
+type ringBuffer struct {
+	tail   uint64
+	_      [7]uint64 // keep producers and consumer counters on separate cache lines
+	head   uint64
+	_      [7]uint64
+	mask   uint64
+	slots  []ringSlot
+	signal chan struct{}
+}
+
+type ringSlot struct {
+	seq uint64
+	val chain
+}
+
+// newRingBuffer creates a ring buffer with the size rounded up to
+// the power of two. The signal channel gets a value when the records
+// are pushed to the buffer.
+func newRingBuffer(size int, signal chan struct{}) *ringBuffer {
+	var n = 2
+	for n < size {
+		n <<= 1
+	}
+	var r = &ringBuffer{mask: uint64(n - 1), slots: make([]ringSlot, n), signal: signal}
+	for i := range r.slots {
+		r.slots[i].seq = uint64(i)
+	}
+	return r
+}
+
+// push adds the value to the buffer. It waits for the consumer if
+// the buffer is full.
+func (r *ringBuffer) push(val chain) {
+	for {
+		var (
+			pos  = atomic.LoadUint64(&r.tail)
+			slot = &r.slots[pos&r.mask]
+			diff = int64(atomic.LoadUint64(&slot.seq)) - int64(pos)
+		)
+		switch {
+		case diff == 0:
+			if atomic.CompareAndSwapUint64(&r.tail, pos, pos+1) {
+				slot.val = val
+				atomic.StoreUint64(&slot.seq, pos+1)
+				select {
+				case r.signal <- struct{}{}:
+				default:
+				}
+				return
+			}
+		case diff < 0:
+			// The buffer is full, let the consumer work.
+			select {
+			case r.signal <- struct{}{}:
+			default:
+			}
+			runtime.Gosched()
+		}
+	}
+}
+
+// popBatch appends up to ringBatchSize values to dst. It should be
+// called only by the single consumer.
+func (r *ringBuffer) popBatch(dst []chain) []chain {
+	for len(dst) < ringBatchSize {
+		var (
+			pos  = r.head
+			slot = &r.slots[pos&r.mask]
+		)
+		if atomic.LoadUint64(&slot.seq) != pos+1 {
+			break
+		}
+		dst = append(dst, slot.val)
+		slot.val = chain{}
+		atomic.StoreUint64(&slot.seq, pos+r.mask+1)
+		atomic.StoreUint64(&r.head, pos+1)
+	}
+	return dst
+}
+
+// len returns approximate number of the values in the buffer.
+func (r *ringBuffer) len() int {
+	return int(atomic.LoadUint64(&r.tail) - atomic.LoadUint64(&r.head))
+}
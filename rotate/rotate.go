@@ -0,0 +1,373 @@
+package rotate
+
+// Sink writer that writes log records to the file and rotates it.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// BackupTimeFormat is the layout of the time added to the names of
+// the rotated files: "app-2019-01-02T15-04-05.000.log".
+var BackupTimeFormat = "2006-01-02T15-04-05.000"
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("rotate writer closed")
+
+// rename is replaced in the tests.
+var rename = os.Rename
+
+// Writer writes the records to the file and rotates the file by size
+// or by time. The rotated files are renamed with the time of the
+// rotation and optionally compressed by gzip. It conforms io.Writer
+// so it may be used as the output for kiwi.SinkTo():
+//
+//	w, err := rotate.New("/var/log/app.log")
+//	w.MaxSize(100 << 20).MaxBackups(7).Compress()
+//	kiwi.SinkTo(w, kiwi.AsLogfmt()).Start()
+//
+// Writer methods are safe for concurrent usage.
+type Writer struct {
+	filename string
+
+	sync.Mutex
+	file       *os.File
+	size       int64
+	opened     time.Time
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	every      time.Duration
+	compress   bool
+	closed     bool
+	hup        chan os.Signal
+	milling    sync.WaitGroup
+	mill       sync.Mutex
+}
+
+// New opens the file for appending. The directory of the file is
+// created if it does not exist.
+func New(filename string) (*Writer, error) {
+	w := &Writer{filename: filename}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// MaxSize sets the size of the file in bytes that causes the rotation.
+// The record is never split between the files.
+func (w *Writer) MaxSize(size int64) *Writer {
+	w.Lock()
+	w.maxSize = size
+	w.Unlock()
+	return w
+}
+
+// Every sets the interval of the rotation by time. The interval is
+// counted from the opening of the file.
+func (w *Writer) Every(interval time.Duration) *Writer {
+	w.Lock()
+	w.every = interval
+	w.Unlock()
+	return w
+}
+
+// MaxAge sets how long the rotated files are kept. The older files
+// removed after the rotation.
+func (w *Writer) MaxAge(age time.Duration) *Writer {
+	w.Lock()
+	w.maxAge = age
+	w.Unlock()
+	return w
+}
+
+// MaxBackups sets how many rotated files are kept. The oldest files
+// removed after the rotation.
+func (w *Writer) MaxBackups(n int) *Writer {
+	w.Lock()
+	w.maxBackups = n
+	w.Unlock()
+	return w
+}
+
+// Compress says to compress the rotated files by gzip. The files are
+// compressed in background after the rotation.
+func (w *Writer) Compress() *Writer {
+	w.Lock()
+	w.compress = true
+	w.Unlock()
+	return w
+}
+
+// ReopenOnSIGHUP reopens the file when the process gets SIGHUP. It
+// allows the rotation of the file by the external tools like
+// logrotate.
+func (w *Writer) ReopenOnSIGHUP() *Writer {
+	w.Lock()
+	if w.hup == nil {
+		w.hup = make(chan os.Signal, 1)
+		signal.Notify(w.hup, syscall.SIGHUP)
+		go func(hup chan os.Signal) {
+			for range hup {
+				w.Reopen()
+			}
+		}(w.hup)
+	}
+	w.Unlock()
+	return w
+}
+
+// Write writes the record to the file. The file rotated before the
+// writing if the record does not fit the size or the rotation time
+// came.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.size > 0 && (w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize ||
+		w.every > 0 && time.Since(w.opened) >= w.every) {
+		// The record is written to the current file when the
+		// rotation failed.
+		if err := w.rotate(); err != nil {
+			n, _ := w.file.Write(p)
+			w.size += int64(n)
+			return n, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file immediately.
+func (w *Writer) Rotate() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen closes and opens the file again. The file renamed or removed
+// by the external tool is created again.
+func (w *Writer) Reopen() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.file.Close()
+	return w.open()
+}
+
+// Flush commits the written records to the storage.
+func (w *Writer) Flush() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	return w.file.Sync()
+}
+
+// Close closes the file. It waits for the compression of the rotated
+// files.
+func (w *Writer) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	if w.hup != nil {
+		signal.Stop(w.hup)
+		close(w.hup)
+	}
+	var err = w.file.Close()
+	w.Unlock()
+	w.milling.Wait()
+	return err
+}
+
+// open opens the file for appending. It should be called under the
+// lock.
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.opened = time.Now()
+	return nil
+}
+
+// rotate renames the file and opens the new one. The old file is kept
+// open until the new one opened, so the writing continues if the
+// rotation failed. It should be called under the lock.
+func (w *Writer) rotate() error {
+	var old = w.file
+	// The rotations within the same millisecond get the distinct
+	// names.
+	var (
+		at   = time.Now()
+		name = w.backupName(at)
+	)
+	for exists(name) || exists(name+".gz") {
+		at = at.Add(time.Millisecond)
+		name = w.backupName(at)
+	}
+	if err := rename(w.filename, name); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	old.Close()
+	w.milling.Add(1)
+	go w.millBackups(w.compress, w.maxBackups, w.maxAge)
+	return nil
+}
+
+// backupName returns the name of the rotated file for the time.
+func (w *Writer) backupName(t time.Time) string {
+	var (
+		ext  = filepath.Ext(w.filename)
+		base = strings.TrimSuffix(w.filename, ext)
+	)
+	return base + "-" + t.Format(BackupTimeFormat) + ext
+}
+
+type backup struct {
+	name string
+	at   time.Time
+}
+
+// backups returns the rotated files from the newest to the oldest.
+func (w *Writer) backups() ([]backup, error) {
+	var (
+		dir    = filepath.Dir(w.filename)
+		ext    = filepath.Ext(w.filename)
+		prefix = strings.TrimSuffix(filepath.Base(w.filename), ext) + "-"
+	)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []backup
+	for _, entry := range entries {
+		var name = entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		var stamp = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)[len(prefix):]
+		at, err := time.ParseInLocation(BackupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		list = append(list, backup{filepath.Join(dir, name), at})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].at.After(list[j].at) })
+	return list, nil
+}
+
+// millBackups removes the old rotated files and compresses the rest.
+func (w *Writer) millBackups(compress bool, maxBackups int, maxAge time.Duration) {
+	defer w.milling.Done()
+	w.mill.Lock()
+	defer w.mill.Unlock()
+	list, err := w.backups()
+	if err != nil {
+		return
+	}
+	for i, b := range list {
+		if maxBackups > 0 && i >= maxBackups || maxAge > 0 && time.Since(b.at) > maxAge {
+			os.Remove(b.name)
+			continue
+		}
+		if compress && !strings.HasSuffix(b.name, ".gz") {
+			compressFile(b.name)
+		}
+	}
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// compressFile compresses the file by gzip and removes the original.
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var zw = gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,112 @@
+package rotate
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test the file rotated by size and the old backups removed.
+func TestWriter_RotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, err := New(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.MaxSize(10).MaxBackups(2).Compress()
+
+	for _, record := range []string{"record=1\n", "record=2\n", "record=3\n", "record=4\n"} {
+		w.Write([]byte(record))
+	}
+	w.Close()
+
+	entries, _ := ioutil.ReadDir(dir)
+	var backups int
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "app-") && strings.HasSuffix(entry.Name(), ".log.gz") {
+			backups++
+		}
+	}
+	current, _ := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if backups != 2 || string(current) != "record=4\n" {
+		t.Logf("expected 2 compressed backups and the last record got %d files: %q", len(entries), current)
+		t.Fail()
+	}
+}
+
+// Test the writing continues to the current file when the rename
+// failed.
+func TestWriter_RenameFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { rename = os.Rename }()
+	w, err := New(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.MaxSize(10)
+	rename = func(string, string) error { return errors.New("rename failed") }
+
+	w.Write([]byte("record=1\n"))
+	_, rotateErr := w.Write([]byte("record=2\n"))
+	rename = os.Rename
+	w.Write([]byte("record=3\n"))
+	w.Close()
+
+	entries, _ := ioutil.ReadDir(dir)
+	current, _ := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if rotateErr == nil || len(entries) != 2 || string(current) != "record=3\n" {
+		t.Logf("expected the rotation error and 1 backup got %v, %d files: %q", rotateErr, len(entries), current)
+		t.Fail()
+	}
+}
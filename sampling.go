@@ -0,0 +1,219 @@
+package kiwi
+
+// This file consists of the adaptive sampling of the records for the sinks under pressure.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type adaptiveSampling struct {
+	ratio   uint64 // keep 1 of ratio low severity records
+	counter uint64
+	start   float64
+	max     uint64
+}
+
+// AdaptiveSampling enables sampling of the records with severity lower
+// than "warning" (see SeverityKey) when the queue of the sink is
+// filled more than start part (0.0-1.0). Under the pressure the
+// sampling ratio doubled on each record up to 1 of maxRatio records.
+// When the queue is filled less than half of start the ratio halved
+// back until all the records pass again. The current ratio is
+// reported by Stats(). Zero start disables the sampling.
+func (s *Sink) AdaptiveSampling(start float64, maxRatio uint64) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		if start <= 0 {
+			s.sampling.Store((*adaptiveSampling)(nil))
+		} else {
+			if maxRatio < 1 {
+				maxRatio = 1
+			}
+			s.sampling.Store(&adaptiveSampling{ratio: 1, start: start, max: maxRatio})
+		}
+	}
+	return s
+}
+
+// queueFill returns the filled part of the sink queue.
+func (s *Sink) queueFill() float64 {
+	var depth, capacity = s.queueDepth()
+	return float64(depth) / float64(capacity)
+}
+
+// queueDepth returns the number of the records in the sink queue and
+// the capacity of the queue.
+func (s *Sink) queueDepth() (int, int) {
+	if q, _ := s.async.Load().(*asyncQueue); q != nil {
+		return len(q.records), cap(q.records)
+	}
+	if ring, _ := s.ring.Load().(*ringBuffer); ring != nil {
+		return ring.len(), len(ring.slots)
+	}
+	return len(s.In), cap(s.In)
+}
+
+// sample reports whether the record should be passed to the sink
+// queue according to the adaptive sampling.
+func (s *Sink) sample(record []*Pair) bool {
+	var a, _ = s.sampling.Load().(*adaptiveSampling)
+	if a == nil {
+		return true
+	}
+	var (
+		fill  = s.queueFill()
+		ratio = atomic.LoadUint64(&a.ratio)
+	)
+	switch {
+	case fill >= a.start && ratio < a.max:
+		ratio *= 2
+		if ratio > a.max {
+			ratio = a.max
+		}
+		atomic.StoreUint64(&a.ratio, ratio)
+	case fill < a.start/2 && ratio > 1:
+		ratio /= 2
+		atomic.StoreUint64(&a.ratio, ratio)
+	}
+	if ratio <= 1 || severityOf(record) >= warningSeverity {
+		return true
+	}
+	if atomic.AddUint64(&a.counter, 1)%ratio == 0 {
+		return true
+	}
+	atomic.AddUint64(&s.stats.sampled, 1)
+	return false
+}
+
+// samplingRatio returns the current ratio of the adaptive sampling.
+func (s *Sink) samplingRatio() uint64 {
+	if a, _ := s.sampling.Load().(*adaptiveSampling); a != nil {
+		return atomic.LoadUint64(&a.ratio)
+	}
+	return 1
+}
+
+// fixedSampling passes 1 of every records and no more than rate
+// records per second.
+type fixedSampling struct {
+	every   uint64
+	counter uint64
+
+	sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// SampleEvery passes only 1 of each n records that matched the
+// filters of the sink, the rest are skipped and counted in Stats().
+// Unlike AdaptiveSampling() it applies to the records of any
+// severity so it is intended for the sinks of the high volume debug
+// records. The value less than 2 disables the sampling.
+func (s *Sink) SampleEvery(n uint64) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		var f = s.copyFixedSampling()
+		f.every = n
+		s.fixedSampling.Store(f)
+		s.Unlock()
+	}
+	return s
+}
+
+// SamplePerSecond passes no more than rate records per second
+// (with bursts up to rate records, at least one) that matched the filters of the
+// sink, the rest are skipped and counted in Stats(). It could be
+// combined with SampleEvery(). Zero rate disables the limit.
+func (s *Sink) SamplePerSecond(rate float64) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		var f = s.copyFixedSampling()
+		f.rate = rate
+		f.tokens = rate
+		s.fixedSampling.Store(f)
+		s.Unlock()
+	}
+	return s
+}
+
+// copyFixedSampling returns the new sampling settings with the
+// values of the current ones.
+func (s *Sink) copyFixedSampling() *fixedSampling {
+	var f = &fixedSampling{last: s.collector.now()}
+	if old, _ := s.fixedSampling.Load().(*fixedSampling); old != nil {
+		f.every = old.every
+		old.Lock()
+		f.rate = old.rate
+		f.tokens = old.tokens
+		old.Unlock()
+	}
+	return f
+}
+
+// sampleFixed reports whether the record passes SampleEvery() and
+// SamplePerSecond() settings of the sink.
+func (s *Sink) sampleFixed() bool {
+	var f, _ = s.fixedSampling.Load().(*fixedSampling)
+	if f == nil {
+		return true
+	}
+	if f.every > 1 && (atomic.AddUint64(&f.counter, 1)-1)%f.every != 0 {
+		atomic.AddUint64(&s.stats.sampled, 1)
+		return false
+	}
+	if f.rate > 0 {
+		f.Lock()
+		var now = s.collector.now()
+		f.tokens += now.Sub(f.last).Seconds() * f.rate
+		var burst = f.rate
+		if burst < 1 {
+			burst = 1
+		}
+		if f.tokens > burst {
+			f.tokens = burst
+		}
+		f.last = now
+		var pass = f.tokens >= 1
+		if pass {
+			f.tokens--
+		}
+		f.Unlock()
+		if !pass {
+			atomic.AddUint64(&s.stats.sampled, 1)
+			return false
+		}
+	}
+	return true
+}
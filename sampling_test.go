@@ -0,0 +1,205 @@
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Test that the sampling ratio grows under the pressure and restored
+// after.
+func TestSink_AdaptiveSampling(t *testing.T) {
+	// The sink without processing goroutine so the queue is not
+	// consumed.
+	state := sinkStopped
+	out := (&Sink{In: make(chan chain, 16), state: &state}).AdaptiveSampling(0.5, 8)
+	low := []*Pair{{"level", "debug", nil, StringVal}}
+	high := []*Pair{{"level", "error", nil, StringVal}}
+	// Fill the queue of the sink.
+	for i := 0; i < cap(out.In); i++ {
+		out.In <- chain{}
+	}
+
+	var passed int
+	for i := 0; i < 16; i++ {
+		if out.sample(low) {
+			passed++
+		}
+	}
+	highPassed := out.sample(high)
+	underPressure := out.Stats()
+	for len(out.In) > 0 {
+		<-out.In
+	}
+	for i := 0; i < 3; i++ {
+		out.sample(low)
+	}
+	restored := out.Stats()
+
+	if underPressure.SamplingRatio != 8 || passed >= 16 || underPressure.Sampled == 0 {
+		t.Logf("expected sampling under pressure got %+v with %d passed", underPressure, passed)
+		t.Fail()
+	}
+	if !highPassed {
+		t.Log("high severity record should not be sampled")
+		t.Fail()
+	}
+	if restored.SamplingRatio != 1 {
+		t.Logf("expected restored ratio got %+v", restored)
+		t.Fail()
+	}
+}
+
+// Test that only the low severity records are shed over the
+// high-water mark.
+func TestSink_ShedLoad(t *testing.T) {
+	state := sinkStopped
+	out := (&Sink{In: make(chan chain, 4), state: &state}).ShedLoad(0.75)
+	low := []*Pair{{"level", "info", nil, StringVal}}
+	high := []*Pair{{"level", "warning", nil, StringVal}}
+
+	shedBefore := out.shed(low)
+	for i := 0; i < 3; i++ {
+		out.In <- chain{}
+	}
+	shedLow := out.shed(low)
+	shedHigh := out.shed(high)
+
+	if shedBefore || !shedLow || shedHigh || out.Stats().Shed != 1 {
+		t.Logf("unexpected shedding: %v %v %v %+v", shedBefore, shedLow, shedHigh, out.Stats())
+		t.Fail()
+	}
+}
+
+// Test of 1-in-N and the rate based sampling.
+func TestSink_SampleEvery(t *testing.T) {
+	state := sinkStopped
+	every := (&Sink{state: &state}).SampleEvery(3)
+	perSecond := (&Sink{state: &state}).SamplePerSecond(2)
+
+	var passedEvery, passedRate int
+	for i := 0; i < 9; i++ {
+		if every.sampleFixed() {
+			passedEvery++
+		}
+		if perSecond.sampleFixed() {
+			passedRate++
+		}
+	}
+
+	if passedEvery != 3 || every.Stats().Sampled != 6 {
+		t.Logf("expected 3 of 9 records passed got %d %+v", passedEvery, every.Stats())
+		t.Fail()
+	}
+	if passedRate != 2 || perSecond.Stats().Sampled != 7 {
+		t.Logf("expected 2 records passed in a second got %d %+v", passedRate, perSecond.Stats())
+		t.Fail()
+	}
+}
+
+// Test of the rate limits per the values of the key.
+func TestSink_LimitByKey(t *testing.T) {
+	state := sinkStopped
+	out := (&Sink{state: &state}).LimitByKey("tenant", 0.001, 2)
+	noisy := []*Pair{{Key: "tenant", Val: "noisy"}}
+	quiet := []*Pair{{Key: "tenant", Val: "quiet"}}
+	other := []*Pair{{Key: "k", Val: "v"}}
+
+	var passedNoisy, passedQuiet, passedOther int
+	for i := 0; i < 5; i++ {
+		if out.limitByKeys(noisy) {
+			passedNoisy++
+		}
+		if out.limitByKeys(other) {
+			passedOther++
+		}
+	}
+	if out.limitByKeys(quiet) {
+		passedQuiet++
+	}
+
+	if passedNoisy != 2 || passedQuiet != 1 || passedOther != 5 || out.Stats().Sampled != 3 {
+		t.Logf("expected 2, 1 and 5 records passed got %d, %d and %d %+v", passedNoisy, passedQuiet, passedOther, out.Stats())
+		t.Fail()
+	}
+}
+
+// Test of the rate limits refilled by the clock of the collector.
+func TestSink_LimitByKey_Clock(t *testing.T) {
+	state := sinkStopped
+	now := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	c := NewCollector().SetClock(ClockFunc(func() time.Time { return now }))
+	out := (&Sink{state: &state, collector: c}).LimitByKey("tenant", 1, 1)
+	record := []*Pair{{Key: "tenant", Val: "noisy"}}
+
+	first := out.limitByKeys(record)
+	limited := out.limitByKeys(record)
+	now = now.Add(time.Second)
+	refilled := out.limitByKeys(record)
+
+	if !first || limited || !refilled {
+		t.Logf("expected the token refilled after a second got %v %v %v", first, limited, refilled)
+		t.Fail()
+	}
+}
+
+// Test the buckets of the key are limited, the least recently used
+// bucket removed for the new value.
+func TestSink_LimitByKey_MaxBuckets(t *testing.T) {
+	state := sinkStopped
+	out := (&Sink{state: &state}).LimitByKey("tenant", 0.001, 1)
+	noisy := []*Pair{{Key: "tenant", Val: "noisy"}}
+
+	out.limitByKeys(noisy)
+	for i := 0; i < 2*maxKeyBuckets; i++ {
+		out.limitByKeys(noisy)
+		out.limitByKeys([]*Pair{{Key: "tenant", Val: strconv.Itoa(i)}})
+	}
+	limited := !out.limitByKeys(noisy)
+
+	var buckets = len(out.keyLimits["tenant"].buckets)
+	if buckets != maxKeyBuckets || !limited {
+		t.Logf("expected %d buckets and the noisy value limited got %d buckets, limited %v", maxKeyBuckets, buckets, limited)
+		t.Fail()
+	}
+}
@@ -0,0 +1,222 @@
+package kiwi
+
+// This file consists of the record schemas and their validation.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// SchemaKey is the key of the pair with the version of the
+	// schema added to the records.
+	SchemaKey = "schema"
+	// SchemaErrorKey is the key of the pair that lists the
+	// violations of the schema found in the record.
+	SchemaErrorKey = "schema-error"
+)
+
+type (
+	// Schema declares the keys of the records, the kinds and the
+	// allowed values of their values. The records validated against
+	// the schema are marked with the version of the schema so the
+	// downstream parsers could evolve safely:
+	//
+	//	v2 := kiwi.NewSchema("v2").
+	//		Require(kiwi.SeverityKey, kiwi.StringVal).
+	//		Enum(kiwi.SeverityKey, "debug", "info", "warning", "error").
+	//		Optional("duration", kiwi.IntegerVal)
+	//	log := kiwi.New().Schema(v2)
+	//	log.Log("level", "fatal")
+	//	// schema="v2" level="fatal" schema-error="level: unexpected value \"fatal\""
+	//
+	// The schema should not be changed after it was attached to a
+	// logger or a sink.
+	Schema struct {
+		version string
+		keys    map[string]*keyRule
+		strict  bool
+	}
+	keyRule struct {
+		required bool
+		kinds    []int
+		enum     map[string]bool
+	}
+)
+
+// NewSchema creates an empty schema of the version.
+func NewSchema(version string) *Schema {
+	return &Schema{version: version, keys: make(map[string]*keyRule)}
+}
+
+// Version returns the version of the schema.
+func (s *Schema) Version() string {
+	return s.version
+}
+
+// Require declares the key that should be present in each record.
+// The value of the key should be of one of the kinds (StringVal,
+// IntegerVal etc.) if they set.
+func (s *Schema) Require(key string, kinds ...int) *Schema {
+	var rule = s.rule(key)
+	rule.required = true
+	rule.kinds = kinds
+	return s
+}
+
+// Optional declares the key that may be absent in the records. The
+// value of the key should be of one of the kinds if they set.
+func (s *Schema) Optional(key string, kinds ...int) *Schema {
+	s.rule(key).kinds = kinds
+	return s
+}
+
+// Enum restricts the values of the key to the list.
+func (s *Schema) Enum(key string, vals ...string) *Schema {
+	var rule = s.rule(key)
+	rule.enum = make(map[string]bool, len(vals))
+	for _, val := range vals {
+		rule.enum[val] = true
+	}
+	return s
+}
+
+// Strict says that the keys not declared in the schema are the
+// violations too.
+func (s *Schema) Strict() *Schema {
+	s.strict = true
+	return s
+}
+
+func (s *Schema) rule(key string) *keyRule {
+	var rule, ok = s.keys[key]
+	if !ok {
+		rule = new(keyRule)
+		s.keys[key] = rule
+	}
+	return rule
+}
+
+// Validate returns the violations of the schema found in the record.
+// The result is empty for the valid record.
+func (s *Schema) Validate(record []*Pair) []string {
+	var (
+		violations []string
+		seen       = make(map[string]bool, len(s.keys))
+	)
+	for _, pair := range record {
+		if pair.Key == SchemaKey || pair.Key == SchemaErrorKey {
+			continue
+		}
+		// The generators of the pairs are expanded by the sinks.
+		if _, ok := pair.Eval.(*lazyPairs); ok {
+			continue
+		}
+		var rule, ok = s.keys[pair.Key]
+		if !ok {
+			if s.strict {
+				violations = append(violations, pair.Key+": unexpected key")
+			}
+			continue
+		}
+		seen[pair.Key] = true
+		if len(rule.kinds) > 0 && !hasKind(rule.kinds, pair.Type) {
+			violations = append(violations, pair.Key+": unexpected kind of value")
+		}
+		if rule.enum != nil && !rule.enum[pair.Val] {
+			violations = append(violations, pair.Key+": unexpected value "+strconv.Quote(pair.Val))
+		}
+	}
+	var missed []string
+	for key, rule := range s.keys {
+		if rule.required && !seen[key] {
+			missed = append(missed, key+": required key missed")
+		}
+	}
+	// The map order is random so the missed keys sorted to keep the
+	// result stable.
+	sort.Strings(missed)
+	return append(violations, missed...)
+}
+
+// apply validates the record and returns its copy with the version
+// of the schema first and the violations last.
+func (s *Schema) apply(record []*Pair) (result []*Pair, valid bool) {
+	var violations = s.Validate(record)
+	result = make([]*Pair, 0, len(record)+2)
+	result = append(result, &Pair{SchemaKey, s.version, nil, StringVal})
+	for _, pair := range record {
+		// The pairs of the schema applied before (by the logger
+		// for example) are replaced.
+		if pair.Key != SchemaKey && pair.Key != SchemaErrorKey {
+			result = append(result, pair)
+		}
+	}
+	if len(violations) > 0 {
+		result = append(result, &Pair{SchemaErrorKey, strings.Join(violations, "; "), nil, StringVal})
+	}
+	return result, len(violations) == 0
+}
+
+func hasKind(kinds []int, kind int) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema attaches the schema to the logger. The records of the
+// logger are marked with the version of the schema and the
+// violations of the schema are reported under SchemaErrorKey. Nil
+// schema detaches it.
+func (l *Logger) Schema(schema *Schema) *Logger {
+	l.schema = schema
+	return l
+}
+
+// Schema sets the schema for the records written by the sink. The
+// records are marked with the version of the schema and the
+// violations of the schema are reported under SchemaErrorKey and
+// counted by Stats(). Nil schema removes it.
+func (s *Sink) Schema(schema *Schema) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.schema = schema
+		s.Unlock()
+	}
+	return s
+}
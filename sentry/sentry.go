@@ -0,0 +1,387 @@
+package sentry
+
+// Sentry writer for kiwi that sends the error records as Sentry events.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafov/kiwi"
+)
+
+// Defaults for the writer. They may be changed per writer with
+// MaxPending() method.
+var (
+	DefaultMaxPending = 1000
+	DefaultTimeout    = 10 * time.Second
+)
+
+// Limits of Sentry tags, the longer keys and values are passed in the
+// extra data of the event.
+const (
+	MaxTagKey   = 32
+	MaxTagValue = 200
+)
+
+// Levels are the values of kiwi.SeverityKey sent to Sentry and their
+// Sentry levels.
+var Levels = map[string]string{
+	"error":    "error",
+	"critical": "fatal",
+	"panic":    "fatal",
+	"fatal":    "fatal",
+}
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("sentry writer closed")
+
+// ErrInvalidDSN returned by New() for the DSN without the key or the
+// project.
+var ErrInvalidDSN = errors.New("sentry: invalid DSN")
+
+// Event is the event of Sentry store API.
+type Event struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   float64                `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger"`
+	Platform    string                 `json:"platform"`
+	Message     string                 `json:"message,omitempty"`
+	Exception   *Exceptions            `json:"exception,omitempty"`
+	Fingerprint []string               `json:"fingerprint,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// Exceptions is the exception interface of the event.
+type Exceptions struct {
+	Values []Exception `json:"values"`
+}
+
+// Exception describes the error of the record.
+type Exception struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Writer converts the error records to Sentry events and sends them
+// in background. It gets the records formatted as JSON so it may be
+// used as the output for kiwi.SinkTo():
+//
+//	w, err := sentry.New("https://key@o1.ingest.sentry.io/42")
+//	kiwi.SinkTo(w, kiwi.AsJSON()).Start()
+//	...
+//	log.Error("msg", "payment failed", "error", err, "user", id)
+//
+// Only the records with kiwi.SeverityKey listed in Levels and with
+// kiwi.ErrKey pair are sent. The error message becomes the exception
+// of the event and its fingerprint so the records with the same error
+// are grouped in one issue. The value of kiwi.MessageKey becomes the
+// message of the event, the stack (kiwi.StackKey) and the objects go
+// to the extra data, other pairs become the tags. The events wait in
+// the memory until they are sent, Write() never blocks on Sentry.
+// Writer methods are safe for concurrent usage.
+type Writer struct {
+	endpoint string
+	auth     string
+
+	sync.Mutex
+	client     *http.Client
+	logger     string
+	sampleRate float64
+	maxPending int
+	pending    chan []byte
+	dropped    int
+	lastErr    error
+	closed     bool
+	started    sync.Once
+	done       chan struct{}
+	sending    sync.WaitGroup
+}
+
+// New creates the writer for the project of the DSN.
+func New(dsn string) (*Writer, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		project = strings.Trim(u.Path, "/")
+		path    string
+	)
+	if i := strings.LastIndexByte(project, '/'); i >= 0 {
+		path, project = "/"+project[:i], project[i+1:]
+	}
+	if u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, ErrInvalidDSN
+	}
+	var auth = "Sentry sentry_version=7, sentry_client=kiwi/1.0, sentry_key=" + u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return &Writer{
+		endpoint:   u.Scheme + "://" + u.Host + path + "/api/" + project + "/store/",
+		auth:       auth,
+		client:     &http.Client{Timeout: DefaultTimeout},
+		logger:     "kiwi",
+		sampleRate: 1,
+		maxPending: DefaultMaxPending,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Logger sets the name of the logger of the events.
+func (w *Writer) Logger(name string) *Writer {
+	w.Lock()
+	w.logger = name
+	w.Unlock()
+	return w
+}
+
+// SampleRate sets the part (0.0-1.0) of the events that are sent. The
+// rest are dropped without counting.
+func (w *Writer) SampleRate(rate float64) *Writer {
+	w.Lock()
+	w.sampleRate = rate
+	w.Unlock()
+	return w
+}
+
+// MaxPending restricts number of the events waiting for sending. The
+// new events are dropped when the limit is reached. It should be set
+// before the first record will be written.
+func (w *Writer) MaxPending(n int) *Writer {
+	if n > 0 {
+		w.Lock()
+		w.maxPending = n
+		w.Unlock()
+	}
+	return w
+}
+
+// Write converts the record to the event and queues it for sending.
+// The records that are not errors are skipped. It returns the error
+// of the last failed sending if any, the error is reported only
+// once.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.started.Do(w.start)
+	var record map[string]interface{}
+	var dec = json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return 0, err
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	var err = w.lastErr
+	w.lastErr = nil
+	var event = w.event(record)
+	if event == nil || (w.sampleRate < 1 && mrand.Float64() >= w.sampleRate) {
+		return len(p), err
+	}
+	body, merr := json.Marshal(event)
+	if merr != nil {
+		return 0, merr
+	}
+	select {
+	case w.pending <- body:
+	default:
+		w.dropped++
+	}
+	return len(p), err
+}
+
+// event converts the record or returns nil if the record should not
+// be sent.
+func (w *Writer) event(record map[string]interface{}) *Event {
+	var level, _ = record[kiwi.SeverityKey].(string)
+	sentryLevel, ok := Levels[level]
+	if !ok {
+		return nil
+	}
+	var errValue, hasErr = record[kiwi.ErrKey]
+	if !hasErr {
+		return nil
+	}
+	var message = text(errValue)
+	var event = &Event{
+		EventID:     eventID(),
+		Timestamp:   float64(time.Now().UnixNano()) / float64(time.Second),
+		Level:       sentryLevel,
+		Logger:      w.logger,
+		Platform:    "go",
+		Exception:   &Exceptions{Values: []Exception{{Type: "error", Value: message}}},
+		Fingerprint: []string{message},
+	}
+	if msg, ok := record[kiwi.MessageKey].(string); ok {
+		event.Message = msg
+	}
+	for key, val := range record {
+		switch key {
+		case kiwi.SeverityKey, kiwi.ErrKey, kiwi.MessageKey:
+			continue
+		}
+		var tag, scalar = val.(string)
+		if n, ok := val.(json.Number); ok {
+			tag, scalar = n.String(), true
+		} else if b, ok := val.(bool); ok {
+			tag, scalar = fmt.Sprint(b), true
+		}
+		if key == kiwi.StackKey || !scalar || len(key) > MaxTagKey || len(tag) > MaxTagValue {
+			if event.Extra == nil {
+				event.Extra = make(map[string]interface{})
+			}
+			event.Extra[key] = val
+			continue
+		}
+		if event.Tags == nil {
+			event.Tags = make(map[string]string)
+		}
+		event.Tags[key] = tag
+	}
+	return event
+}
+
+// Dropped returns number of the events that were dropped because of
+// MaxPending limit.
+func (w *Writer) Dropped() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.dropped
+}
+
+// Close sends the pending events and stops the writer.
+func (w *Writer) Close() error {
+	w.started.Do(w.start)
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	close(w.done)
+	w.Unlock()
+	w.sending.Wait()
+	w.Lock()
+	defer w.Unlock()
+	return w.lastErr
+}
+
+func (w *Writer) start() {
+	w.Lock()
+	w.pending = make(chan []byte, w.maxPending)
+	w.Unlock()
+	w.sending.Add(1)
+	go w.sender()
+}
+
+// sender sends the queued events until the writer closed.
+func (w *Writer) sender() {
+	defer w.sending.Done()
+	for {
+		select {
+		case body := <-w.pending:
+			w.report(w.send(body))
+		case <-w.done:
+			for {
+				select {
+				case body := <-w.pending:
+					w.report(w.send(body))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *Writer) report(err error) {
+	if err != nil {
+		w.Lock()
+		w.lastErr = err
+		w.Unlock()
+	}
+}
+
+// send posts the event to the store endpoint.
+func (w *Writer) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", w.auth)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sentry: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// text returns the error message of the error pair.
+func text(val interface{}) string {
+	if s, ok := val.(string); ok {
+		return s
+	}
+	var b, _ = json.Marshal(val)
+	return string(b)
+}
+
+// eventID returns the random UUID in hex without dashes.
+func eventID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return hex.EncodeToString(id[:])
+}
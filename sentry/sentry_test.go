@@ -0,0 +1,130 @@
+package sentry
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSentry keeps the events posted to the store endpoint.
+type fakeSentry struct {
+	sync.Mutex
+	events []Event
+	auth   string
+	path   string
+}
+
+func (f *fakeSentry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	var event Event
+	json.NewDecoder(r.Body).Decode(&event)
+	f.events = append(f.events, event)
+	f.auth = r.Header.Get("X-Sentry-Auth")
+	f.path = r.URL.Path
+	w.Write([]byte(`{"id":"` + event.EventID + `"}`))
+}
+
+// Test of the error records converted to the events.
+func TestWriter_ErrorEvents(t *testing.T) {
+	var fake fakeSentry
+	srv := httptest.NewServer(&fake)
+	defer srv.Close()
+	w, err := New(strings.Replace(srv.URL, "://", "://public@", 1) + "/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write([]byte(`{"level":"info","error":"ignored"}` + "\n"))
+	w.Write([]byte(`{"level":"error","msg":"no error pair"}` + "\n"))
+	w.Write([]byte(`{"level":"fatal","msg":"payment failed","error":"card declined","user":7,"retry":true,"stack":"main.pay()"}` + "\n"))
+	err = w.Close()
+
+	if err != nil || len(fake.events) != 1 {
+		t.Fatalf("expected single event got %d with error %v", len(fake.events), err)
+	}
+	if fake.path != "/api/42/store/" || !strings.Contains(fake.auth, "sentry_key=public") {
+		t.Logf("unexpected request to %s with auth %q", fake.path, fake.auth)
+		t.Fail()
+	}
+	e := fake.events[0]
+	if e.Level != "fatal" || e.Message != "payment failed" || len(e.EventID) != 32 ||
+		e.Exception == nil || e.Exception.Values[0].Value != "card declined" ||
+		len(e.Fingerprint) != 1 || e.Fingerprint[0] != "card declined" {
+		t.Logf("unexpected event %+v", e)
+		t.Fail()
+	}
+	if len(e.Tags) != 2 || e.Tags["user"] != "7" || e.Tags["retry"] != "true" || e.Extra["stack"] != "main.pay()" {
+		t.Logf("unexpected tags %v and extra %v", e.Tags, e.Extra)
+		t.Fail()
+	}
+}
+
+// Test of the sampled events.
+func TestWriter_SampleRate(t *testing.T) {
+	var fake fakeSentry
+	srv := httptest.NewServer(&fake)
+	defer srv.Close()
+	w, _ := New(strings.Replace(srv.URL, "://", "://public@", 1) + "/42")
+	w.SampleRate(0)
+
+	w.Write([]byte(`{"level":"error","error":"sampled"}` + "\n"))
+	w.Close()
+
+	if len(fake.events) != 0 {
+		t.Logf("expected no events got %v", fake.events)
+		t.Fail()
+	}
+}
+
+// Test of the invalid DSN.
+func TestNew_InvalidDSN(t *testing.T) {
+	_, err := New("https://o1.ingest.sentry.io/42")
+
+	if err != ErrInvalidDSN {
+		t.Logf("expected ErrInvalidDSN got %v", err)
+		t.Fail()
+	}
+}
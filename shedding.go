@@ -0,0 +1,59 @@
+package kiwi
+
+// This file consists of the load shedding of the sink queues.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import "sync/atomic"
+
+// ShedLoad enables the degrade mode of the sink. When the queue of
+// the sink is filled more than highWater part (0.0-1.0) the records
+// with severity lower than "warning" (see SeverityKey) are not queued
+// anymore while the warnings and errors are queued as usual. So the
+// important records are kept during the incidents. The shed records
+// are counted by Stats(). Zero highWater disables the degrade mode.
+func (s *Sink) ShedLoad(highWater float64) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.shedding.Store(highWater)
+	}
+	return s
+}
+
+// shed reports whether the record should be shed because the sink
+// queue is over the high-water mark.
+func (s *Sink) shed(record []*Pair) bool {
+	var mark, _ = s.shedding.Load().(float64)
+	if mark <= 0 || s.queueFill() < mark || severityOf(record) >= warningSeverity {
+		return false
+	}
+	atomic.AddUint64(&s.stats.shed, 1)
+	return true
+}
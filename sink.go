@@ -34,8 +34,14 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 ॐ तारे तुत्तारे तुरे स्व */
 
+// The package has the global context variable so the standard
+// package imported under other name.
 import (
+	stdcontext "context"
 	"io"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -48,34 +54,156 @@ const (
 	sinkActive
 )
 
-// Sinks accepts records through the chanels.
-// Each sink has its own channel.
-var collector struct {
-	sync.RWMutex
-	sinks []*Sink
-	count int
-}
-
 type (
 	// Sink used for filtering incoming log records from all logger instances
 	// and decides how to filter them. Each output wraps its own io.Writer.
 	// Sink methods are safe for concurrent usage.
 	Sink struct {
 		id     uint
+		name   string
 		In     chan chain
 		close  chan struct{}
 		writer io.Writer
 		format Formatter
 		state  *int32
+		// collector owns the sink.
+		collector *Collector
+		// ring keeps *ringBuffer when the sink uses it instead of
+		// the channel.
+		ring       atomic.Value
+		ringSignal chan struct{}
+		// async keeps *asyncQueue when the logger does not wait
+		// the sink.
+		async       atomic.Value
+		asyncSignal chan struct{}
+		// flushRequest gets the channels closed by the sink when
+		// the queued records were written.
+		flushRequest chan chan struct{}
+		// exited closed when the goroutine of the sink exited.
+		exited chan struct{}
+		// priority keeps *priorityRule for the records that
+		// passed through the priority lane.
+		priority     atomic.Value
+		priorityLane chan chain
+		stats        sinkCounters
+		// sampling keeps *adaptiveSampling
+		sampling atomic.Value
+		// fixedSampling keeps *fixedSampling
+		fixedSampling atomic.Value
+		// shedding keeps the high-water mark of the queue
+		shedding atomic.Value
+		// batch keeps *writeBatch
+		batch atomic.Value
+		// deadline keeps *writeDeadline
+		deadline  atomic.Value
+		unhealthy int32
+		// retry keeps *retryPolicy
+		retry atomic.Value
+		// onError keeps ErrorHandler
+		onError atomic.Value
+		// lastWrite is the time of the last write in nanoseconds
+		lastWrite int64
 
 		sync.RWMutex
 		positiveFilters map[string]Filter
 		negativeFilters map[string]Filter
+		recordFilters   []RecordFilter
+		keyLimits       map[string]*keyLimit
 		hiddenKeys      map[string]bool
+		maskedKeys      map[string]bool
+		redactors       []Redactor
+		foldKeys        bool
+		foldVals        bool
+		floatFormat     byte
+		floatPrecision  int
+		boolStrings     []string
+		nilString       *string
+		durationFormat  *int
+		bytesFormat     *int
+		aliases         map[string]string
+		transformKeys   func(string) string
+		onlyKeys        map[string]bool
+		catchAllKey     string
+		keyOrder        *keyOrder
+		terminator      []byte
+		schema          *Schema
+		guard           *keyGuard
+		heartbeat       *heartbeat
+		dedup           *dedup
 	}
 	chain struct {
-		wg    *sync.WaitGroup
-		pairs []*Pair
+		rec *record
+		// size of the record accounted in the memory budget
+		size int64
+		// heartbeat records and other synthetic records (see
+		// inject()) bypass the filters
+		heartbeat bool
+		// async records are not waited by the logger
+		async bool
+	}
+	// SinkStats keeps the counters of the sink.
+	SinkStats struct {
+		// Dropped is the number of the records dropped by the sink
+		// without writing (because of the memory budget etc.).
+		Dropped uint64
+		// Sampled is the number of the records skipped by the
+		// adaptive sampling, by SampleEvery(),
+		// SamplePerSecond() and LimitByKey().
+		Sampled uint64
+		// Shed is the number of the low severity records that were
+		// not queued in the degrade mode (see ShedLoad()).
+		Shed uint64
+		// Failed is the number of the records that were not
+		// written because of the errors of the output or were not
+		// written in time (see WriteTimeout(), OnError()).
+		Failed uint64
+		// Invalid is the number of the records that violate the
+		// schema of the sink (see Schema()).
+		Invalid uint64
+		// Guarded is the number of the records that broke the
+		// limits of the guard (see Guard()).
+		Guarded uint64
+		// Filtered is the number of the records rejected by the
+		// filters of the sink.
+		Filtered uint64
+		// Deduplicated is the number of the repeated records
+		// suppressed by DedupWindow().
+		Deduplicated uint64
+		// Written is the number of the successful writes to the
+		// output (a batch is written at once, see Batch()).
+		Written uint64
+		// WriteLatency is the distribution of the time spent for
+		// the writes to the output.
+		WriteLatency Histogram
+		// SamplingRatio is the current ratio of the adaptive
+		// sampling: 1 of SamplingRatio low severity records passed.
+		SamplingRatio uint64
+		// QueueFill is the filled part of the sink queue (0.0-1.0).
+		QueueFill float64
+		// QueueDepth is the number of the records in the sink
+		// queue and QueueCapacity is its size (see Buffer()).
+		QueueDepth    int
+		QueueCapacity int
+		// QueueHighWater is the maximal depth of the sink queue
+		// since the sink created.
+		QueueHighWater int
+	}
+	sinkCounters struct {
+		dropped      uint64
+		sampled      uint64
+		shed         uint64
+		failed       uint64
+		invalid      uint64
+		guarded      uint64
+		filtered     uint64
+		deduplicated uint64
+		written      uint64
+		latency      latencyCounters
+		highWater    int64
+	}
+	priorityRule struct {
+		key  string
+		vals valsFilter
 	}
 )
 
@@ -84,21 +212,36 @@ type (
 // records to different places.
 // The sink requires explicit start with Start() before usage.
 // That allows firstly setup filters before sink will really accept any records.
-func SinkTo(w io.Writer, fn Formatter) *Sink {
-	collector.RLock()
-	for i, sink := range collector.sinks {
+// The options (see Buffer()) are applied only to the new sink, they
+// are ignored if the sink for the writer already exists.
+func SinkTo(w io.Writer, fn Formatter, opts ...SinkOption) *Sink {
+	return DefaultCollector.SinkTo(w, fn, opts...)
+}
+
+// SinkTo creates a new sink owned by the collector. The sink gets
+// only the records of the loggers that use the collector (see
+// Logger.UseCollector()).
+func (c *Collector) SinkTo(w io.Writer, fn Formatter, opts ...SinkOption) *Sink {
+	c.RLock()
+	for i, sink := range c.sinks {
 		if sink.writer == w {
-			collector.sinks[i].format = fn
-			collector.RUnlock()
-			return collector.sinks[i]
+			c.sinks[i].format = fn
+			c.RUnlock()
+			return c.sinks[i]
 		}
 	}
-	collector.RUnlock()
+	c.RUnlock()
 	var (
 		state = sinkStopped
 		sink  = &Sink{
-			In:              make(chan chain, 16),
+			In:              make(chan chain, DefaultBuffer),
 			close:           make(chan struct{}),
+			ringSignal:      make(chan struct{}, 1),
+			asyncSignal:     make(chan struct{}, 1),
+			flushRequest:    make(chan chan struct{}),
+			exited:          make(chan struct{}),
+			priorityLane:    make(chan chain, 16),
+			collector:       c,
 			format:          fn,
 			state:           &state,
 			writer:          w,
@@ -107,21 +250,35 @@ func SinkTo(w io.Writer, fn Formatter) *Sink {
 			hiddenKeys:      make(map[string]bool),
 		}
 	)
-	collector.Lock()
-	sink.id = uint(collector.count)
-	collector.sinks = append(collector.sinks, sink)
-	collector.count++
-	collector.Unlock()
+	for _, opt := range opts {
+		opt(sink)
+	}
+	c.Lock()
+	sink.id = c.nextID
+	c.sinks = append(c.sinks, sink)
+	c.nextID++
+	c.Unlock()
 	go processSink(sink)
 	return sink
 }
 
+// SinkToNull creates a sink that accepts records and checks them with
+// the filters as any other sink but never formats and writes them.
+// Unlike a sink that writes to ioutil.Discard it not spends time for
+// encoding of the records. It useful for benchmarks and for the
+// configurations where the logging is disabled. There is only one
+// null sink so subsequent calls return the same sink.
+func SinkToNull() *Sink {
+	return SinkTo(nil, nil)
+}
+
 // HasKey sets restriction for records output.
 // Only the records WITH any of the keys will be passed to output.
 func (s *Sink) HasKey(keys ...string) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
 		for _, key := range keys {
+			key = s.foldKey(key)
 			s.positiveFilters[key] = &keyFilter{}
 			delete(s.negativeFilters, key)
 		}
@@ -136,6 +293,7 @@ func (s *Sink) HasNotKey(keys ...string) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
 		for _, key := range keys {
+			key = s.foldKey(key)
 			s.negativeFilters[key] = &keyFilter{}
 			delete(s.positiveFilters, key)
 		}
@@ -152,7 +310,8 @@ func (s *Sink) HasValue(key string, vals ...string) *Sink {
 	}
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
-		s.positiveFilters[key] = &valsFilter{Vals: vals}
+		key = s.foldKey(key)
+		s.positiveFilters[key] = &valsFilter{Vals: vals, Fold: s.foldVals}
 		delete(s.negativeFilters, key)
 		s.Unlock()
 	}
@@ -166,7 +325,8 @@ func (s *Sink) HasNotValue(key string, vals ...string) *Sink {
 	}
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
-		s.negativeFilters[key] = &valsFilter{Vals: vals}
+		key = s.foldKey(key)
+		s.negativeFilters[key] = &valsFilter{Vals: vals, Fold: s.foldVals}
 		delete(s.positiveFilters, key)
 		s.Unlock()
 	}
@@ -177,6 +337,7 @@ func (s *Sink) HasNotValue(key string, vals ...string) *Sink {
 func (s *Sink) Int64Range(key string, from, to int64) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
+		key = s.foldKey(key)
 		delete(s.negativeFilters, key)
 		s.positiveFilters[key] = &int64RangeFilter{From: from, To: to}
 		s.Unlock()
@@ -188,6 +349,7 @@ func (s *Sink) Int64Range(key string, from, to int64) *Sink {
 func (s *Sink) Int64NotRange(key string, from, to int64) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
+		key = s.foldKey(key)
 		delete(s.positiveFilters, key)
 		s.negativeFilters[key] = &int64RangeFilter{From: from, To: to}
 		s.Unlock()
@@ -199,6 +361,7 @@ func (s *Sink) Int64NotRange(key string, from, to int64) *Sink {
 func (s *Sink) Float64Range(key string, from, to float64) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
+		key = s.foldKey(key)
 		delete(s.negativeFilters, key)
 		s.positiveFilters[key] = &float64RangeFilter{From: from, To: to}
 		s.Unlock()
@@ -210,6 +373,7 @@ func (s *Sink) Float64Range(key string, from, to float64) *Sink {
 func (s *Sink) Float64NotRange(key string, from, to float64) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
+		key = s.foldKey(key)
 		delete(s.positiveFilters, key)
 		s.negativeFilters[key] = &float64RangeFilter{From: from, To: to}
 		s.Unlock()
@@ -221,6 +385,7 @@ func (s *Sink) Float64NotRange(key string, from, to float64) *Sink {
 func (s *Sink) TimeRange(key string, from, to time.Time) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
+		key = s.foldKey(key)
 		delete(s.negativeFilters, key)
 		s.positiveFilters[key] = &timeRangeFilter{From: from, To: to}
 		s.Unlock()
@@ -232,6 +397,7 @@ func (s *Sink) TimeRange(key string, from, to time.Time) *Sink {
 func (s *Sink) TimeNotRange(key string, from, to time.Time) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
+		key = s.foldKey(key)
 		delete(s.positiveFilters, key)
 		s.negativeFilters[key] = &timeRangeFilter{From: from, To: to}
 		s.Unlock()
@@ -239,12 +405,50 @@ func (s *Sink) TimeNotRange(key string, from, to time.Time) *Sink {
 	return s
 }
 
+// WithRegexp sets restriction for records output. A record passed to
+// output if the value of the key matches the regular expression. The
+// pattern is compiled once, the invalid pattern causes panic.
+func (s *Sink) WithRegexp(key, pattern string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		key = s.foldKey(key)
+		delete(s.negativeFilters, key)
+		s.positiveFilters[key] = s.regexpFilter(pattern)
+		s.Unlock()
+	}
+	return s
+}
+
+// WithoutRegexp sets restriction for records output. A record passed
+// to output if the value of the key does not match the regular
+// expression. The invalid pattern causes panic.
+func (s *Sink) WithoutRegexp(key, pattern string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		key = s.foldKey(key)
+		delete(s.positiveFilters, key)
+		s.negativeFilters[key] = s.regexpFilter(pattern)
+		s.Unlock()
+	}
+	return s
+}
+
+// regexpFilter compiles the pattern case insensitive when
+// IgnoreValuesCase() set.
+func (s *Sink) regexpFilter(pattern string) *regexpFilter {
+	if s.foldVals {
+		pattern = "(?i)" + pattern
+	}
+	return &regexpFilter{regexp.MustCompile(pattern)}
+}
+
 // WithFilter setup custom filtering function for values for a specific key.
 // Custom filter should realize Filter interface. All custom filters treated
 // as positive filters. So if the filter returns true then it will be passed.
 func (s *Sink) WithFilter(key string, customFilter Filter) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
+		key = s.foldKey(key)
 		delete(s.negativeFilters, key)
 		s.positiveFilters[key] = customFilter
 		s.Unlock()
@@ -252,11 +456,98 @@ func (s *Sink) WithFilter(key string, customFilter Filter) *Sink {
 	return s
 }
 
+// IgnoreKeysCase makes the keys of the filters case insensitive. So
+// the filter set for the key "level" will check the pairs with keys
+// "Level" and "LEVEL" too. It applies to the filters already set and
+// to the filters that will be set later.
+func (s *Sink) IgnoreKeysCase() *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.foldKeys = true
+		s.positiveFilters = foldFilters(s.positiveFilters)
+		s.negativeFilters = foldFilters(s.negativeFilters)
+		s.Unlock()
+	}
+	return s
+}
+
+// IgnoreValuesCase makes HasValue() and HasNotValue() filters compare
+// the values case insensitive. Range filters and custom filters are
+// not affected.
+func (s *Sink) IgnoreValuesCase() *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.foldVals = true
+		for _, filters := range []map[string]Filter{s.positiveFilters, s.negativeFilters} {
+			for _, f := range filters {
+				if f, ok := f.(*valsFilter); ok {
+					f.Fold = true
+				}
+			}
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+func (s *Sink) foldKey(key string) string {
+	if s.foldKeys {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+func foldFilters(filters map[string]Filter) map[string]Filter {
+	var folded = make(map[string]Filter, len(filters))
+	for key, f := range filters {
+		folded[strings.ToLower(key)] = f
+	}
+	return folded
+}
+
+// FloatFormat overrides the global FloatFormat and FloatPrecision for
+// the sink. The float values reformatted with the format ('e', 'f',
+// 'g' etc.) and the precision as they passed to
+// strconv.FormatFloat(). So a sink for humans could display 3.1415
+// while a sink for machines keeps full precision.
+func (s *Sink) FloatFormat(format byte, precision int) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.floatFormat = format
+		s.floatPrecision = precision
+		s.Unlock()
+	}
+	return s
+}
+
+// RenderBool sets how the boolean values are displayed by the sink,
+// for example as "yes"/"no" or "1"/"0" instead of "true"/"false".
+func (s *Sink) RenderBool(trueVal, falseVal string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.boolStrings = []string{trueVal, falseVal}
+		s.Unlock()
+	}
+	return s
+}
+
+// RenderNil sets how the nil values are displayed by the sink, for
+// example as "null" or "-" instead of the default "<nil>".
+func (s *Sink) RenderNil(nilVal string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.nilString = &nilVal
+		s.Unlock()
+	}
+	return s
+}
+
 // Reset all filters for the keys for the output.
 func (s *Sink) Reset(keys ...string) *Sink {
 	if atomic.LoadInt32(s.state) > sinkClosed {
 		s.Lock()
 		for _, key := range keys {
+			key = s.foldKey(key)
 			delete(s.positiveFilters, key)
 			delete(s.negativeFilters, key)
 		}
@@ -290,9 +581,175 @@ func (s *Sink) Unhide(keys ...string) *Sink {
 	return s
 }
 
+// Alias renames the keys in the output of the sink. The map keys are
+// the original keys and the values are the new names:
+//
+//	sink.Alias(map[string]string{"lineno": "line", "function": "caller"})
+//
+// The filters and Hide() still operate with the original keys. The
+// alias with empty name removes the renaming for the key.
+func (s *Sink) Alias(aliases map[string]string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if s.aliases == nil {
+			s.aliases = make(map[string]string, len(aliases))
+		}
+		for key, alias := range aliases {
+			if alias == "" {
+				delete(s.aliases, key)
+				continue
+			}
+			s.aliases[key] = alias
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// RenameKey renames the key in the output of the sink. It is the
+// same as Alias() for the single key. Empty name removes the renaming.
+func (s *Sink) RenameKey(key, name string) *Sink {
+	return s.Alias(map[string]string{key: name})
+}
+
+// TransformKeys sets the function that renames the keys in the output
+// of the sink. So the sinks may name the same keys differently:
+//
+//	elastic.TransformKeys(func(key string) string {
+//		switch key {
+//		case "msg":
+//			return "message"
+//		case "ts":
+//			return "@timestamp"
+//		}
+//		return key
+//	})
+//
+// The keys renamed by Alias() or RenameKey() are not passed to the
+// function. The filters and Hide() still operate with the original
+// keys. Nil function removes the transformation.
+func (s *Sink) TransformKeys(fn func(key string) string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.transformKeys = fn
+		s.Unlock()
+	}
+	return s
+}
+
+// Only restricts the output of the sink to the listed keys. Other
+// pairs of the record are not displayed (or gathered under the key
+// set by CatchAll()). It complements Hide() and useful for terse
+// outputs like a console. Call without keys removes the restriction.
+func (s *Sink) Only(keys ...string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		if len(keys) == 0 {
+			s.onlyKeys = nil
+		} else {
+			s.onlyKeys = make(map[string]bool, len(keys))
+			for _, key := range keys {
+				s.onlyKeys[key] = true
+			}
+		}
+		s.Unlock()
+	}
+	return s
+}
+
+// CatchAll sets the key under which the pairs that not listed in
+// Only() gathered as a single string value "key=val key2=val2". By
+// default such pairs are dropped. Empty key restores the default.
+func (s *Sink) CatchAll(key string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.catchAllKey = key
+		s.Unlock()
+	}
+	return s
+}
+
+// Terminator sets the string that ends each record in the output of
+// the sink instead of the newline added by the formatters. For
+// example "\r\n" or "\x00" for the consumers like `xargs -0`.
+func (s *Sink) Terminator(term string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.terminator = []byte(term)
+		s.Unlock()
+	}
+	return s
+}
+
+// UseRingBuffer switches the sink from the channel to the ring buffer
+// for passing the records from the loggers. The ring buffer allows
+// many loggers to add the records without locks and the sink takes
+// them by batches. It lowers the overhead per record at very high
+// log rates. The size is rounded up to the power of two. It should
+// be called before Start().
+func (s *Sink) UseRingBuffer(size int) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.ring.Store(newRingBuffer(size, s.ringSignal))
+	}
+	return s
+}
+
+// Priority sets the rule for the records that should be delivered
+// ahead of the others. The records where the key has one of the
+// values bypass the regular queue of the sink so they written even
+// when the queue is saturated by less important records:
+//
+//	sink.Priority("level", "error", "critical", "fatal")
+//
+// Call without values removes the rule.
+func (s *Sink) Priority(key string, vals ...string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		if len(vals) == 0 {
+			s.priority.Store((*priorityRule)(nil))
+		} else {
+			s.priority.Store(&priorityRule{key: key, vals: valsFilter{Vals: vals}})
+		}
+	}
+	return s
+}
+
+// match reports whether the record should go through the priority
+// lane.
+func (r *priorityRule) match(record []*Pair) bool {
+	for _, pair := range record {
+		if pair.Key == r.key && r.vals.Check(pair.Key, pair.Val) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns the counters of the sink.
+func (s *Sink) Stats() SinkStats {
+	var stats = SinkStats{
+		Dropped:       atomic.LoadUint64(&s.stats.dropped),
+		Sampled:       atomic.LoadUint64(&s.stats.sampled),
+		Shed:          atomic.LoadUint64(&s.stats.shed),
+		Failed:        atomic.LoadUint64(&s.stats.failed),
+		Invalid:       atomic.LoadUint64(&s.stats.invalid),
+		Guarded:       atomic.LoadUint64(&s.stats.guarded),
+		Filtered:      atomic.LoadUint64(&s.stats.filtered),
+		Deduplicated:  atomic.LoadUint64(&s.stats.deduplicated),
+		Written:       atomic.LoadUint64(&s.stats.written),
+		WriteLatency:  s.stats.latency.snapshot(),
+		SamplingRatio: s.samplingRatio(),
+		QueueFill:     s.queueFill(),
+	}
+	stats.QueueDepth, stats.QueueCapacity = s.queueDepth()
+	stats.QueueHighWater = int(atomic.LoadInt64(&s.stats.highWater))
+	return stats
+}
+
 // Stop stops writing to the output.
 func (s *Sink) Stop() *Sink {
-	atomic.StoreInt32(s.state, sinkStopped)
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		atomic.StoreInt32(s.state, sinkStopped)
+	}
 	return s
 }
 
@@ -300,59 +757,78 @@ func (s *Sink) Stop() *Sink {
 // After creation of a new sink it will paused and you need explicitly start it.
 // It allows setup the filters before the sink will accepts any records.
 func (s *Sink) Start() *Sink {
-	atomic.StoreInt32(s.state, sinkActive)
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		atomic.StoreInt32(s.state, sinkActive)
+	}
 	return s
 }
 
-// Close closes the sink. It flushes records for the sink before closing.
+// Close closes the sink. It flushes records for the sink before
+// closing. It waits no longer than three seconds (see WaitClose()).
 func (s *Sink) Close() {
-	return
-	if atomic.LoadInt32(s.state) > sinkClosed {
-		atomic.StoreInt32(s.state, sinkClosed)
-		s.close <- struct{}{}
-		collector.Lock()
-		collector.count--
-		collector.sinks = append(collector.sinks[0:s.id], collector.sinks[s.id+1:]...)
-		collector.Unlock()
+	var ctx, cancel = stdcontext.WithTimeout(stdcontext.Background(), flushTimeout)
+	s.WaitClose(ctx)
+	cancel()
+}
+
+// WaitClose removes the sink from its collector so it gets no more
+// records, writes the records queued by the sink (see Flush()) and
+// waits until the goroutine of the sink exited. The context limits
+// the time of waiting, the sink is closed anyway. It returns the
+// error of the context if the sink not finished in time. The closed
+// sink could not be started again.
+func (s *Sink) WaitClose(ctx stdcontext.Context) error {
+	if !s.collector.remove(s) {
+		// Already closed by Close() or CloseAll().
+		return nil
 	}
+	var err = s.flushWithin(ctx)
+	s.shutdown()
+	select {
+	case <-s.exited:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown marks the sink closed and stops its goroutine.
+func (s *Sink) shutdown() {
+	s.stopHeartbeat()
+	atomic.StoreInt32(s.state, sinkClosed)
+	close(s.close)
 }
 
 func processSink(s *Sink) {
+	defer close(s.exited)
 	var (
 		record chain
+		batch  = make([]chain, 0, ringBatchSize)
 		ok     bool
 	)
 	for {
 		select {
+		case record = <-s.priorityLane:
+			s.processRecord(record)
 		case record, ok = <-s.In:
 			if !ok {
 				return
 			}
-			if atomic.LoadInt32(s.state) < sinkActive {
-				record.wg.Done()
-				continue
+			s.processPriority()
+			s.processRecord(record)
+		case <-s.ringSignal:
+			batch = s.drainRing(batch)
+		case done := <-s.flushRequest:
+			batch = s.flush(batch)
+			close(done)
+		case <-s.asyncSignal:
+			if q, _ := s.async.Load().(*asyncQueue); q != nil {
+				s.drainAsync(q)
 			}
-			s.RLock()
-			var filter Filter
-			for _, pair := range record.pairs {
-				// Negative conditions have highest priority
-				if filter, ok = s.negativeFilters[pair.Key]; ok {
-					if filter.Check(pair.Key, pair.Val) {
-						goto skipRecord
-					}
-				}
-				// At last check for positive conditions
-				if filter, ok = s.positiveFilters[pair.Key]; ok {
-					if !filter.Check(pair.Key, pair.Val) {
-						goto skipRecord
-					}
-				}
-			}
-			s.formatRecord(record.pairs)
-		skipRecord:
-			s.RUnlock()
-			record.wg.Done()
 		case <-s.close:
+			// Release the records queued while the sink was
+			// closing, they are not written.
+			s.flush(batch)
 			s.Lock()
 			s.positiveFilters = nil
 			s.negativeFilters = nil
@@ -363,38 +839,264 @@ func processSink(s *Sink) {
 	}
 }
 
+// drainRing processes the records of the ring by batches until it is
+// empty.
+func (s *Sink) drainRing(batch []chain) []chain {
+	var ring, _ = s.ring.Load().(*ringBuffer)
+	if ring == nil {
+		return batch
+	}
+	for {
+		batch = ring.popBatch(batch[:0])
+		if len(batch) == 0 {
+			return batch
+		}
+		for i := range batch {
+			s.processPriority()
+			s.processRecord(batch[i])
+			batch[i] = chain{}
+		}
+	}
+}
+
+// processPriority processes the records waiting in the priority lane.
+func (s *Sink) processPriority() {
+	for {
+		select {
+		case record := <-s.priorityLane:
+			s.processRecord(record)
+		default:
+			return
+		}
+	}
+}
+
+// processRecord checks the record with the filters and writes it to
+// the output if the checks passed.
+func (s *Sink) processRecord(record chain) {
+	if record.async {
+		defer record.rec.release()
+	} else {
+		defer record.rec.processed()
+	}
+	if s.release(record.size) || atomic.LoadInt32(s.state) < sinkActive {
+		return
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if record.heartbeat {
+		if s.writer != nil {
+			var pairs, _ = expandPairs(record.rec.pairs)
+			s.formatRecord(pairs)
+		}
+		return
+	}
+	if s.filteredByKeys(record.rec.pairs) {
+		return
+	}
+	// The generators of the pairs called only for the records that
+	// passed the filters of other pairs.
+	var pairs, expanded = expandPairs(record.rec.pairs)
+	if expanded && s.filteredByKeys(pairs) {
+		return
+	}
+	for _, filter := range s.recordFilters {
+		if !filter.CheckRecord(pairs) {
+			atomic.AddUint64(&s.stats.filtered, 1)
+			return
+		}
+	}
+	if !s.sampleFixed() || !s.limitByKeys(pairs) {
+		return
+	}
+	if s.dedup != nil {
+		var suppressed, summary = s.dedup.suppress(pairs, s.collector.now())
+		if summary != nil && s.writer != nil {
+			s.formatRecord(summary)
+		}
+		if suppressed {
+			atomic.AddUint64(&s.stats.deduplicated, 1)
+			return
+		}
+	}
+	if s.guard != nil {
+		if pairs = s.guarded(pairs); pairs == nil {
+			return
+		}
+	}
+	// The null sink has no writer so the formatting skipped.
+	if s.writer != nil {
+		s.formatRecord(pairs)
+	}
+}
+
+// filteredByKeys checks the pairs of the record by the filters of
+// the keys and counts the filtered record.
+func (s *Sink) filteredByKeys(record []*Pair) bool {
+	for _, pair := range record {
+		var key = s.foldKey(pair.Key)
+		// Negative conditions have highest priority
+		if filter, ok := s.negativeFilters[key]; ok {
+			if val, _ := pair.value(); filter.Check(pair.Key, val) {
+				atomic.AddUint64(&s.stats.filtered, 1)
+				return true
+			}
+		}
+		// At last check for positive conditions
+		if filter, ok := s.positiveFilters[key]; ok {
+			if val, _ := pair.value(); !filter.Check(pair.Key, val) {
+				atomic.AddUint64(&s.stats.filtered, 1)
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (s *Sink) formatRecord(record []*Pair) {
+	var rest []string
+	if s.schema != nil {
+		var valid bool
+		if record, valid = s.schema.apply(record); !valid {
+			atomic.AddUint64(&s.stats.invalid, 1)
+		}
+	}
+	if s.keyOrder != nil {
+		record = s.keyOrder.apply(record)
+	}
+	var typed, _ = s.format.(TypedFormatter)
+	// The typed formatters get the objects as json.RawMessage.
+	var objects, _ = s.format.(ObjectFormatter)
+	var formatsObjects = typed != nil || objects != nil && objects.FormatsObjects()
 	s.format.Begin()
 	for _, pair := range record {
 		if ok := s.hiddenKeys[pair.Key]; ok {
 			continue
 		}
-		s.format.Pair(pair.Key, pair.Val, pair.Type)
+		var val, valType = pair.value()
+		if valType == ObjectVal && !formatsObjects {
+			val, valType = pair.textValue()
+		}
+		if m, ok := pair.Eval.(measure); ok {
+			val, valType = s.rendered(m, val, valType)
+		}
+		if s.maskedKeys != nil || s.redactors != nil {
+			val, valType = s.redacted(pair.Key, val, valType)
+		}
+		if s.onlyKeys != nil && !s.onlyKeys[pair.Key] {
+			if s.catchAllKey != "" {
+				rest = append(rest, catchAllPair(pair.Key, val))
+			}
+			continue
+		}
+		switch {
+		case s.floatFormat != 0 && valType == FloatVal:
+			if f, err := strconv.ParseFloat(val, 64); err == nil {
+				val = strconv.FormatFloat(f, s.floatFormat, s.floatPrecision, 64)
+			}
+		case s.boolStrings != nil && valType == BooleanVal:
+			if val == "true" {
+				val = s.boolStrings[0]
+			} else {
+				val = s.boolStrings[1]
+			}
+			valType = renderedType(val, valType)
+		case s.nilString != nil && valType == VoidVal:
+			val = *s.nilString
+			valType = renderedType(val, valType)
+		}
+		var key = pair.Key
+		if alias, ok := s.aliases[key]; ok {
+			key = alias
+		} else if s.transformKeys != nil {
+			key = s.transformKeys(key)
+		}
+		if typed != nil {
+			typed.TypedPair(key, TypedValue(val, valType), valType)
+			continue
+		}
+		s.format.Pair(key, val, valType)
 	}
-	s.writer.Write(s.format.Finish())
+	if len(rest) > 0 {
+		if typed != nil {
+			typed.TypedPair(s.catchAllKey, strings.Join(rest, " "), StringVal)
+		} else {
+			s.format.Pair(s.catchAllKey, strings.Join(rest, " "), StringVal)
+		}
+	}
+	var line = s.format.Finish()
+	if s.terminator != nil && len(line) > 0 && line[len(line)-1] == '\n' {
+		line = append(line[:len(line)-1], s.terminator...)
+	}
+	s.write(line)
+}
+
+// catchAllPair formats the pair for gathering under CatchAll() key.
+func catchAllPair(key, val string) string {
+	if val == "" || strings.ContainsAny(val, " \t\r\n=\"") {
+		return key + "=" + strconv.Quote(val)
+	}
+	return key + "=" + val
+}
+
+// renderedType returns the kind for the value rendered by
+// RenderBool() and RenderNil() so the formatters still could output
+// it correctly. The kind is kept for the values "true", "false" and
+// "null", the numbers are integers and all others are strings.
+func renderedType(val string, valType int) int {
+	switch val {
+	case "true", "false":
+		if valType == BooleanVal {
+			return valType
+		}
+	case "null":
+		if valType == VoidVal {
+			return valType
+		}
+	}
+	if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return IntegerVal
+	}
+	return StringVal
 }
 
 const flushTimeout = 3 * time.Second
 
-func sinkRecord(rec []*Pair) {
-	var wg sync.WaitGroup
-	collector.RLock()
-	for _, s := range collector.sinks {
+// sinkRecord passes the record to the active sinks of the collector.
+func (c *Collector) sinkRecord(rec *record) {
+	var size int64
+	if atomic.LoadInt64(&budget.limit) > 0 {
+		size = recordSize(rec.pairs)
+	}
+	countRecord(rec.pairs)
+	c.RLock()
+	for _, s := range c.sinks {
 		if atomic.LoadInt32(s.state) == sinkActive {
-			wg.Add(1)
-			s.In <- chain{&wg, rec}
+			if s.shed(rec.pairs) || !s.sample(rec.pairs) || !s.admit(rec.pairs, size) {
+				continue
+			}
+			s.markHighWater()
+			var priority bool
+			if rule, _ := s.priority.Load().(*priorityRule); rule != nil && rule.match(rec.pairs) {
+				priority = true
+			} else if q, _ := s.async.Load().(*asyncQueue); q != nil {
+				rec.retain()
+				s.enqueue(q, chain{rec: rec, size: size, async: true})
+				continue
+			}
+			rec.hold()
+			var next = chain{rec: rec, size: size}
+			if priority {
+				s.priorityLane <- next
+				continue
+			}
+			if ring, _ := s.ring.Load().(*ringBuffer); ring != nil {
+				ring.push(next)
+				continue
+			}
+			s.In <- next
 		}
 	}
-	collector.RUnlock()
-	var c = make(chan struct{})
-	go func() {
-		defer close(c)
-		wg.Wait()
-	}()
-	select {
-	case <-c:
-		return
-	case <-time.After(flushTimeout):
-		return
-	}
+	c.RUnlock()
+	rec.wait(flushTimeout)
 }
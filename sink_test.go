@@ -41,12 +41,41 @@ These parts separated by empty lines in each test function.
 */
 
 import (
+	"bufio"
 	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
 
+// Test of log to the null sink.
+func TestSink_LogToNullSink(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := New()
+	null := SinkToNull().Start()
+	out := SinkTo(stream, AsLogfmt()).Start()
+	defer out.Close()
+
+	log.Log("key", "value")
+
+	out.Flush()
+	if null != SinkToNull() {
+		t.Log("null sink should be single")
+		t.Fail()
+	}
+	if strings.TrimSpace(stream.String()) != `key="value"` {
+		t.Logf("expected key=\"value\" got %s", stream.String())
+		t.Fail()
+	}
+}
+
 // Test of log to the stopped sink.
 func TestSink_LogToStoppedSink_Logfmt(t *testing.T) {
 	stream := bytes.NewBufferString("")
@@ -162,7 +191,7 @@ func TestSink_UnhideKeyTwice(t *testing.T) {
 func TestSink_WithKeyFilterPass(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithKey("Gandalf").Start()
+	out := SinkTo(stream, AsLogfmt()).HasKey("Gandalf").Start()
 
 	log.Log("Gandalf", "You shall not pass!") // cite from the movie
 
@@ -178,7 +207,7 @@ func TestSink_WithKeyFilterPass(t *testing.T) {
 func TestSink_WithoutKeyFilterOut(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithoutKey("Gandalf").Start()
+	out := SinkTo(stream, AsLogfmt()).HasNotKey("Gandalf").Start()
 
 	log.Log("Gandalf", "You cannot pass!") // cite from the book
 
@@ -193,7 +222,7 @@ func TestSink_WithoutKeyFilterOut(t *testing.T) {
 func TestSink_WithValueFilterMissedKeyPass(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithValue("key", "passed").Start()
+	out := SinkTo(stream, AsLogfmt()).HasValue("key", "passed").Start()
 
 	log.Log("key", "passed")
 
@@ -209,7 +238,7 @@ func TestSink_WithValueFilterMissedKeyPass(t *testing.T) {
 func TestSink_WithValueFilterPass(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithValue("key", "passed", "and this passed too").Start()
+	out := SinkTo(stream, AsLogfmt()).HasValue("key", "passed", "and this passed too").Start()
 
 	log.Log("key", "passed", "key", "and this passed too")
 
@@ -224,7 +253,7 @@ func TestSink_WithValueFilterPass(t *testing.T) {
 func TestSink_WithValueFilterOut(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithValue("key", "filtered", "out").Start()
+	out := SinkTo(stream, AsLogfmt()).HasValue("key", "filtered", "out").Start()
 
 	log.Log("key", "try it")
 
@@ -239,7 +268,7 @@ func TestSink_WithValueFilterOut(t *testing.T) {
 func TestSink_WithIntRangeFilterMissedKeyPass(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithInt64Range("key", 1, 2).Start()
+	out := SinkTo(stream, AsLogfmt()).Int64Range("key", 1, 2).Start()
 
 	log.Log("another key", 3)
 
@@ -254,7 +283,7 @@ func TestSink_WithIntRangeFilterMissedKeyPass(t *testing.T) {
 func TestSink_WithIntRangeFilterPass(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithInt64Range("key", 1, 3).Start()
+	out := SinkTo(stream, AsLogfmt()).Int64Range("key", 1, 3).Start()
 
 	log.Log("key", 2)
 
@@ -269,7 +298,7 @@ func TestSink_WithIntRangeFilterPass(t *testing.T) {
 func TestSink_WithIntRangeFilterFilterOut(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithInt64Range("key", 1, 3).Start()
+	out := SinkTo(stream, AsLogfmt()).Int64Range("key", 1, 3).Start()
 
 	log.Log("key", 4)
 
@@ -284,7 +313,7 @@ func TestSink_WithIntRangeFilterFilterOut(t *testing.T) {
 func TestSink_WithFloatRangeFilterMissedKeyPass(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithFloat64Range("key", 1.0, 2.0).Start()
+	out := SinkTo(stream, AsLogfmt()).Float64Range("key", 1.0, 2.0).Start()
 
 	log.Log("another key", 3)
 
@@ -299,7 +328,7 @@ func TestSink_WithFloatRangeFilterMissedKeyPass(t *testing.T) {
 func TestSink_WithFloatRangeFilterPass(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithFloat64Range("key", 1.0, 3.0).Start()
+	out := SinkTo(stream, AsLogfmt()).Float64Range("key", 1.0, 3.0).Start()
 
 	log.Log("key", 2.0)
 
@@ -314,7 +343,7 @@ func TestSink_WithFloatRangeFilterPass(t *testing.T) {
 func TestSink_WithFloatRangeFilterOut(t *testing.T) {
 	stream := bytes.NewBufferString("")
 	log := New()
-	out := SinkTo(stream, AsLogfmt()).WithFloat64Range("key", 1.0, 3.0).Start()
+	out := SinkTo(stream, AsLogfmt()).Float64Range("key", 1.0, 3.0).Start()
 
 	log.Log("key", 4.0)
 
@@ -333,7 +362,7 @@ func TestSink_WithTimeRangeFilterPass(t *testing.T) {
 	hourAfterNow := now.Add(1 * time.Hour)
 	halfHourAfterNow := now.Add(30 * time.Minute)
 	halfHourAsString := halfHourAfterNow.Format(TimeLayout)
-	out := SinkTo(stream, AsLogfmt()).WithTimeRange("key", now, hourAfterNow).Start()
+	out := SinkTo(stream, AsLogfmt()).TimeRange("key", now, hourAfterNow).Start()
 
 	log.Log("key", halfHourAfterNow)
 
@@ -351,7 +380,7 @@ func TestSink_WithTimeRangeFilterOut(t *testing.T) {
 	now := time.Now()
 	hourAfterNow := now.Add(1 * time.Hour)
 	halfHourAfterNow := now.Add(30 * time.Minute)
-	out := SinkTo(stream, AsLogfmt()).WithTimeRange("key", now, halfHourAfterNow).Start()
+	out := SinkTo(stream, AsLogfmt()).TimeRange("key", now, halfHourAfterNow).Start()
 
 	log.Log("key", hourAfterNow)
 
@@ -421,3 +450,736 @@ func TestSink_WithCustomFilterOut(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Test of case insensitive keys and values of the filters.
+func TestSink_IgnoreCaseFilterPass(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(stream, AsLogfmt()).HasValue("level", "error").IgnoreKeysCase().IgnoreValuesCase().Start()
+	defer out.Close()
+
+	log.Log("Level", "ERROR")
+	log.Log("LEVEL", "info")
+
+	out.Flush()
+	if strings.TrimSpace(stream.String()) != `Level="ERROR"` {
+		t.Logf("unexpected output %s", stream.String())
+		t.Fail()
+	}
+}
+
+// Test of the float format set for the sink.
+func TestSink_FloatFormat(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(stream, AsLogfmt()).FloatFormat('f', 2).Start()
+	defer out.Close()
+
+	log.Log("pi", 3.14159265)
+
+	out.Flush()
+	if strings.TrimSpace(stream.String()) != `pi=3.14` {
+		t.Logf("unexpected output %s", stream.String())
+		t.Fail()
+	}
+}
+
+// Test of custom rendering of booleans and nils for the sink.
+func TestSink_RenderBoolAndNil(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(stream, AsJSON()).RenderBool("1", "0").RenderNil("null").Start()
+	defer out.Close()
+
+	log.Log("a", true, "b", false, "c", nil)
+
+	out.Flush()
+	if strings.TrimSpace(stream.String()) != `{"a":1, "b":0, "c":null}` {
+		t.Logf("unexpected output %s", stream.String())
+		t.Fail()
+	}
+}
+
+// Test of renaming the keys in the output.
+func TestSink_Alias(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(stream, AsLogfmt()).Alias(map[string]string{"lineno": "line", "function": "caller"}).Hide("function").Start()
+	defer out.Close()
+
+	log.Log("lineno", 12, "function", "main", "k", "v")
+
+	out.Flush()
+	if strings.TrimSpace(stream.String()) != `line=12 k="v"` {
+		t.Logf("unexpected output %s", stream.String())
+		t.Fail()
+	}
+}
+
+// Test of the output restricted to the listed keys.
+func TestSink_Only(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	stream2 := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(stream, AsLogfmt()).Only("level", "msg").Start()
+	defer out.Close()
+	out2 := SinkTo(stream2, AsLogfmt()).Only("level", "msg").CatchAll("rest").Start()
+	defer out2.Close()
+
+	log.Log("level", "info", "user", "gandalf", "msg", "hello", "note", "you shall pass")
+
+	out.Flush()
+	if strings.TrimSpace(stream.String()) != `level="info" msg="hello"` {
+		t.Logf("unexpected output %s", stream.String())
+		t.Fail()
+	}
+	if strings.TrimSpace(stream2.String()) != `level="info" msg="hello" rest="user=gandalf note=\"you shall pass\""` {
+		t.Logf("unexpected output %s", stream2.String())
+		t.Fail()
+	}
+}
+
+// Test of the custom terminator of the records.
+func TestSink_Terminator(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(stream, AsLogfmt().Strict()).Terminator("\x00").Start()
+	defer out.Close()
+
+	log.Log("k", 1)
+	log.Log("k", 2)
+
+	out.Flush()
+	if stream.String() != "k=1\x00k=2\x00" {
+		t.Logf("unexpected output %q", stream.String())
+		t.Fail()
+	}
+}
+
+// Test of the sink that uses the ring buffer instead of the channel.
+func TestSink_UseRingBuffer(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	out := SinkTo(stream, AsLogfmt()).HasKey("ring-test").UseRingBuffer(4).Start()
+	defer out.Close()
+	var wg sync.WaitGroup
+
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			log := New()
+			for i := 0; i < 50; i++ {
+				log.Log("ring-test", i)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	out.Flush()
+	if lines := strings.Count(stream.String(), "\n"); lines != 200 {
+		t.Logf("expected 200 records got %d", lines)
+		t.Fail()
+	}
+}
+
+// Test that the records from the priority lane are written.
+func TestSink_Priority(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(stream, AsLogfmt()).HasKey("priority-test").Priority("level", "error").Start()
+	defer out.Close()
+
+	log.Log("priority-test", 1, "level", "debug")
+	log.Log("priority-test", 2, "level", "error")
+
+	out.Flush()
+	if strings.TrimSpace(stream.String()) != "priority-test=1 level=\"debug\" \npriority-test=2 level=\"error\"" {
+		t.Logf("unexpected output %s", stream.String())
+		t.Fail()
+	}
+}
+
+// Test of the single record shared by the several sinks.
+func TestSink_SharedRecordFanOut(t *testing.T) {
+	var (
+		out1 bytes.Buffer
+		out2 bytes.Buffer
+	)
+	s1 := SinkTo(&out1, AsLogfmt()).HasKey("fan-out-key").Start()
+	s2 := SinkTo(&out2, AsLogfmt()).HasKey("fan-out-key").Start()
+
+	Log("fan-out-key", "first")
+	Log("fan-out-key", "second")
+
+	s1.Close()
+	s2.Close()
+	expected := "fan-out-key=\"first\" \nfan-out-key=\"second\" \n"
+	if out1.String() != expected || out2.String() != expected {
+		t.Logf("expected %q got %q and %q", expected, out1.String(), out2.String())
+		t.Fail()
+	}
+}
+
+// wedgedWriter blocks writes until it released.
+type wedgedWriter struct {
+	release chan struct{}
+	bytes.Buffer
+}
+
+func (w *wedgedWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.Buffer.Write(p)
+}
+
+// Test the records not written in time are counted as failed.
+func TestSink_WriteTimeout(t *testing.T) {
+	output := &wedgedWriter{release: make(chan struct{})}
+	out := SinkTo(output, AsLogfmt()).HasKey("wedged-key").WriteTimeout(10 * time.Millisecond).Start()
+
+	Log("wedged-key", "first")
+	Log("wedged-key", "second")
+	wedged := out.Stats()
+	healthyWhenWedged := out.Healthy()
+	close(output.release)
+	for i := 0; i < 100 && !out.Healthy(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	Log("wedged-key", "third")
+
+	out.Close()
+	if wedged.Failed != 2 || healthyWhenWedged {
+		t.Logf("expected 2 failed records and unhealthy sink got %+v", wedged)
+		t.Fail()
+	}
+	if !out.Healthy() || !strings.Contains(output.String(), "third") {
+		t.Logf("expected healthy sink after the write returned got %q", output.String())
+		t.Fail()
+	}
+}
+
+// brokenWriter fails all writes.
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+// Test the write errors passed to the handler of the sink.
+func TestSink_OnError(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	out := SinkTo(brokenWriter{}, AsLogfmt()).HasKey("broken-key").OnError(func(err error, record []byte) {
+		mu.Lock()
+		failed = append(failed, err.Error()+": "+string(record))
+		mu.Unlock()
+	}).Start()
+
+	Log("broken-key", "lost")
+
+	out.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 1 || failed[0] != "broken pipe: broken-key=\"lost\" \n" || out.Healthy() || out.Stats().Failed != 1 {
+		t.Logf("expected the failed record passed to the handler got %q", failed)
+		t.Fail()
+	}
+}
+
+// Test of masking and redaction of the values.
+func TestSink_MaskAndRedact(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, AsLogfmt()).HasKey("redact-key").Mask("password").Redact(RedactEmails, HashKeys("user")).Start()
+
+	Log("redact-key", 1, "password", "secret", "contact", "mail bob@example.com", "user", "bob")
+
+	out.Close()
+	expected := `redact-key=1 password="***" contact="mail ***" user="81b637d8fcd2c6da" ` + "\n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of the combined record filters.
+func TestSink_WithRecordFilter(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, AsLogfmt()).HasKey("combined-key").WithRecordFilter(And(
+		Has("combined-key"),
+		Or(Is("level", "error"), Is("module", "billing")),
+		Not(Is("path", "/health")))).Start()
+
+	Log("combined-key", 1, "level", "error")
+	Log("combined-key", 2, "level", "info", "module", "billing")
+	Log("combined-key", 3, "level", "info")
+	Log("combined-key", 4, "level", "error", "path", "/health")
+
+	out.Close()
+	expected := `combined-key=1 level="error" ` + "\n" + `combined-key=2 level="info" module="billing" ` + "\n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of finding the sinks by names and closing all the sinks.
+func TestSink_NamedAndCloseAll(t *testing.T) {
+	output := bytes.NewBufferString("")
+	audit := SinkTo(output, AsLogfmt()).Named("audit").HasKey("named-key").Start()
+
+	found := GetSink("audit")
+	listed := false
+	for _, s := range Sinks() {
+		listed = listed || s == audit
+	}
+	CloseAll()
+	Log("named-key", "lost")
+
+	if found != audit || !listed || GetSink("audit") != nil || len(Sinks()) != 0 || output.Len() != 0 {
+		t.Logf("unexpected sinks after CloseAll: %v %v %d %q", found, listed, len(Sinks()), output.String())
+		t.Fail()
+	}
+}
+
+// Test the queued records and the buffered writer are flushed.
+func TestFlush_AsyncBuffered(t *testing.T) {
+	output := bytes.NewBufferString("")
+	buffered := bufio.NewWriter(output)
+	out := SinkTo(buffered, AsLogfmt()).HasKey("flush-key").Async(16, Block).Start()
+
+	for i := 0; i < 3; i++ {
+		Log("flush-key", i)
+	}
+	Flush()
+
+	out.Close()
+	expected := "flush-key=0 \nflush-key=1 \nflush-key=2 \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test the records written by batches.
+func TestSink_Batch(t *testing.T) {
+	output := new(lockedBuffer)
+	out := SinkTo(output, AsLogfmt()).HasKey("batch-key").Batch(3, 0, 20*time.Millisecond).Start()
+
+	for i := 0; i < 4; i++ {
+		Log("batch-key", i)
+	}
+	full := output.Writes()
+	for i := 0; i < 100 && output.Writes() < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	out.Close()
+	expected := "batch-key=0 \nbatch-key=1 \nbatch-key=2 \nbatch-key=3 \n"
+	if full != 1 || output.Writes() != 2 || output.String() != expected {
+		t.Logf("expected 2 writes got %d, %d: %q", full, output.Writes(), output.String())
+		t.Fail()
+	}
+}
+
+// typedFormat writes the Go types of the values.
+type typedFormat struct {
+	line []byte
+}
+
+func (f *typedFormat) Begin()                      { f.line = f.line[:0] }
+func (f *typedFormat) Pair(key, val string, _ int) { panic("Pair called for the typed formatter") }
+func (f *typedFormat) TypedPair(key string, val interface{}, valType int) {
+	f.line = append(f.line, fmt.Sprintf("%s:%T ", key, val)...)
+}
+func (f *typedFormat) Finish() []byte { return append(f.line, '\n') }
+
+// Test the typed values passed to the typed formatter.
+func TestSink_TypedFormatter(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, &typedFormat{}).HasKey("typed-key").Start()
+
+	Log("typed-key", 1, "f", 0.5, "b", true, "nil", nil, "t", time.Now(), "obj", []int{1}, "s", "x")
+
+	out.Close()
+	expected := fmt.Sprintf("typed-key:int64 f:float64 b:bool nil:<nil> t:time.Time obj:%T s:string \n", json.RawMessage(nil))
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test the repeated records suppressed and summarized.
+func TestSink_DedupWindow(t *testing.T) {
+	output := new(lockedBuffer)
+	out := SinkTo(output, AsLogfmt()).HasKey("dedup-key").DedupWindow(30*time.Millisecond, "dedup-key").Start()
+
+	for i := 0; i < 3; i++ {
+		Log("dedup-key", "refused", "n", i)
+	}
+	Log("dedup-key", "other")
+	for i := 0; i < 100 && !strings.Contains(output.String(), "repeated"); i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	out.DedupWindow(0)
+	out.Close()
+	expected := "dedup-key=\"refused\" n=0 \ndedup-key=\"other\" \ndedup-key=\"refused\" n=0 repeated=2 \n"
+	if output.String() != expected || out.Stats().Deduplicated != 2 {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test the lazy value evaluated only for the records passed the sink.
+func TestSink_LazyValue(t *testing.T) {
+	var (
+		output = bytes.NewBufferString("")
+		out    = SinkTo(output, AsLogfmt()).HasValue("lazy-key", "pass")
+		calls  int
+		lazy   = func(val string) chain {
+			return chain{rec: &record{refs: 2, pending: 2, pairs: []*Pair{
+				toPair("lazy-key", val),
+				toPair("stats", func() interface{} { calls++; return 42 }),
+			}}}
+		}
+	)
+
+	out.processRecord(lazy("pass"))
+	out.Start()
+	out.processRecord(lazy("skip"))
+	out.processRecord(lazy("pass"))
+
+	out.Close()
+	expected := "lazy-key=\"pass\" stats=42 \n"
+	if output.String() != expected || calls != 1 {
+		t.Logf("expected %q with the single call got %q with %d calls", expected, output.String(), calls)
+		t.Fail()
+	}
+}
+
+// Test the same record rendered with different keys by the sinks.
+func TestSink_RenameKeyAndTransformKeys(t *testing.T) {
+	output1 := bytes.NewBufferString("")
+	output2 := bytes.NewBufferString("")
+	out1 := SinkTo(output1, AsLogfmt()).HasKey("rename-key").RenameKey("rename-key", "msg").Start()
+	out2 := SinkTo(output2, AsLogfmt()).HasKey("rename-key").RenameKey("rename-key", "message").TransformKeys(strings.ToUpper).Start()
+
+	Log("rename-key", "hello", "ts", 1)
+
+	out1.Close()
+	out2.Close()
+	expected1 := "msg=\"hello\" ts=1 \n"
+	expected2 := "message=\"hello\" TS=1 \n"
+	if output1.String() != expected1 || output2.String() != expected2 {
+		t.Logf("expected %q and %q got %q and %q", expected1, expected2, output1.String(), output2.String())
+		t.Fail()
+	}
+}
+
+// Test the durations and the sizes rendered by the modes of the sink.
+func TestSink_DurationAndBytesFormat(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, AsLogfmt()).HasKey("measure-key").DurationFormat(DurationMillis).BytesFormat(BytesInteger).Start()
+
+	New().Add("measure-key", 1).Log("took", 1250*time.Millisecond, "size", Bytes(4404019))
+
+	out.Close()
+	expected := "measure-key=1 took=1250 size=4404019 \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
+
+// againWriter fails with EAGAIN the first writes.
+type againWriter struct {
+	bytes.Buffer
+	failures int
+}
+
+func (w *againWriter) Write(p []byte) (int, error) {
+	if w.failures > 0 {
+		w.failures--
+		return 0, syscall.EAGAIN
+	}
+	return w.Buffer.Write(p)
+}
+
+// Test the write retried after the transient errors.
+func TestSink_Retry(t *testing.T) {
+	output := &againWriter{failures: 2}
+	out := SinkTo(output, AsLogfmt()).HasKey("retry-key").Retry(3, time.Millisecond).Start()
+
+	Log("retry-key", 1)
+
+	out.Close()
+	expected := "retry-key=1 \n"
+	if output.String() != expected || out.Stats().Failed != 0 {
+		t.Logf("expected %q got %q with %d failed", expected, output.String(), out.Stats().Failed)
+		t.Fail()
+	}
+}
+
+// Test of the last records dumped by the ring sink.
+func TestSink_SinkToRing(t *testing.T) {
+	log := New()
+	ring := SinkToRing(2).HasKey("ring").Start()
+	defer ring.Close()
+	output := bytes.NewBufferString("")
+
+	log.Log("ring", 1)
+	log.Log("ring", 2)
+	log.Log("ring", 3)
+	err := ring.Dump(output)
+
+	expected := "ring=2 \nring=3 \n"
+	if err != nil || output.String() != expected {
+		t.Logf("expected %q got %q with error %v", expected, output.String(), err)
+		t.Fail()
+	}
+	if err = SinkToNull().Dump(output); err != ErrNotRing {
+		t.Logf("expected ErrNotRing got %v", err)
+		t.Fail()
+	}
+}
+
+// Test of the records isolated by the collector.
+func TestSink_Collector(t *testing.T) {
+	c := NewCollector()
+	isolated := bytes.NewBufferString("")
+	common := bytes.NewBufferString("")
+	out := c.SinkTo(isolated, AsLogfmt()).Start()
+	defer c.CloseAll()
+	defer SinkTo(common, AsLogfmt()).HasKey("isolated").Start().Close()
+	log := New().UseCollector(c)
+
+	log.Fork().Log("isolated", 1)
+	Log("isolated", 2)
+	out.Flush()
+	Flush()
+
+	if isolated.String() != "isolated=1 \n" || common.String() != "isolated=2 \n" {
+		t.Logf("expected the records split got %q and %q", isolated.String(), common.String())
+		t.Fail()
+	}
+	if len(c.Sinks()) != 1 || c.Sinks()[0] != out {
+		t.Logf("expected the single sink of the collector got %v", c.Sinks())
+		t.Fail()
+	}
+}
+
+// Test of the keys ordered by the sink.
+func TestSink_OrderKeys(t *testing.T) {
+	log := New()
+	sorted := bytes.NewBufferString("")
+	inserted := bytes.NewBufferString("")
+	defer SinkTo(sorted, AsLogfmt()).HasKey("ordered").OrderKeys(KeysSorted, "msg", "ordered").Start().Close()
+	defer SinkTo(inserted, AsLogfmt()).HasKey("ordered").OrderKeys(KeysInserted, "msg").Start().Close()
+
+	log.Log("zone", 1, "ordered", true, "app", 2, "msg", "m")
+	Flush()
+
+	if sorted.String() != "msg=\"m\" ordered=true app=2 zone=1 \n" {
+		t.Logf("unexpected sorted record %q", sorted.String())
+		t.Fail()
+	}
+	if inserted.String() != "msg=\"m\" zone=1 ordered=true app=2 \n" {
+		t.Logf("unexpected inserted record %q", inserted.String())
+		t.Fail()
+	}
+}
+
+// Test of the capacity of the sink queue and its high-water mark.
+func TestSink_Buffer(t *testing.T) {
+	log := New()
+	out := SinkTo(bytes.NewBufferString(""), AsLogfmt(), Buffer(64)).HasKey("buffered").Start()
+	defer out.Close()
+	before := out.Stats()
+
+	log.Log("buffered", 1)
+	log.Log("buffered", 2)
+	out.Flush()
+
+	after := out.Stats()
+	if before.QueueCapacity != 64 || before.QueueHighWater != 0 || after.QueueHighWater < 1 || after.QueueDepth != 0 {
+		t.Logf("unexpected queue stats %+v and %+v", before, after)
+		t.Fail()
+	}
+}
+
+// Test of the sink removed from the collector by WaitClose().
+func TestSink_WaitClose(t *testing.T) {
+	c := NewCollector()
+	log := New().UseCollector(c)
+	output := bytes.NewBufferString("")
+	first := c.SinkTo(bytes.NewBufferString(""), AsLogfmt()).Start()
+	closing := c.SinkTo(output, AsLogfmt()).Start()
+	last := c.SinkTo(bytes.NewBufferString(""), AsLogfmt()).Start()
+	defer c.CloseAll()
+
+	log.Log("k", 1)
+	err := closing.WaitClose(stdcontext.Background())
+	log.Log("k", 2)
+	closing.Close()
+
+	if err != nil || output.String() != "k=1 \n" {
+		t.Logf("expected the single record written got %q with error %v", output.String(), err)
+		t.Fail()
+	}
+	if sinks := c.Sinks(); len(sinks) != 2 || sinks[0] != first || sinks[1] != last || closing.Start().Active() {
+		t.Logf("expected the closed sink removed got %v", sinks)
+		t.Fail()
+	}
+	select {
+	case <-closing.exited:
+	default:
+		t.Logf("expected the goroutine of the sink exited")
+		t.Fail()
+	}
+}
+
+// Test the format of the auto sink selected by the output.
+func TestSink_AutoSinkFormat(t *testing.T) {
+	plain := AutoSink(bytes.NewBufferString(""))
+	os.Setenv("CLICOLOR_FORCE", "1")
+	forced := AutoSink(bytes.NewBufferString(""))
+	os.Unsetenv("CLICOLOR_FORCE")
+
+	if _, ok := plain.format.(*formatLogfmt); !ok {
+		t.Logf("expected logfmt for the buffer got %T", plain.format)
+		t.Fail()
+	}
+	if _, ok := forced.format.(*formatConsole); !ok {
+		t.Logf("expected console format when colors forced got %T", forced.format)
+		t.Fail()
+	}
+}
+
+// Test of the records violating the sink schema counted.
+func TestSink_Schema(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, AsLogfmt()).HasKey("schema-sink-key").Schema(NewSchema("v1").Require("schema-sink-key", IntegerVal)).Start()
+
+	Log("schema-sink-key", 1)
+	Log("schema-sink-key", "one")
+
+	out.Close()
+	expected := `schema="v1" schema-sink-key=1 ` + "\n" + `schema="v1" schema-sink-key="one" schema-error="schema-sink-key: unexpected kind of value" ` + "\n"
+	if output.String() != expected || out.Stats().Invalid != 1 {
+		t.Logf("expected %q got %q with %+v", expected, output.String(), out.Stats())
+		t.Fail()
+	}
+}
+
+// Test the records with new keys over the limit dropped by the guard.
+func TestSink_GuardDropsNewKeys(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, AsLogfmt()).HasKey("guard-key").Guard(2, 3, GuardDrop).Start()
+
+	Log("guard-key", 1, "a", 1)
+	Log("guard-key", 2, "b", 2)
+	Log("guard-key", 3, "a", 3)
+	Log("guard-key", 4, "a", 4, "b", 4, "c", 4)
+
+	out.Close()
+	expected := "guard-key=1 a=1 \nguard-key=3 a=3 \n"
+	if output.String() != expected || out.Stats().Guarded != 2 {
+		t.Logf("expected %q got %q with %+v", expected, output.String(), out.Stats())
+		t.Fail()
+	}
+}
+
+// lockedBuffer is the buffer safe for concurrent usage.
+type lockedBuffer struct {
+	sync.Mutex
+	buf    bytes.Buffer
+	writes int
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.writes++
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Writes() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.writes
+}
+
+func (b *lockedBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+// Test the heartbeat records written when the sink is idle.
+func TestSink_Heartbeat(t *testing.T) {
+	output := new(lockedBuffer)
+	out := SinkTo(output, AsLogfmt()).HasKey("heartbeat-test-key").Start().Heartbeat(20 * time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	out.Heartbeat(0)
+
+	out.Close()
+	if !strings.HasPrefix(output.String(), "kiwi_heartbeat=1 interval=\"20ms\" \n") {
+		t.Logf("expected heartbeat records got %q", output.String())
+		t.Fail()
+	}
+}
+
+// Test the heartbeat stopped by closing of the sink.
+func TestSink_HeartbeatStoppedByClose(t *testing.T) {
+	out := SinkTo(new(lockedBuffer), AsLogfmt()).HasKey("heartbeat-close-key").Start().Heartbeat(time.Hour)
+	beat := out.heartbeat
+
+	out.Close()
+
+	select {
+	case <-beat.stop:
+	default:
+		t.Log("expected the heartbeat stopped")
+		t.Fail()
+	}
+}
+
+// Test the loggers are not blocked by the slow asynchronous sink.
+func TestSink_AsyncDropNewest(t *testing.T) {
+	output := &wedgedWriter{release: make(chan struct{})}
+	out := SinkTo(output, AsLogfmt()).HasKey("async-key").Async(2, DropNewest).Start()
+	start := time.Now()
+
+	for i := 0; i < 5; i++ {
+		Log("async-key", i)
+	}
+	elapsed := time.Since(start)
+	dropped := out.Stats().Dropped
+	close(output.release)
+
+	out.Close()
+	if elapsed > time.Second || dropped < 2 {
+		t.Logf("expected non-blocking logging with dropped records got %s and %d dropped", elapsed, dropped)
+		t.Fail()
+	}
+}
+
+// Test of the regexp filters.
+func TestSink_WithRegexp(t *testing.T) {
+	output := bytes.NewBufferString("")
+	out := SinkTo(output, AsLogfmt()).WithRegexp("regexp-msg", `^user \d+`).WithoutRegexp("regexp-path", `^/health`).Start()
+
+	Log("regexp-msg", "user 12 logged in")
+	Log("regexp-msg", "admin logged in")
+	Log("regexp-msg", "user 13 checked", "regexp-path", "/healthz")
+	Log("regexp-msg", "user 14 checked", "regexp-path", "/users")
+
+	out.Close()
+	expected := "regexp-msg=\"user 12 logged in\" \nregexp-msg=\"user 14 checked\" regexp-path=\"/users\" \n"
+	if output.String() != expected {
+		t.Logf("expected %q got %q", expected, output.String())
+		t.Fail()
+	}
+}
@@ -0,0 +1,149 @@
+package kiwi
+
+// Enumeration and management of the registered sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// Named sets the name of the sink. The name allows to find the sink
+// later (see GetSink()) so the long running services need not keep
+// the references to the sinks for reconfiguring them:
+//
+//	kiwi.SinkTo(auditFile, kiwi.AsJSON()).Named("audit").Start()
+//	...
+//	kiwi.GetSink("audit").HasKey("user")
+func (s *Sink) Named(name string) *Sink {
+	if atomic.LoadInt32(s.state) > sinkClosed {
+		s.Lock()
+		s.name = name
+		s.Unlock()
+	}
+	return s
+}
+
+// Name returns the name of the sink set by Named().
+func (s *Sink) Name() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.name
+}
+
+// FilterInfo describes the filter of the sink set for the key.
+type FilterInfo struct {
+	Key string
+	// Negative is set for the filters that reject the matched
+	// records (HasNotKey(), HasNotValue() etc.).
+	Negative bool
+	// Filter is the description of the filter. The custom filters
+	// described by fmt "%v" verb.
+	Filter string
+}
+
+// Filters returns the filters of the sink ordered by the keys.
+func (s *Sink) Filters() []FilterInfo {
+	s.RLock()
+	var filters = make([]FilterInfo, 0, len(s.positiveFilters)+len(s.negativeFilters))
+	for key, f := range s.positiveFilters {
+		filters = append(filters, FilterInfo{Key: key, Filter: fmt.Sprintf("%v", f)})
+	}
+	for key, f := range s.negativeFilters {
+		filters = append(filters, FilterInfo{Key: key, Negative: true, Filter: fmt.Sprintf("%v", f)})
+	}
+	s.RUnlock()
+	sort.Slice(filters, func(i, j int) bool {
+		return filters[i].Key < filters[j].Key
+	})
+	return filters
+}
+
+// Active reports whether the sink is started and not closed.
+func (s *Sink) Active() bool {
+	return atomic.LoadInt32(s.state) == sinkActive
+}
+
+// Sinks returns all the sinks that are not closed in the order they
+// were created.
+func Sinks() []*Sink {
+	return DefaultCollector.Sinks()
+}
+
+// Sinks returns all the sinks of the collector that are not closed
+// in the order they were created.
+func (c *Collector) Sinks() []*Sink {
+	c.RLock()
+	var sinks = make([]*Sink, len(c.sinks))
+	copy(sinks, c.sinks)
+	c.RUnlock()
+	return sinks
+}
+
+// GetSink returns the sink with the name (see Named()) or nil if
+// there is no such sink.
+func GetSink(name string) *Sink {
+	return DefaultCollector.GetSink(name)
+}
+
+// GetSink returns the sink of the collector with the name (see
+// Named()) or nil if there is no such sink.
+func (c *Collector) GetSink(name string) *Sink {
+	c.RLock()
+	defer c.RUnlock()
+	for _, s := range c.sinks {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// CloseAll closes all the sinks and removes them from the list of the
+// sinks. The records that are logged after the call are not written
+// anywhere until new sinks created.
+func CloseAll() {
+	DefaultCollector.CloseAll()
+}
+
+// CloseAll closes all the sinks of the collector and removes them
+// from the collector.
+func (c *Collector) CloseAll() {
+	c.Lock()
+	var sinks = c.sinks
+	c.sinks = nil
+	c.Unlock()
+	for _, s := range sinks {
+		s.shutdown()
+	}
+}
@@ -0,0 +1,174 @@
+package slog
+
+// Handler for the standard library structured logger (log/slog) backed by kiwi sinks.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"context"
+	stdslog "log/slog"
+	"runtime"
+	"strconv"
+
+	"github.com/grafov/kiwi"
+)
+
+// Keys of the pairs added by the handler. The message logged under
+// kiwi.MessageKey and the level under kiwi.SeverityKey.
+var (
+	TimeKey   = stdslog.TimeKey
+	SourceKey = stdslog.SourceKey
+)
+
+// Handler implements slog.Handler. It passes the records to kiwi
+// sinks so the applications that use log/slog could route the
+// records through kiwi filters and formatters:
+//
+//	import kiwislog "github.com/grafov/kiwi/slog"
+//
+//	logger := slog.New(kiwislog.NewHandler(nil))
+//	logger.Info("user created", "id", 12)
+//	// time=... level="info" msg="user created" id=12
+//
+// The groups are flattened to the keys joined by
+// kiwi.PrefixSeparator. The handler is safe for concurrent usage.
+type Handler struct {
+	opts   stdslog.HandlerOptions
+	attrs  []interface{}
+	groups []string
+	prefix string
+}
+
+// NewHandler creates the handler with the options. Nil options mean
+// the defaults of slog (Info level, no source).
+func NewHandler(opts *stdslog.HandlerOptions) *Handler {
+	var h = new(Handler)
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// Enabled reports whether the level is enabled by the options.
+func (h *Handler) Enabled(_ context.Context, level stdslog.Level) bool {
+	var min = stdslog.LevelInfo
+	if h.opts.Level != nil {
+		min = h.opts.Level.Level()
+	}
+	return level >= min
+}
+
+// Handle passes the record to kiwi sinks.
+func (h *Handler) Handle(_ context.Context, r stdslog.Record) error {
+	var keyVals = make([]interface{}, 0, 8+len(h.attrs)+r.NumAttrs()*2)
+	if !r.Time.IsZero() {
+		keyVals = h.appendAttr(keyVals, nil, "", stdslog.Time(TimeKey, r.Time))
+	}
+	keyVals = h.appendAttr(keyVals, nil, "", stdslog.String(kiwi.SeverityKey, levelName(r.Level)))
+	if h.opts.AddSource && r.PC != 0 {
+		var frame, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+		keyVals = h.appendAttr(keyVals, nil, "", stdslog.String(SourceKey, frame.File+":"+strconv.Itoa(frame.Line)))
+	}
+	keyVals = h.appendAttr(keyVals, nil, "", stdslog.String(kiwi.MessageKey, r.Message))
+	keyVals = append(keyVals, h.attrs...)
+	r.Attrs(func(a stdslog.Attr) bool {
+		keyVals = h.appendAttr(keyVals, h.groups, h.prefix, a)
+		return true
+	})
+	kiwi.Log(keyVals...)
+	return nil
+}
+
+// WithAttrs returns the handler with the attributes added to all the
+// records.
+func (h *Handler) WithAttrs(attrs []stdslog.Attr) stdslog.Handler {
+	var h2 = *h
+	h2.attrs = append([]interface{}(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = h.appendAttr(h2.attrs, h.groups, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup returns the handler that prefixes the keys of the
+// attributes with the group name.
+func (h *Handler) WithGroup(name string) stdslog.Handler {
+	if name == "" {
+		return h
+	}
+	var h2 = *h
+	h2.groups = append(append([]string(nil), h.groups...), name)
+	h2.prefix = h.prefix + name + kiwi.PrefixSeparator
+	return &h2
+}
+
+// appendAttr appends the attribute as key-value pairs. The groups
+// are flattened.
+func (h *Handler) appendAttr(keyVals []interface{}, groups []string, prefix string, a stdslog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != stdslog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(stdslog.Attr{}) {
+		return keyVals
+	}
+	if a.Value.Kind() == stdslog.KindGroup {
+		var attrs = a.Value.Group()
+		if len(attrs) == 0 {
+			return keyVals
+		}
+		if a.Key != "" {
+			groups = append(append([]string(nil), groups...), a.Key)
+			prefix = prefix + a.Key + kiwi.PrefixSeparator
+		}
+		for _, ga := range attrs {
+			keyVals = h.appendAttr(keyVals, groups, prefix, ga)
+		}
+		return keyVals
+	}
+	return append(keyVals, prefix+a.Key, a.Value.Any())
+}
+
+// levelName returns the name of the level known by kiwi (see
+// kiwi.Severities). The levels between the standard ones are named
+// by the nearest lower standard level.
+func levelName(level stdslog.Level) string {
+	switch {
+	case level < stdslog.LevelInfo:
+		return "debug"
+	case level < stdslog.LevelWarn:
+		return "info"
+	case level < stdslog.LevelError:
+		return "warning"
+	}
+	return "error"
+}
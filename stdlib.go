@@ -0,0 +1,111 @@
+package kiwi
+
+// This file consists of the bridge from the standard log package.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"log"
+	"sync"
+)
+
+// StdlibWriter turns the lines written by the users of the standard
+// log package into the records. It conforms io.Writer.
+type StdlibWriter struct {
+	sync.Mutex
+	log *Logger
+	key string
+	buf []byte
+}
+
+// StdlibAdapter creates the writer that logs each line written to it
+// as the record with the text of the line under the key. So the
+// legacy code and third-party libraries that use the standard log
+// package pass their output through the sinks:
+//
+//	srv := &http.Server{ErrorLog: kiwi.StdlibAdapter(log, "msg").Logger()}
+//
+// The context of the logger is added to the records. Nil logger
+// means the logger forked from the global logger. Empty key means
+// MessageKey.
+func StdlibAdapter(l *Logger, key string) *StdlibWriter {
+	if l == nil {
+		l = Fork()
+	} else {
+		l = l.Fork()
+	}
+	if key == "" {
+		key = MessageKey
+	}
+	return &StdlibWriter{log: l, key: key}
+}
+
+// Write logs each complete line of p as the separate record. The
+// incomplete line kept until the rest of it written.
+func (w *StdlibWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	w.buf = append(w.buf, p...)
+	for {
+		var i = bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.logLine(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	w.Unlock()
+	return len(p), nil
+}
+
+// Logger returns the standard logger that writes to the adapter. It
+// has no prefix and no flags because the sinks add the time and other
+// details themselves.
+func (w *StdlibWriter) Logger() *log.Logger {
+	return log.New(w, "", 0)
+}
+
+// RedirectStdlog sets the adapter as the output of the standard
+// logger of the log package and clears its flags.
+func RedirectStdlog(l *Logger, key string) {
+	log.SetFlags(0)
+	log.SetOutput(StdlibAdapter(l, key))
+}
+
+func (w *StdlibWriter) logLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > 0 {
+		w.log.Log(w.key, string(line))
+	}
+}
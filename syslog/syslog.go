@@ -0,0 +1,323 @@
+package syslog
+
+// RFC 5424 formatter and the writer that sends the records to syslog servers.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafov/kiwi"
+)
+
+// Facility is the syslog facility of the messages.
+type Facility int
+
+// Syslog facilities (RFC 5424, section 6.2.1).
+const (
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslog
+	Lpr
+	News
+	Uucp
+	Cron
+	Authpriv
+	Ftp
+	Local0 Facility = iota + 4
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+var (
+	// SeverityKey is the key of the record level mapped to the
+	// syslog severity.
+	SeverityKey = kiwi.SeverityKey
+	// Severities maps the values of SeverityKey to the syslog
+	// severities. The records without the key or with unknown values
+	// get DefaultSeverity.
+	Severities = map[string]int{
+		"emergency": 0,
+		"fatal":     0,
+		"alert":     1,
+		"critical":  2,
+		"error":     3,
+		"warning":   4,
+		"warn":      4,
+		"notice":    5,
+		"info":      6,
+		"debug":     7,
+	}
+	// DefaultSeverity is "informational".
+	DefaultSeverity = 6
+	// StructuredDataID is the name of the structured data element
+	// with the pairs of the record. The default one uses the
+	// enterprise number reserved for documentation, replace it with
+	// your own.
+	StructuredDataID = "kiwi@32473"
+	// TimestampLayout is the layout of the message time.
+	TimestampLayout = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+type formatRFC5424 struct {
+	pri      int
+	header   string
+	severity int
+	msg      string
+	data     *bytes.Buffer
+	line     *bytes.Buffer
+}
+
+// AsRFC5424 says that a sink formats the records as RFC 5424 syslog
+// messages. The level of the record (see SeverityKey) mapped to the
+// severity of the message and the text under kiwi.MessageKey becomes
+// the message text. All other pairs are the parameters of the
+// structured data element:
+//
+//	w, err := syslog.Dial("udp", "localhost:514")
+//	kiwi.SinkTo(w, syslog.AsRFC5424(syslog.Local0, "billing")).Start()
+//	// <134>1 2019-01-02T15:04:05.000000Z host billing 4242 - [kiwi@32473 user="12"] invoice sent
+func AsRFC5424(facility Facility, appName string) *formatRFC5424 {
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &formatRFC5424{
+		pri:    int(facility) * 8,
+		header: " " + headerField(hostname, 255) + " " + headerField(appName, 48) + " " + strconv.Itoa(os.Getpid()) + " - ",
+		data:   bytes.NewBuffer(make([]byte, 0, 256)),
+		line:   bytes.NewBuffer(make([]byte, 0, 512)),
+	}
+}
+
+func (f *formatRFC5424) Begin() {
+	f.severity = DefaultSeverity
+	f.msg = ""
+	f.data.Reset()
+	f.line.Reset()
+}
+
+func (f *formatRFC5424) Pair(key, val string, valType int) {
+	switch key {
+	case SeverityKey:
+		if severity, ok := Severities[strings.ToLower(val)]; ok {
+			f.severity = severity
+			return
+		}
+	case kiwi.MessageKey:
+		f.msg = val
+		return
+	}
+	f.data.WriteByte(' ')
+	f.data.WriteString(paramName(key))
+	f.data.WriteString(`="`)
+	for i := 0; i < len(val); i++ {
+		switch val[i] {
+		case '"', '\\', ']':
+			f.data.WriteByte('\\')
+		}
+		f.data.WriteByte(val[i])
+	}
+	f.data.WriteByte('"')
+}
+
+func (f *formatRFC5424) Finish() []byte {
+	f.line.WriteByte('<')
+	f.line.WriteString(strconv.Itoa(f.pri + f.severity))
+	f.line.WriteString(">1 ")
+	f.line.WriteString(time.Now().Format(TimestampLayout))
+	f.line.WriteString(f.header)
+	if f.data.Len() == 0 {
+		f.line.WriteByte('-')
+	} else {
+		f.line.WriteByte('[')
+		f.line.WriteString(StructuredDataID)
+		f.line.Write(f.data.Bytes())
+		f.line.WriteByte(']')
+	}
+	if f.msg != "" {
+		f.line.WriteByte(' ')
+		f.line.WriteString(f.msg)
+	}
+	return f.line.Bytes()
+}
+
+// headerField replaces the chars not allowed in the header fields
+// and truncates the field to the maximal length.
+func headerField(s string, max int) string {
+	var b = []byte(s)
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+// paramName replaces the chars not allowed in the names of the
+// parameters of the structured data.
+func paramName(key string) string {
+	var b = []byte(headerField(key, 32))
+	for i, c := range b {
+		if c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// ErrClosed returned on writing to the closed writer.
+var ErrClosed = errors.New("syslog writer closed")
+
+// Writer sends the messages to syslog server. The messages sent over
+// UDP and Unix datagram sockets as is, one message per datagram, and
+// over TCP and Unix stream sockets with octet counting framing (RFC
+// 6587). The writer reconnects when the connection was broken.
+// Writer methods are safe for concurrent usage.
+type Writer struct {
+	network string
+	addr    string
+
+	sync.Mutex
+	conn   net.Conn
+	stream bool
+	closed bool
+}
+
+// Dial connects to syslog server. The network is "udp", "tcp" or
+// "unix" (for "/dev/log" for example, the datagram socket tried
+// first).
+func Dial(network, addr string) (*Writer, error) {
+	w := &Writer{network: network, addr: addr}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write sends a single message. The trailing line break is removed.
+func (w *Writer) Write(p []byte) (int, error) {
+	var msg = bytes.TrimRight(p, "\n")
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	var err error
+	if w.conn != nil {
+		if err = w.send(msg); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	// Reconnect and try once more.
+	if err = w.connect(); err != nil {
+		return 0, err
+	}
+	if err = w.send(msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection.
+func (w *Writer) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
+
+func (w *Writer) send(msg []byte) error {
+	if w.stream {
+		var frame = strconv.AppendInt(make([]byte, 0, len(msg)+8), int64(len(msg)), 10)
+		frame = append(append(frame, ' '), msg...)
+		_, err := w.conn.Write(frame)
+		return err
+	}
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+// connect dials the server. It should be called under the lock.
+func (w *Writer) connect() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch w.network {
+	case "unix":
+		if conn, err = net.Dial("unixgram", w.addr); err != nil {
+			conn, err = net.Dial("unix", w.addr)
+			w.stream = true
+		}
+	default:
+		conn, err = net.Dial(w.network, w.addr)
+		w.stream = !strings.HasPrefix(w.network, "udp") && w.network != "unixgram"
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
@@ -0,0 +1,148 @@
+package kiwi
+
+// This file consists of helpers for throttling of repeated records.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ThrottleIdle is the time after which the explicit keys of Once(),
+// EveryN() and EveryDuration() are forgotten if they were not used.
+// So the keys made of the request data don't grow the memory without
+// limit. Once() logs again with the forgotten key. Zero value keeps
+// the keys forever.
+var ThrottleIdle = time.Hour
+
+// throttles keeps the counters for Once(), EveryN() and
+// EveryDuration(). The keys are either program counters of the call
+// sites or explicit string keys.
+var throttles struct {
+	sync.Mutex
+	states map[interface{}]*throttleState
+	swept  time.Time
+}
+
+type throttleState struct {
+	count uint64
+	last  time.Time
+	used  time.Time
+}
+
+// Once returns the logger itself only on the first call from the call
+// site. Later calls return the logger that ignores the records:
+//
+//	for {
+//		log.Once().Log("msg", "loop started")
+//		...
+//	}
+//
+// Instead of the call site the explicit key may be passed. Then the
+// calls with the same key share the counter wherever they are.
+func (l *Logger) Once(key ...string) *Logger {
+	var st, unlock = throttleFor(key)
+	defer unlock()
+	st.count++
+	return l.When(st.count == 1)
+}
+
+// EveryN returns the logger itself on the first call and then on each
+// n-th call from the call site (or with the same explicit key).
+// Other calls return the logger that ignores the records.
+func (l *Logger) EveryN(n uint64, key ...string) *Logger {
+	var st, unlock = throttleFor(key)
+	defer unlock()
+	st.count++
+	return l.When(n <= 1 || st.count%n == 1)
+}
+
+// EveryDuration returns the logger itself not often than once per
+// the duration for the call site (or for the same explicit key).
+// Other calls return the logger that ignores the records.
+func (l *Logger) EveryDuration(d time.Duration, key ...string) *Logger {
+	var st, unlock = throttleFor(key)
+	defer unlock()
+	var now = time.Now()
+	if !st.last.IsZero() && now.Sub(st.last) < d {
+		return noop()
+	}
+	st.last = now
+	return l
+}
+
+// throttleFor returns the locked state for the explicit key or for
+// the call site of the helper that called it.
+func throttleFor(key []string) (*throttleState, func()) {
+	var id interface{}
+	if len(key) > 0 {
+		id = key[0]
+	} else {
+		pc, _, _, _ := runtime.Caller(2)
+		id = pc
+	}
+	var now = time.Now()
+	throttles.Lock()
+	if throttles.states == nil {
+		throttles.states = make(map[interface{}]*throttleState)
+	}
+	if ThrottleIdle > 0 && now.Sub(throttles.swept) > ThrottleIdle/2 {
+		removeIdleThrottles(now)
+	}
+	st, ok := throttles.states[id]
+	if !ok {
+		st = new(throttleState)
+		throttles.states[id] = st
+	}
+	st.used = now
+	return st, throttles.Unlock
+}
+
+// removeIdleThrottles forgets the explicit keys not used longer than
+// ThrottleIdle. The call sites are kept because their number is
+// limited by the program. It is called under the lock.
+func removeIdleThrottles(now time.Time) {
+	for id, st := range throttles.states {
+		if _, explicit := id.(string); explicit && now.Sub(st.used) > ThrottleIdle {
+			delete(throttles.states, id)
+		}
+	}
+	throttles.swept = now
+}
+
+// resetThrottles forgets all the counters. It is used by the tests.
+func resetThrottles() {
+	throttles.Lock()
+	throttles.states = nil
+	throttles.Unlock()
+}
@@ -0,0 +1,132 @@
+package kiwi
+
+/*
+Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व
+
+All tests consists of three parts:
+
+- arrange structures and initialize objects for use in tests
+- act on testing object
+- check and assert on results
+
+These parts separated by empty lines in each test function.
+*/
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test of logging only once from the call site.
+func TestLogger_Once_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	resetThrottles()
+
+	for i := 0; i < 3; i++ {
+		log.Once().Log("i", i)
+	}
+
+	out.Flush()
+	expected := `i=0`
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of logging each n-th record with the explicit key.
+func TestLogger_EveryN_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	resetThrottles()
+
+	for i := 0; i < 5; i++ {
+		log.EveryN(2, "test-every-n").Log("i", i)
+	}
+
+	out.Flush()
+	expected := "i=0 \ni=2 \ni=4"
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test of logging not often than once per duration.
+func TestLogger_EveryDuration_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).Start()
+	defer out.Close()
+	resetThrottles()
+
+	for i := 0; i < 3; i++ {
+		log.EveryDuration(time.Hour).Log("i", i)
+	}
+
+	out.Flush()
+	expected := `i=0`
+	if strings.TrimSpace(output.String()) != expected {
+		t.Logf("expected %s got %v", expected, output.String())
+		t.Fail()
+	}
+}
+
+// Test that the idle explicit keys are forgotten.
+func TestLogger_OnceIdleKey_Logfmt(t *testing.T) {
+	output := bytes.NewBufferString("")
+	log := New()
+	out := SinkTo(output, AsLogfmt()).HasKey("once-idle").Start()
+	defer out.Close()
+	resetThrottles()
+	ThrottleIdle = 10 * time.Millisecond
+	defer func() { ThrottleIdle = time.Hour }()
+
+	log.Once("idle-key").Log("once-idle", 1)
+	log.Once("idle-key").Log("once-idle", 2)
+	time.Sleep(30 * time.Millisecond)
+	log.Once("other-key")
+	log.Once("idle-key").Log("once-idle", 3)
+
+	out.Flush()
+	expected := "once-idle=1 \nonce-idle=3"
+	if strings.TrimSpace(output.String()) != expected || len(throttles.states) != 2 {
+		t.Logf("expected %s got %v with %d keys", expected, output.String(), len(throttles.states))
+		t.Fail()
+	}
+}
@@ -33,6 +33,7 @@ OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 ॐ तारे तुत्तारे तुरे स्व */
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/grafov/kiwi"
@@ -41,12 +42,54 @@ import (
 // DefaultKey defines the default key for the timestamp value.
 var DefaultKey = "at"
 
+// Special layouts for the timestamps as the numbers of the units
+// passed since Unix epoch.
+const (
+	Unix      = "unix"
+	UnixMilli = "unixmilli"
+	UnixMicro = "unixmicro"
+	UnixNano  = "unixnano"
+)
+
 // Set adds "timestamp" field to the context.
 func Set(format string) *kiwi.Pair {
+	return With(DefaultKey, format)
+}
+
+// With returns the pair with the time of the record under the key.
+// The time evaluated with the clock of the logger (see kiwi.Clock)
+// when the record emitted so the pair should be added to the context
+// of the logger once:
+//
+//	log.With(timestamp.With("ts", time.RFC3339Nano))
+//	log.With(timestamp.With("ts", timestamp.UnixMilli))
+//	// ts=1546441445123
+//
+// The layout is the layout of time.Format() or one of Unix,
+// UnixMilli, UnixMicro, UnixNano for the integer timestamps.
+func With(key, layout string) *kiwi.Pair {
+	var unit time.Duration
+	switch layout {
+	case Unix:
+		unit = time.Second
+	case UnixMilli:
+		unit = time.Millisecond
+	case UnixMicro:
+		unit = time.Microsecond
+	case UnixNano:
+		unit = time.Nanosecond
+	default:
+		return &kiwi.Pair{
+			Key:  key,
+			Val:  "",
+			Eval: func(now time.Time) string { return now.Format(layout) },
+			Type: kiwi.TimeVal,
+		}
+	}
 	return &kiwi.Pair{
-		Key:  DefaultKey,
+		Key:  key,
 		Val:  "",
-		Eval: func() string { return time.Now().Format(format) },
-		Type: kiwi.TimeVal,
+		Eval: func(now time.Time) string { return strconv.FormatInt(now.UnixNano()/int64(unit), 10) },
+		Type: kiwi.IntegerVal,
 	}
 }
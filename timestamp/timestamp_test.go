@@ -42,8 +42,10 @@ These parts separated by empty lines in each test function.
 
 import (
 	"bytes"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/grafov/kiwi"
 )
@@ -70,3 +72,37 @@ func TestSink_LogToStoppedSink_Logfmt(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Test of the timestamp as the integer number of milliseconds.
+func TestWith_UnixMilli(t *testing.T) {
+	out := bytes.NewBufferString("")
+	log := kiwi.New()
+	sink := kiwi.SinkTo(out, kiwi.AsLogfmt()).HasKey("ts-key").Start()
+
+	log.With(With("ts", UnixMilli))
+	log.Log("ts-key", "value")
+
+	sink.Flush().Close()
+	if !regexp.MustCompile(`^ts=\d{13} ts-key="value"`).MatchString(out.String()) {
+		t.Logf("expected the timestamp in milliseconds got %v", out.String())
+		t.Fail()
+	}
+}
+
+// Test of the timestamps of the frozen clock.
+func TestWith_FixedClock(t *testing.T) {
+	out := bytes.NewBufferString("")
+	log := kiwi.New().UseClock(kiwi.FixedClock(time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)))
+	sink := kiwi.SinkTo(out, kiwi.AsLogfmt()).HasKey("frozen").Start()
+
+	log.With(With("ts", time.RFC3339), With("ms", UnixMilli))
+	log.Log("frozen", 1)
+	log.Log("frozen", 2)
+
+	sink.Flush().Close()
+	expected := "ts=2019-01-02T15:04:05Z ms=1546441445000 frozen=1 \nts=2019-01-02T15:04:05Z ms=1546441445000 frozen=2 \n"
+	if out.String() != expected {
+		t.Logf("expected %q got %q", expected, out.String())
+		t.Fail()
+	}
+}
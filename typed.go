@@ -0,0 +1,113 @@
+package kiwi
+
+// Typed methods that add the pairs without boxing of the values.
+
+/* Copyright (c) 2016-2019, Alexander I.Grafov <grafov@gmail.com>
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of kvlog nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+ॐ तारे तुत्तारे तुरे स्व */
+
+import (
+	"strconv"
+	"time"
+)
+
+// AddString adds the pair with the string value to the record. The
+// typed Add methods convert the values without interface{} boxing and
+// reflection, and the pairs they add are reused by the logger for the
+// next records. So the hot path:
+//
+//	log.AddString("user", name).AddInt("items", n).Log()
+//
+// does not allocate except the conversion of the numbers to strings.
+func (l *Logger) AddString(key, val string) *Logger {
+	return l.addTyped(key, val, StringVal)
+}
+
+// AddInt adds the pair with the integer value to the record.
+func (l *Logger) AddInt(key string, val int64) *Logger {
+	return l.addTyped(key, strconv.FormatInt(val, 10), IntegerVal)
+}
+
+// AddUint adds the pair with the unsigned integer value to the
+// record.
+func (l *Logger) AddUint(key string, val uint64) *Logger {
+	return l.addTyped(key, strconv.FormatUint(val, 10), IntegerVal)
+}
+
+// AddFloat adds the pair with the float value to the record. The
+// value is formatted the same way as the floats passed to Add().
+func (l *Logger) AddFloat(key string, val float64) *Logger {
+	return l.addTyped(key, strconv.FormatFloat(val, FloatFormat, FloatPrecision, 64), FloatVal)
+}
+
+// AddBool adds the pair with the boolean value to the record.
+func (l *Logger) AddBool(key string, val bool) *Logger {
+	if val {
+		return l.addTyped(key, "true", BooleanVal)
+	}
+	return l.addTyped(key, "false", BooleanVal)
+}
+
+// AddTime adds the pair with the time value formatted with
+// TimeLayout to the record.
+func (l *Logger) AddTime(key string, val time.Time) *Logger {
+	return l.addTyped(key, val.Format(TimeLayout), TimeVal)
+}
+
+// addTyped adds the pair taken from the storage of the logger.
+func (l *Logger) addTyped(key, val string, valType int) *Logger {
+	if l.muted {
+		return l
+	}
+	if l.prefix != "" {
+		key = l.prefix + key
+	}
+	// The storage could be reallocated here but the pairs
+	// already added keep pointing to the previous one so they
+	// are still valid until the record logged.
+	l.typed = append(l.typed, Pair{key, val, nil, valType})
+	l.pairs = append(l.pairs, &l.typed[len(l.typed)-1])
+	return l
+}
+
+// resetPairs drops the pairs of the logged record but keeps the
+// memory for the next records. The record has own copies of the
+// pairs so they could be reused.
+func (l *Logger) resetPairs() {
+	// The logger without added pairs is not changed so it could be
+	// shared by the goroutines.
+	if len(l.pairs) == 0 && len(l.typed) == 0 {
+		return
+	}
+	for i := range l.pairs {
+		l.pairs[i] = nil
+	}
+	l.pairs = l.pairs[:0]
+	l.typed = l.typed[:0]
+}
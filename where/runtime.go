@@ -45,8 +45,15 @@ const (
 	// be passed.
 	FilePos  = 1
 	Function = 2
+	// Pkg adds the import path of the package of the caller.
+	Pkg = 4
+	// ShortPath trims the GOPATH or the module location from the
+	// file path of FilePos. The path starts with the import path of
+	// the package then: "github.com/grafov/kiwi/where/runtime.go:42".
+	ShortPath = 8
 
-	stackJump = 2
+	// kiwiFrames matches the functions of the logger itself.
+	kiwiFrames = "grafov/kiwi."
 )
 
 // What adds runtime information to the logger context. Remember that
@@ -54,35 +61,97 @@ const (
 //
 // log.Add(where.What(where.Filename, where.Func, where.Line)...)
 func What(parts int) []*kiwi.Pair {
-	var (
-		pairs []*kiwi.Pair
-		skip  = stackJump
-	)
+	return WithSkip(0, parts)
+}
+
+// WithSkip is the same as What() but it skips n frames of the stack
+// after the logger calls. So the wrapper libraries could report
+// the caller of the wrapper instead of the wrapper itself:
+//
+//	func (w *Wrapper) Info(keyVals ...interface{}) {
+//		w.log.Fork().With(where.WithSkip(1, where.FilePos)).Log(keyVals...)
+//	}
+func WithSkip(skip, parts int) []*kiwi.Pair {
+	var pairs []*kiwi.Pair
 	if parts&FilePos > 0 {
-		pairs = []*kiwi.Pair{{
+		pairs = append(pairs, &kiwi.Pair{
 			Key: "file",
 			Eval: func() string {
-			start:
-				pc, file, line, _ := runtime.Caller(skip)
-				function := runtime.FuncForPC(pc).Name()
-				if strings.LastIndex(function, "grafov/kiwi.") != -1 {
-					skip++
-					goto start
+				frame := caller(skip)
+				file := frame.File
+				if parts&ShortPath > 0 {
+					file = shortPath(frame)
 				}
-				return file + ":" + strconv.Itoa(line)
+				return file + ":" + strconv.Itoa(frame.Line)
 			},
-			Type: kiwi.StringVal}}
+			Type: kiwi.StringVal,
+		})
 	}
 	if parts&Function > 0 {
 		pairs = append(pairs, &kiwi.Pair{
 			Key: "function",
 			Eval: func() string {
-				pc, _, _, _ := runtime.Caller(skip)
-				function := runtime.FuncForPC(pc).Name()
-				return function
+				return caller(skip).Function
+			},
+			Type: kiwi.StringVal,
+		})
+	}
+	if parts&Pkg > 0 {
+		pairs = append(pairs, &kiwi.Pair{
+			Key: "package",
+			Eval: func() string {
+				return pkgPath(caller(skip).Function)
 			},
 			Type: kiwi.StringVal,
 		})
 	}
 	return pairs
 }
+
+// caller returns the frame of the function that called the logger
+// and skips n frames more. It should be called directly by the
+// evaluated value of the pair.
+func caller(skip int) runtime.Frame {
+	var pcs [64]uintptr
+	// Skip runtime.Callers(), caller() and the evaluated function.
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	var (
+		frame    runtime.Frame
+		more     = true
+		inLogger bool
+	)
+	for more {
+		frame, more = frames.Next()
+		if strings.Contains(frame.Function, kiwiFrames) {
+			inLogger = true
+			continue
+		}
+		if !inLogger {
+			continue
+		}
+		if skip == 0 {
+			break
+		}
+		skip--
+	}
+	return frame
+}
+
+// pkgPath cuts the import path of the package from the full name of
+// the function like "github.com/grafov/kiwi/where.What.func1".
+func pkgPath(function string) string {
+	var slash = strings.LastIndexByte(function, '/') + 1
+	if dot := strings.IndexByte(function[slash:], '.'); dot >= 0 {
+		return function[:slash+dot]
+	}
+	return function
+}
+
+// shortPath joins the import path of the package with the file name.
+func shortPath(frame runtime.Frame) string {
+	var name = frame.File[strings.LastIndexByte(frame.File, '/')+1:]
+	if frame.Function == "" {
+		return name
+	}
+	return pkgPath(frame.Function) + "/" + name
+}
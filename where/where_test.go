@@ -89,3 +89,46 @@ func TestWhereGlobal_GetAllInfo_Logfmt(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Test of the package name and the short path of the file.
+func TestWhere_PkgAndShortPath_Logfmt(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := kiwi.New()
+	out := kiwi.SinkTo(stream, kiwi.AsLogfmt()).HasKey("short").Start()
+
+	log.With(What(FilePos | ShortPath | Pkg))
+	log.Log("short", true)
+
+	out.Flush().Close()
+	expected := `file="github.com/grafov/kiwi/where/where_test.go:`
+	if !strings.Contains(stream.String(), expected) {
+		t.Logf("expected %s got %v", expected, stream.String())
+		t.Fail()
+	}
+	expected = `package="github.com/grafov/kiwi/where"`
+	if !strings.Contains(stream.String(), expected) {
+		t.Logf("expected %s got %v", expected, stream.String())
+		t.Fail()
+	}
+}
+
+// wrapper logs the record like the wrapper libraries do.
+func wrapper(log *kiwi.Logger, keyVals ...interface{}) {
+	log.Fork().With(WithSkip(1, Function)).Log(keyVals...)
+}
+
+// Test of the caller of the wrapper reported instead of the wrapper.
+func TestWhere_WithSkip_Logfmt(t *testing.T) {
+	stream := bytes.NewBufferString("")
+	log := kiwi.New()
+	out := kiwi.SinkTo(stream, kiwi.AsLogfmt()).HasKey("wrapped").Start()
+
+	wrapper(log, "wrapped", true)
+
+	out.Flush().Close()
+	expected := `function="github.com/grafov/kiwi/where.TestWhere_WithSkip_Logfmt"`
+	if !strings.Contains(stream.String(), expected) {
+		t.Logf("expected %s got %v", expected, stream.String())
+		t.Fail()
+	}
+}